@@ -0,0 +1,660 @@
+package gotinydb
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/index"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/numeric"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/dgraph-io/badger"
+)
+
+// AggregationType defines the computation done by an aggregation
+type AggregationType string
+
+// Defines the available aggregations
+const (
+	// AggregationTerms counts the documents of every distinct value
+	AggregationTerms AggregationType = "terms"
+	// AggregationNumericRange counts the documents in every given range
+	AggregationNumericRange AggregationType = "numeric_range"
+	// AggregationDateHistogram counts the documents in time buckets of the given interval
+	AggregationDateHistogram AggregationType = "date_histogram"
+	// AggregationSum adds the values
+	AggregationSum AggregationType = "sum"
+	// AggregationAvg computes the average of the values
+	AggregationAvg AggregationType = "avg"
+	// AggregationMin finds the smallest value
+	AggregationMin AggregationType = "min"
+	// AggregationMax finds the biggest value
+	AggregationMax AggregationType = "max"
+	// AggregationCardinality counts the distinct values
+	AggregationCardinality AggregationType = "cardinality"
+)
+
+// defaultTermsAggregationSize is the number of buckets returned by the terms aggregations by default
+const defaultTermsAggregationSize = 10
+
+type (
+	// Aggregation defines a computation over the documents matched by *Collection.Aggregate
+	Aggregation struct {
+		// Name identifies the result
+		Name string
+		Type AggregationType
+		// Field is the JSON path of the value, like "address.city"
+		Field string
+
+		// Size limits the number of buckets of the terms aggregations (default 10)
+		Size int
+		// Ranges defines the buckets of the numeric range aggregations
+		Ranges []*AggregationRange
+		// Interval defines the buckets of the date histogram aggregations
+		Interval time.Duration
+	}
+
+	// AggregationRange defines a numeric range bucket.
+	// From is inclusive and To exclusive, nil means unbounded.
+	AggregationRange struct {
+		Name     string
+		From, To *float64
+	}
+
+	// AggregationResult is the result of an aggregation
+	AggregationResult struct {
+		Name string
+		Type AggregationType
+
+		// Value is the result of the sum, avg, min, max and cardinality aggregations
+		Value float64
+		// Count is the number of values aggregated
+		Count uint64
+
+		// Buckets are the results of the terms, numeric range and date histogram aggregations
+		Buckets []*AggregationBucket
+	}
+
+	// AggregationBucket is a group of documents
+	AggregationBucket struct {
+		Key string
+		// From and To are set for the numeric range buckets
+		From, To *float64
+		// Start is set for the date histogram buckets
+		Start time.Time
+		// Count is the number of documents in the bucket
+		Count uint64
+	}
+
+	// aggregationState accumulates the values of one aggregation
+	aggregationState struct {
+		aggregation *Aggregation
+		// fieldType is set if the values are read from the index doc values
+		fieldType string
+
+		count    uint64
+		sum      float64
+		min, max float64
+
+		terms     map[string]uint64
+		ranges    []uint64
+		histogram map[int64]uint64
+	}
+)
+
+// Aggregate computes the given aggregations over the documents matched by the query.
+// If the query is nil every document of the collection is used.
+//
+// The query runs on the index mapping every field of the query, ErrIndexNotFound is returned
+// if there is none. When many indexes can be used the one with the most aggregations reading
+// their values from the index is chosen.
+// When the index maps the field with a compatible type (numeric, datetime or text with the
+// keyword analyzer) the values are read from the index. Otherwise the matched documents are
+// read from the collection in one read transaction.
+// The results are returned by aggregation name.
+func (c *Collection) Aggregate(q query.Query, aggregations []Aggregation) (map[string]*AggregationResult, error) {
+	states := make([]*aggregationState, len(aggregations))
+	names := map[string]struct{}{}
+	for i := range aggregations {
+		aggregation := &aggregations[i]
+		if !aggregation.valid() {
+			return nil, ErrInvalidAggregation
+		}
+		if _, duplicate := names[aggregation.Name]; duplicate {
+			return nil, ErrInvalidAggregation
+		}
+		names[aggregation.Name] = struct{}{}
+
+		states[i] = newAggregationState(aggregation)
+	}
+
+	indexName, err := c.aggregationIndex(q, aggregations)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	if indexName != "" {
+		bleveIndex, release, err := c.useBleveIndex(indexName)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		if q == nil {
+			q = bleve.NewMatchAllQuery()
+		}
+
+		ids, err = bleveIndex.searchIDs(q)
+		if err != nil {
+			return nil, err
+		}
+
+		err = bleveIndex.aggregateDocValues(ids, states)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = c.aggregateDocuments(ids, states)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]*AggregationResult{}
+	for _, state := range states {
+		ret[state.aggregation.Name] = state.result()
+	}
+
+	return ret, nil
+}
+
+// aggregationIndex returns the name of the index running the query of the aggregations.
+// Without query an index is only used if some aggregations can read the index values,
+// the empty name means the documents are read from the collection.
+func (c *Collection) aggregationIndex(q query.Query, aggregations []Aggregation) (string, error) {
+	var fields []string
+	if q != nil {
+		fields = queryFields(q)
+	}
+
+	name, score := "", 0
+	for _, indexName := range c.GetBleveIndexes() {
+		index, err := c.GetBleveIndex(indexName)
+		if err != nil {
+			continue
+		}
+		indexMapping, ok := index.bleveIndex.Mapping().(*mapping.IndexMappingImpl)
+		if !ok || !mapsFields(indexMapping, fields) {
+			continue
+		}
+
+		indexScore := 1
+		for i := range aggregations {
+			if docValuesFieldType(indexMapping, &aggregations[i]) != "" {
+				indexScore++
+			}
+		}
+		if indexScore > score {
+			name, score = indexName, indexScore
+		}
+	}
+
+	if q == nil {
+		if score > 1 {
+			return name, nil
+		}
+		return "", nil
+	}
+	if name == "" {
+		return "", ErrIndexNotFound
+	}
+	return name, nil
+}
+
+// queryFields returns the fields of the query and of its sub queries.
+// The queries on the default field are not part of the list.
+func queryFields(q query.Query) (fields []string) {
+	switch typed := q.(type) {
+	case *query.ConjunctionQuery:
+		for _, sub := range typed.Conjuncts {
+			fields = append(fields, queryFields(sub)...)
+		}
+	case *query.DisjunctionQuery:
+		for _, sub := range typed.Disjuncts {
+			fields = append(fields, queryFields(sub)...)
+		}
+	case *query.BooleanQuery:
+		for _, sub := range []query.Query{typed.Must, typed.Should, typed.MustNot} {
+			if sub != nil {
+				fields = append(fields, queryFields(sub)...)
+			}
+		}
+	case query.FieldableQuery:
+		if field := typed.Field(); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
+
+// mapsFields returns true if every field is indexed by the mapping
+func mapsFields(indexMapping *mapping.IndexMappingImpl, fields []string) bool {
+	for _, field := range fields {
+		if fieldMappingForPath(indexMapping.DefaultMapping, field) == nil && !indexMapping.DefaultMapping.Dynamic {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregateDocuments reads the documents from the collection for the aggregations
+// which can't use the doc values. If ids is nil every document is used.
+func (c *Collection) aggregateDocuments(ids []string, states []*aggregationState) error {
+	documentStates := []*aggregationState{}
+	for _, state := range states {
+		if state.fieldType == "" {
+			documentStates = append(documentStates, state)
+		}
+	}
+	if len(documentStates) == 0 {
+		return nil
+	}
+
+	addDocument := func(clearBytes []byte) error {
+		var document interface{}
+		if json.Unmarshal(clearBytes, &document) != nil {
+			// Not a JSON document
+			return nil
+		}
+
+		for _, state := range documentStates {
+			state.addDocument(valuesAtPath(document, strings.Split(state.aggregation.Field, ".")))
+		}
+		return nil
+	}
+
+	return c.db.badger.View(func(txn *badger.Txn) error {
+		if ids != nil {
+			return c.readDocuments(txn, ids, func(id string, clearBytes []byte) error {
+				if clearBytes == nil {
+					// Indexed but removed
+					return nil
+				}
+				return addDocument(clearBytes)
+			})
+		}
+
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		colPrefix := c.buildDBKey("")
+		for iter.Seek(colPrefix); iter.ValidForPrefix(colPrefix); iter.Next() {
+			item := iter.Item()
+
+			var encryptedValue []byte
+			encryptedValue, err := item.ValueCopy(encryptedValue)
+			if err != nil {
+				return err
+			}
+
+			var clearBytes []byte
+			clearBytes, err = c.db.decryptData(item.Key(), encryptedValue)
+			if err != nil {
+				return err
+			}
+
+			err = addDocument(clearBytes)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// aggregateDocValues feeds the aggregations which can use the index terms
+func (i *BleveIndex) aggregateDocValues(ids []string, states []*aggregationState) error {
+	indexMapping, ok := i.bleveIndex.Mapping().(*mapping.IndexMappingImpl)
+	if !ok {
+		return nil
+	}
+
+	fieldStates := map[string][]*aggregationState{}
+	fields := []string{}
+	for _, state := range states {
+		state.fieldType = docValuesFieldType(indexMapping, state.aggregation)
+		if state.fieldType == "" {
+			continue
+		}
+
+		if _, ok := fieldStates[state.aggregation.Field]; !ok {
+			fields = append(fields, state.aggregation.Field)
+		}
+		fieldStates[state.aggregation.Field] = append(fieldStates[state.aggregation.Field], state)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	advancedIndex, _, err := i.bleveIndex.Advanced()
+	if err != nil {
+		return err
+	}
+
+	reader, err := advancedIndex.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	docValueReader, err := reader.DocValueReader(fields)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		var internalID index.IndexInternalID
+		internalID, err = reader.InternalID(id)
+		if err != nil {
+			return err
+		}
+
+		values := map[string][]interface{}{}
+		err = docValueReader.VisitDocValues(internalID, func(field string, term []byte) {
+			fieldType := fieldStates[field][0].fieldType
+			if value := decodeDocValue(fieldType, term); value != nil {
+				values[field] = append(values[field], value)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		for field, states := range fieldStates {
+			for _, state := range states {
+				state.addDocument(values[field])
+			}
+		}
+	}
+
+	return nil
+}
+
+// docValuesFieldType returns the type of the field if the aggregation can use the index terms
+func docValuesFieldType(indexMapping *mapping.IndexMappingImpl, aggregation *Aggregation) string {
+	fieldMapping := fieldMappingForPath(indexMapping.DefaultMapping, aggregation.Field)
+	if fieldMapping == nil {
+		return ""
+	}
+
+	switch aggregation.Type {
+	case AggregationTerms, AggregationCardinality:
+		if fieldMapping.Type == "text" && indexMapping.AnalyzerNameForPath(aggregation.Field) == keyword.Name {
+			return fieldMapping.Type
+		}
+		if fieldMapping.Type == "number" && aggregation.Type == AggregationCardinality {
+			return fieldMapping.Type
+		}
+	case AggregationDateHistogram:
+		if fieldMapping.Type == "datetime" {
+			return fieldMapping.Type
+		}
+	default:
+		if fieldMapping.Type == "number" {
+			return fieldMapping.Type
+		}
+	}
+
+	return ""
+}
+
+// decodeDocValue converts the index term to the aggregated value.
+// The numeric values are indexed with many precisions, only the full precision is kept.
+func decodeDocValue(fieldType string, term []byte) interface{} {
+	if fieldType == "text" {
+		return string(term)
+	}
+
+	prefixCoded := numeric.PrefixCoded(term)
+	shift, err := prefixCoded.Shift()
+	if err != nil || shift != 0 {
+		return nil
+	}
+	i, err := prefixCoded.Int64()
+	if err != nil {
+		return nil
+	}
+
+	if fieldType == "datetime" {
+		return time.Unix(0, i).UTC()
+	}
+	return numeric.Int64ToFloat64(i)
+}
+
+// valuesAtPath returns the values of the decoded JSON document at the given path.
+// The arrays are flattened.
+func valuesAtPath(document interface{}, path []string) []interface{} {
+	switch typed := document.(type) {
+	case []interface{}:
+		ret := []interface{}{}
+		for _, elem := range typed {
+			ret = append(ret, valuesAtPath(elem, path)...)
+		}
+		return ret
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return nil
+		}
+		return valuesAtPath(typed[path[0]], path[1:])
+	case nil:
+		return nil
+	}
+
+	if len(path) != 0 {
+		return nil
+	}
+	return []interface{}{document}
+}
+
+func (a *Aggregation) valid() bool {
+	if a == nil || a.Name == "" || a.Field == "" {
+		return false
+	}
+
+	switch a.Type {
+	case AggregationTerms, AggregationSum, AggregationAvg, AggregationMin, AggregationMax, AggregationCardinality:
+		return true
+	case AggregationNumericRange:
+		return len(a.Ranges) != 0
+	case AggregationDateHistogram:
+		return a.Interval > 0
+	}
+
+	return false
+}
+
+func newAggregationState(aggregation *Aggregation) *aggregationState {
+	return &aggregationState{
+		aggregation: aggregation,
+		terms:       map[string]uint64{},
+		ranges:      make([]uint64, len(aggregation.Ranges)),
+		histogram:   map[int64]uint64{},
+	}
+}
+
+// addDocument aggregates the values of one document.
+// The buckets count every document once.
+func (s *aggregationState) addDocument(values []interface{}) {
+	seenTerms := map[string]struct{}{}
+	seenRanges := map[int]struct{}{}
+	seenBuckets := map[int64]struct{}{}
+
+	for _, value := range values {
+		switch s.aggregation.Type {
+		case AggregationTerms, AggregationCardinality:
+			term, ok := termOf(value)
+			if !ok {
+				continue
+			}
+			s.count++
+			if _, seen := seenTerms[term]; !seen {
+				seenTerms[term] = struct{}{}
+				s.terms[term]++
+			}
+		case AggregationDateHistogram:
+			t, ok := timeOf(value)
+			if !ok {
+				continue
+			}
+			s.count++
+			bucket := t.Truncate(s.aggregation.Interval).UnixNano()
+			if _, seen := seenBuckets[bucket]; !seen {
+				seenBuckets[bucket] = struct{}{}
+				s.histogram[bucket]++
+			}
+		default:
+			f, ok := value.(float64)
+			if !ok {
+				continue
+			}
+			s.addNumber(f)
+
+			for i, r := range s.aggregation.Ranges {
+				if _, seen := seenRanges[i]; seen {
+					continue
+				}
+				if (r.From == nil || f >= *r.From) && (r.To == nil || f < *r.To) {
+					seenRanges[i] = struct{}{}
+					s.ranges[i]++
+				}
+			}
+		}
+	}
+}
+
+func (s *aggregationState) addNumber(f float64) {
+	if s.count == 0 || f < s.min {
+		s.min = f
+	}
+	if s.count == 0 || f > s.max {
+		s.max = f
+	}
+	s.sum += f
+	s.count++
+}
+
+func (s *aggregationState) result() *AggregationResult {
+	ret := &AggregationResult{
+		Name:  s.aggregation.Name,
+		Type:  s.aggregation.Type,
+		Count: s.count,
+	}
+
+	switch s.aggregation.Type {
+	case AggregationSum:
+		ret.Value = s.sum
+	case AggregationAvg:
+		if s.count != 0 {
+			ret.Value = s.sum / float64(s.count)
+		}
+	case AggregationMin:
+		ret.Value = s.min
+	case AggregationMax:
+		ret.Value = s.max
+	case AggregationCardinality:
+		ret.Value = float64(len(s.terms))
+	case AggregationTerms:
+		ret.Buckets = make([]*AggregationBucket, 0, len(s.terms))
+		for term, count := range s.terms {
+			ret.Buckets = append(ret.Buckets, &AggregationBucket{Key: term, Count: count})
+		}
+		sort.Slice(ret.Buckets, func(i, j int) bool {
+			if ret.Buckets[i].Count != ret.Buckets[j].Count {
+				return ret.Buckets[i].Count > ret.Buckets[j].Count
+			}
+			return ret.Buckets[i].Key < ret.Buckets[j].Key
+		})
+
+		size := s.aggregation.Size
+		if size <= 0 {
+			size = defaultTermsAggregationSize
+		}
+		if len(ret.Buckets) > size {
+			ret.Buckets = ret.Buckets[:size]
+		}
+	case AggregationNumericRange:
+		ret.Buckets = make([]*AggregationBucket, len(s.aggregation.Ranges))
+		for i, r := range s.aggregation.Ranges {
+			ret.Buckets[i] = &AggregationBucket{
+				Key:   r.key(),
+				From:  r.From,
+				To:    r.To,
+				Count: s.ranges[i],
+			}
+		}
+	case AggregationDateHistogram:
+		ret.Buckets = make([]*AggregationBucket, 0, len(s.histogram))
+		for start, count := range s.histogram {
+			startTime := time.Unix(0, start).UTC()
+			ret.Buckets = append(ret.Buckets, &AggregationBucket{
+				Key:   startTime.Format(time.RFC3339),
+				Start: startTime,
+				Count: count,
+			})
+		}
+		sort.Slice(ret.Buckets, func(i, j int) bool {
+			return ret.Buckets[i].Start.Before(ret.Buckets[j].Start)
+		})
+	}
+
+	return ret
+}
+
+// key returns the name of the range or a name built from the limits
+func (r *AggregationRange) key() string {
+	if r.Name != "" {
+		return r.Name
+	}
+
+	limit := func(f *float64) string {
+		if f == nil {
+			return "*"
+		}
+		return strconv.FormatFloat(*f, 'f', -1, 64)
+	}
+	return limit(r.From) + "-" + limit(r.To)
+}
+
+// termOf returns the string representation of the JSON scalar
+func termOf(value interface{}) (string, bool) {
+	switch typed := value.(type) {
+	case string:
+		return typed, true
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(typed), true
+	}
+	return "", false
+}
+
+// timeOf returns the time of the doc value or of the JSON string
+func timeOf(value interface{}) (time.Time, bool) {
+	switch typed := value.(type) {
+	case time.Time:
+		return typed, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, typed)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t.UTC(), true
+	}
+	return time.Time{}, false
+}
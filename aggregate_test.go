@@ -0,0 +1,177 @@
+package gotinydb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+type aggregateTestOrder struct {
+	Status   string    `json:"status" gotinydb:"analyzer=keyword"`
+	Amount   float64   `json:"amount"`
+	Created  time.Time `json:"created"`
+	Customer struct {
+		Country string `json:"country"`
+	} `json:"customer" gotinydb:"-"`
+}
+
+func TestAggregate(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	orderCol, err := testDB.Use("orders")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = orderCol.SetBleveIndexFor("orders", &aggregateTestOrder{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	day := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	orders := []struct {
+		status, country string
+		amount          float64
+		day             int
+	}{
+		{"paid", "FR", 10, 0},
+		{"paid", "FR", 20, 0},
+		{"paid", "DE", 30, 1},
+		{"pending", "US", 40, 2},
+		{"canceled", "US", 50, 2},
+	}
+	// The same orders in a collection without index
+	plainCol, err := testDB.Use("plain orders")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, col := range []*Collection{orderCol, plainCol} {
+		batch, _ := col.NewBatch(context.Background())
+		for i, o := range orders {
+			order := &aggregateTestOrder{Status: o.status, Amount: o.amount, Created: day.Add(time.Duration(o.day)*24*time.Hour + time.Hour)}
+			order.Customer.Country = o.country
+			batch.Put(fmt.Sprintf("order %d", i), order)
+		}
+		err = batch.Write()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	twenty, forty := 20.0, 40.0
+	aggregations := []Aggregation{
+		{Name: "status", Type: AggregationTerms, Field: "status", Size: 2},
+		{Name: "total", Type: AggregationSum, Field: "amount"},
+		{Name: "average", Type: AggregationAvg, Field: "amount"},
+		{Name: "smallest", Type: AggregationMin, Field: "amount"},
+		{Name: "biggest", Type: AggregationMax, Field: "amount"},
+		{Name: "countries", Type: AggregationCardinality, Field: "customer.country"},
+		{Name: "amounts", Type: AggregationNumericRange, Field: "amount", Ranges: []*AggregationRange{
+			{Name: "small", To: &twenty},
+			{From: &twenty, To: &forty},
+			{From: &forty},
+		}},
+		{Name: "daily", Type: AggregationDateHistogram, Field: "created", Interval: 24 * time.Hour},
+	}
+
+	check := func(results map[string]*AggregationResult, step string) {
+		if r := results["status"]; len(r.Buckets) != 2 || r.Buckets[0].Key != "paid" || r.Buckets[0].Count != 3 || r.Buckets[1].Key != "canceled" {
+			t.Errorf("%s: unexpected terms buckets %v", step, r.Buckets)
+		}
+		for name, expected := range map[string]float64{"total": 150, "average": 30, "smallest": 10, "biggest": 50, "countries": 3} {
+			if results[name].Value != expected {
+				t.Errorf("%s: expected %q to be %f but got %f", step, name, expected, results[name].Value)
+			}
+		}
+		rangeCounts := []uint64{1, 2, 2}
+		for i, bucket := range results["amounts"].Buckets {
+			if bucket.Count != rangeCounts[i] {
+				t.Errorf("%s: expected %d documents in range %q but got %d", step, rangeCounts[i], bucket.Key, bucket.Count)
+			}
+		}
+		if results["amounts"].Buckets[1].Key != "20-40" {
+			t.Errorf("%s: unexpected range key %q", step, results["amounts"].Buckets[1].Key)
+		}
+		dailyCounts := []uint64{2, 1, 2}
+		if r := results["daily"]; len(r.Buckets) != 3 {
+			t.Errorf("%s: expected %d days but got %d", step, 3, len(r.Buckets))
+		} else {
+			for i, bucket := range r.Buckets {
+				if bucket.Count != dailyCounts[i] || !bucket.Start.Equal(day.Add(time.Duration(i)*24*time.Hour)) {
+					t.Errorf("%s: unexpected day bucket %v", step, bucket)
+				}
+			}
+		}
+	}
+
+	// With the index doc values
+	if name, _ := orderCol.aggregationIndex(nil, aggregations); name != "orders" {
+		t.Errorf("expected the index %q to be used but got %q", "orders", name)
+	}
+	results, err := orderCol.Aggregate(nil, aggregations)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	check(results, "index")
+
+	// Only with the collection documents
+	results, err = plainCol.Aggregate(nil, aggregations)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	check(results, "collection")
+
+	// The query runs on the index mapping its fields
+	amountMapping := bleve.NewDocumentStaticMapping()
+	amountMapping.AddFieldMappingsAt("amount", bleve.NewNumericFieldMapping())
+	err = orderCol.SetBleveIndex("amounts", amountMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	q := bleve.NewTermQuery("paid")
+	q.SetField("status")
+	if name, _ := orderCol.aggregationIndex(q, nil); name != "orders" {
+		t.Errorf("expected the index %q to be used but got %q", "orders", name)
+	}
+
+	// Over a search result
+	results, err = orderCol.Aggregate(q, []Aggregation{
+		{Name: "total", Type: AggregationSum, Field: "amount"},
+		{Name: "countries", Type: AggregationTerms, Field: "customer.country"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if results["total"].Value != 60 || results["total"].Count != 3 {
+		t.Errorf("expected a total of %d over %d orders but got %v", 60, 3, results["total"])
+	}
+	if b := results["countries"].Buckets; len(b) != 2 || b[0].Key != "FR" || b[0].Count != 2 {
+		t.Errorf("unexpected countries %v", b)
+	}
+
+	_, err = orderCol.Aggregate(nil, []Aggregation{{Name: "bad", Type: AggregationDateHistogram, Field: "created"}})
+	if err != ErrInvalidAggregation {
+		t.Errorf("expected %v but got %v", ErrInvalidAggregation, err)
+	}
+	// No index maps the field of the query
+	unknownQuery := bleve.NewTermQuery("FR")
+	unknownQuery.SetField("customer.country")
+	_, err = orderCol.Aggregate(unknownQuery, aggregations)
+	if err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+}
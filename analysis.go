@@ -0,0 +1,137 @@
+package gotinydb
+
+import (
+	"sort"
+
+	"github.com/blevesearch/bleve/mapping"
+)
+
+type (
+	// IndexAnalysis defines the custom analysis components of an index.
+	// The definitions follow the Bleve custom analysis configuration, every element
+	// must have a "type" entry naming a registered constructor:
+	//	analysis := NewIndexAnalysis()
+	//	analysis.AddTokenFilter("edge_ngram", map[string]interface{}{
+	//		"type": edgengram.Name, "min": 2.0, "max": 10.0,
+	//	})
+	//	analysis.AddAnalyzer("autocomplete", map[string]interface{}{
+	//		"type":          custom.Name,
+	//		"tokenizer":     unicode.Name,
+	//		"token_filters": []string{lowercase.Name, "edge_ngram"},
+	//	})
+	//
+	// The language analyzers of Bleve ("fr", "de", "en"...) are registered by default
+	// and can be used without any custom definition.
+	// The definitions are saved with the index configuration.
+	IndexAnalysis struct {
+		CharFilters  map[string]map[string]interface{} `json:"char_filters,omitempty"`
+		Tokenizers   map[string]map[string]interface{} `json:"tokenizers,omitempty"`
+		TokenMaps    map[string]map[string]interface{} `json:"token_maps,omitempty"`
+		TokenFilters map[string]map[string]interface{} `json:"token_filters,omitempty"`
+		Analyzers    map[string]map[string]interface{} `json:"analyzers,omitempty"`
+
+		// DefaultAnalyzer is used by the fields which do not define an analyzer
+		DefaultAnalyzer string `json:"default_analyzer,omitempty"`
+	}
+)
+
+// NewIndexAnalysis returns an empty analysis definition
+func NewIndexAnalysis() *IndexAnalysis {
+	return &IndexAnalysis{
+		CharFilters:  map[string]map[string]interface{}{},
+		Tokenizers:   map[string]map[string]interface{}{},
+		TokenMaps:    map[string]map[string]interface{}{},
+		TokenFilters: map[string]map[string]interface{}{},
+		Analyzers:    map[string]map[string]interface{}{},
+	}
+}
+
+// AddCharFilter defines a custom char filter
+func (a *IndexAnalysis) AddCharFilter(name string, config map[string]interface{}) {
+	a.CharFilters = addAnalysisComponent(a.CharFilters, name, config)
+}
+
+// AddTokenizer defines a custom tokenizer
+func (a *IndexAnalysis) AddTokenizer(name string, config map[string]interface{}) {
+	a.Tokenizers = addAnalysisComponent(a.Tokenizers, name, config)
+}
+
+// AddTokenMap defines a custom token map, used by the stop words filters for example
+func (a *IndexAnalysis) AddTokenMap(name string, config map[string]interface{}) {
+	a.TokenMaps = addAnalysisComponent(a.TokenMaps, name, config)
+}
+
+// AddTokenFilter defines a custom token filter
+func (a *IndexAnalysis) AddTokenFilter(name string, config map[string]interface{}) {
+	a.TokenFilters = addAnalysisComponent(a.TokenFilters, name, config)
+}
+
+// AddAnalyzer defines a custom analyzer
+func (a *IndexAnalysis) AddAnalyzer(name string, config map[string]interface{}) {
+	a.Analyzers = addAnalysisComponent(a.Analyzers, name, config)
+}
+
+func addAnalysisComponent(components map[string]map[string]interface{}, name string, config map[string]interface{}) map[string]map[string]interface{} {
+	if components == nil {
+		components = map[string]map[string]interface{}{}
+	}
+	components[name] = config
+	return components
+}
+
+// apply defines the components into the index mapping.
+// The components already defined by the mapping are skipped.
+func (a *IndexAnalysis) apply(indexMapping *mapping.IndexMappingImpl) error {
+	if a == nil {
+		return nil
+	}
+
+	// The order matters because the components can depend on the previous ones
+	steps := []struct {
+		components map[string]map[string]interface{}
+		defined    map[string]map[string]interface{}
+		add        func(string, map[string]interface{}) error
+	}{
+		{a.CharFilters, indexMapping.CustomAnalysis.CharFilters, indexMapping.AddCustomCharFilter},
+		{a.Tokenizers, indexMapping.CustomAnalysis.Tokenizers, indexMapping.AddCustomTokenizer},
+		{a.TokenMaps, indexMapping.CustomAnalysis.TokenMaps, indexMapping.AddCustomTokenMap},
+		{a.TokenFilters, indexMapping.CustomAnalysis.TokenFilters, indexMapping.AddCustomTokenFilter},
+		{a.Analyzers, indexMapping.CustomAnalysis.Analyzers, indexMapping.AddCustomAnalyzer},
+	}
+
+	for _, step := range steps {
+		names := []string{}
+		for name := range step.components {
+			if _, defined := step.defined[name]; !defined {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		// The components of the same kind can depend on each other, like a tokenizer
+		// wrapping an other one. The failing ones are tried again until none can be added.
+		for len(names) != 0 {
+			failed := []string{}
+			var firstErr error
+			for _, name := range names {
+				err := step.add(name, step.components[name])
+				if err != nil {
+					failed = append(failed, name)
+					if firstErr == nil {
+						firstErr = err
+					}
+				}
+			}
+			if len(failed) == len(names) {
+				return firstErr
+			}
+			names = failed
+		}
+	}
+
+	if a.DefaultAnalyzer != "" {
+		indexMapping.DefaultAnalyzer = a.DefaultAnalyzer
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package gotinydb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/lang/fr"
+	"github.com/blevesearch/bleve/analysis/token/edgengram"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/exception"
+	"github.com/blevesearch/bleve/analysis/tokenizer/regexp"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+)
+
+func TestSetBleveIndexWithAnalysis(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	articleCol, err := testDB.Use("articles")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	analysis := NewIndexAnalysis()
+	analysis.AddTokenFilter("edge_ngram", map[string]interface{}{
+		"type": edgengram.Name,
+		"min":  2.0,
+		"max":  10.0,
+	})
+	analysis.AddAnalyzer("autocomplete", map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name, "edge_ngram"},
+	})
+
+	titleMapping := bleve.NewTextFieldMapping()
+	titleMapping.Analyzer = "autocomplete"
+	bodyMapping := bleve.NewTextFieldMapping()
+	bodyMapping.Analyzer = fr.AnalyzerName
+
+	articleMapping := bleve.NewDocumentStaticMapping()
+	articleMapping.AddFieldMappingsAt("title", titleMapping)
+	articleMapping.AddFieldMappingsAt("body", bodyMapping)
+
+	err = articleCol.SetBleveIndexWithAnalysis("articles", articleMapping, analysis)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = articleCol.Put("a1", map[string]string{
+		"title": "Automobile",
+		"body":  "Les maisons sont grandes",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	check := func(col *Collection, step string) {
+		titleQuery := bleve.NewTermQuery("aut")
+		titleQuery.SetField("title")
+		if _, err := col.Search("articles", titleQuery); err != nil {
+			t.Errorf("%s: the custom analyzer must index the prefixes: %v", step, err)
+		}
+
+		bodyQuery := bleve.NewMatchQuery("maison")
+		bodyQuery.SetField("body")
+		if _, err := col.Search("articles", bodyQuery); err != nil {
+			t.Errorf("%s: the french analyzer must stem the words: %v", step, err)
+		}
+	}
+	check(articleCol, "build")
+
+	// The same mapping without the analysis is a different definition
+	err = articleCol.SetBleveIndex("articles", articleMapping)
+	if err != ErrIndexAllreadyExistsWithDifferentMapping {
+		t.Errorf("expected %v but got %v", ErrIndexAllreadyExistsWithDifferentMapping, err)
+	}
+
+	// The analysis is kept by the rebuild
+	err = articleCol.RebuildIndex("articles")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	check(articleCol, "rebuild")
+
+	var backup bytes.Buffer
+	err = testDB.Backup(&backup)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The analysis is rebuilt when the database is opened
+	testDB.Close()
+	testDB, err = Open(testPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	articleCol, err = testDB.Use("articles")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	check(articleCol, "open")
+
+	// And after a load
+	restoredDBPath := os.TempDir() + "/restoredAnalysisDB"
+	defer os.RemoveAll(restoredDBPath)
+
+	restoredDB, err := Open(restoredDBPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer restoredDB.Close()
+
+	err = restoredDB.Load(&backup)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	restoredCol, err := restoredDB.Use("articles")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	check(restoredCol, "load")
+
+	index, _ := restoredCol.GetBleveIndex("articles")
+	if index.analysis == nil || index.analysis.Analyzers["autocomplete"] == nil {
+		t.Errorf("the analysis must be saved in the configuration")
+	}
+}
+
+func TestIndexAnalysisDependencies(t *testing.T) {
+	// The exception tokenizer is named before the tokenizer it wraps
+	analysis := NewIndexAnalysis()
+	analysis.AddTokenizer("a_exception", map[string]interface{}{
+		"type":       exception.Name,
+		"tokenizer":  "z_words",
+		"exceptions": []interface{}{`[\w.]+@\w+\.\w+`},
+	})
+	analysis.AddTokenizer("z_words", map[string]interface{}{
+		"type":   regexp.Name,
+		"regexp": `\w+`,
+	})
+
+	indexMapping := bleve.NewIndexMapping()
+	if err := analysis.apply(indexMapping); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(indexMapping.CustomAnalysis.Tokenizers) != 2 {
+		t.Errorf("expected %d tokenizers but got %v", 2, indexMapping.CustomAnalysis.Tokenizers)
+	}
+
+	// Missing dependencies still fail
+	analysis.AddTokenizer("missing", map[string]interface{}{
+		"type":       exception.Name,
+		"tokenizer":  "unknown",
+		"exceptions": []interface{}{`\d+`},
+	})
+	if err := analysis.apply(bleve.NewIndexMapping()); err == nil {
+		t.Errorf("the unknown tokenizer must be reported")
+	}
+}
@@ -87,9 +87,9 @@ func TestMain(t *testing.T) {
 	// test get multi
 	ids := []string{testUserID, cloneTestUserID}
 	destinations := []interface{}{new(testUserStruct), new(testUserStruct)}
-	_, err = testCol.GetMulti(ids, destinations)
-	if err != nil {
-		t.Error(err)
+	_, errs, err := testCol.GetMulti(ids, destinations)
+	if err != nil || errs[0] != nil || errs[1] != nil {
+		t.Error(err, errs)
 		return
 	}
 	if !reflect.DeepEqual(testUser, destinations[0]) {
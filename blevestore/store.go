@@ -3,7 +3,7 @@ package blevestore
 import (
 	"context"
 	"fmt"
-	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger"
@@ -19,6 +19,11 @@ const (
 	Name = "gotinydb"
 )
 
+var (
+	// ErrReadOnly is returned when a write modifies a read only store
+	ErrReadOnly = fmt.Errorf("the store is read only")
+)
+
 type (
 	// Config defines the different configurations needed to make the store work
 	Config struct {
@@ -28,6 +33,9 @@ type (
 		db                  *badger.DB
 		writesChan          chan *transaction.Transaction
 		transactionsTimeOut time.Duration
+		// readOnly prevents any modification of the store.
+		// Writes which do not change the stored values are still accepted.
+		readOnly bool
 	}
 
 	// Store implements the blevestore interface
@@ -36,18 +44,15 @@ type (
 		name   string
 		config *Config
 		mo     store.MergeOperator
+		// bulk is set to 1 when the batches can be split into many transactions
+		bulk int32
 	}
 )
 
 // New returns a new store with the given options
 func New(mo store.MergeOperator, config map[string]interface{}) (store.KVStore, error) {
-	path, ok := config["path"].(string)
-	if !ok {
-		return nil, fmt.Errorf("must specify path")
-	}
-	if path == "" {
-		return nil, os.ErrInvalid
-	}
+	// The path is only used as a name because everything is saved into Badger
+	path, _ := config["path"].(string)
 
 	configPointer, ok := config["config"].(*Config)
 	if !ok {
@@ -78,6 +83,21 @@ func (bs *Store) Reader() (store.KVReader, error) {
 	}, nil
 }
 
+// SetBulk lets the batches which do not fit into one Badger transaction be written
+// into many transactions. It's meant for the indexing of existing documents
+// where a batch only needs to be completely written at the end.
+func (bs *Store) SetBulk(bulk bool) {
+	if bulk {
+		atomic.StoreInt32(&bs.bulk, 1)
+	} else {
+		atomic.StoreInt32(&bs.bulk, 0)
+	}
+}
+
+func (bs *Store) isBulk() bool {
+	return atomic.LoadInt32(&bs.bulk) == 1
+}
+
 // Writer returns a new writer interface
 func (bs *Store) Writer() (store.KVWriter, error) {
 	return &Writer{
@@ -107,16 +127,19 @@ func NewConfig(ctx context.Context, key [32]byte, prefix []byte, db *badger.DB,
 	}
 }
 
-// NewConfigMap returns the configuration as a map
-func NewConfigMap(ctx context.Context, path string, key [32]byte, prefix []byte, db *badger.DB, writeElementsChan chan *transaction.Transaction) map[string]interface{} {
+// NewConfigMap returns the configuration as a map.
+// If readOnly is true the store refuses every write which would modify the saved values.
+func NewConfigMap(ctx context.Context, key [32]byte, prefix []byte, db *badger.DB, writeElementsChan chan *transaction.Transaction, readOnly bool) map[string]interface{} {
+	config := NewConfig(
+		ctx,
+		key,
+		prefix,
+		db,
+		writeElementsChan,
+	)
+	config.readOnly = readOnly
+
 	return map[string]interface{}{
-		"path": path,
-		"config": NewConfig(
-			ctx,
-			key,
-			prefix,
-			db,
-			writeElementsChan,
-		),
+		"config": config,
 	}
 }
@@ -15,6 +15,7 @@
 package blevestore
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
@@ -89,10 +90,7 @@ func (w *Writer) ExecuteBatch(batch store.KVBatch) (err error) {
 		return fmt.Errorf("wrong type of batch")
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	tx := transaction.New(ctx)
+	tx := transaction.New(context.Background())
 
 	err = w.store.config.db.View(func(txn *badger.Txn) (err error) {
 		for k, mergeOps := range emulatedBatch.Merger.Merges {
@@ -117,6 +115,10 @@ func (w *Writer) ExecuteBatch(batch store.KVBatch) (err error) {
 				}
 			}
 
+			if w.store.config.readOnly {
+				return ErrReadOnly
+			}
+
 			mergedVal, fullMergeOk := w.store.mo.FullMerge(kb, existingVal, mergeOps)
 			if !fullMergeOk {
 				err = fmt.Errorf("merge operator returned failure")
@@ -129,6 +131,14 @@ func (w *Writer) ExecuteBatch(batch store.KVBatch) (err error) {
 		for _, op := range emulatedBatch.Ops {
 			storeID := w.store.buildID(op.K)
 
+			if w.store.config.readOnly {
+				err = w.checkUnchanged(txn, storeID, op.V)
+				if err != nil {
+					return
+				}
+				continue
+			}
+
 			if op.V != nil {
 				tx.AddOperation(transaction.NewOperation("", nil, storeID, op.V, false, true))
 			} else {
@@ -141,7 +151,67 @@ func (w *Writer) ExecuteBatch(batch store.KVBatch) (err error) {
 		return err
 	}
 
-	return w.write(tx)
+	// Nothing to write
+	if len(tx.Operations) == 0 {
+		return nil
+	}
+
+	return w.writeOperations(tx.Operations)
+}
+
+// writeOperations writes the operations as one transaction.
+// In bulk mode the operations which do not fit into one Badger transaction
+// are split in two halves written one after the other.
+func (w *Writer) writeOperations(ops []*transaction.Operation) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tx := transaction.New(ctx)
+	tx.Operations = ops
+
+	err := w.write(tx)
+	if err == badger.ErrTxnTooBig && len(ops) > 1 && w.store.isBulk() {
+		half := len(ops) / 2
+		err = w.writeOperations(ops[:half])
+		if err != nil {
+			return err
+		}
+		return w.writeOperations(ops[half:])
+	}
+
+	return err
+}
+
+// checkUnchanged returns ErrReadOnly if the given value is not the one already saved.
+// A nil value means that the key must not exist.
+func (w *Writer) checkUnchanged(txn *badger.Txn, storeID, value []byte) error {
+	item, err := txn.Get(storeID)
+	if err == badger.ErrKeyNotFound {
+		if value == nil {
+			return nil
+		}
+		return ErrReadOnly
+	} else if err != nil {
+		return err
+	}
+
+	var encryptedValue []byte
+	encryptedValue, err = item.ValueCopy(encryptedValue)
+	if err != nil {
+		return err
+	}
+
+	var existingVal []byte
+	existingVal, err = cipher.Decrypt(w.store.config.key, storeID, encryptedValue)
+	if err != nil {
+		return err
+	}
+
+	if value == nil || !bytes.Equal(existingVal, value) {
+		return ErrReadOnly
+	}
+
+	return nil
 }
 
 // Close is self explained
@@ -16,11 +16,13 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
 	"time"
 
+	"github.com/alexandrestein/gotinydb"
 	"github.com/spf13/cobra"
 
 	log "github.com/sirupsen/logrus"
@@ -67,7 +69,7 @@ var dumpCmd = &cobra.Command{
 
 The JSON format read the data and make it readable and exportable to other tools. (indexes are not included)
 
-In comparison the binary export is tries to keep everything (history, indexes files and all metas).`,
+In comparison the binary export is tries to keep everything (history, indexes and all metas).`,
 	Run: func(cmd *cobra.Command, args []string) {
 		db, err := openDB(cmd, true)
 		if err != nil {
@@ -104,12 +106,9 @@ In comparison the binary export is tries to keep everything (history, indexes fi
 			dumpCol.Records = []*Record{}
 			ret.Collections = append(ret.Collections, dumpCol)
 
-			iter := col.GetIterator()
-			for ; iter.Valid(); iter.Next() {
+			err = col.Scan(context.Background(), &gotinydb.ScanOptions{Ordered: true}, func(id string, content []byte) error {
 				rec := new(Record)
-				rec.ID = iter.GetID()
-
-				content := iter.GetBytes()
+				rec.ID = id
 
 				// Make sure the content is a JSON.
 				// Otherways it's send to RawContent.
@@ -121,8 +120,11 @@ In comparison the binary export is tries to keep everything (history, indexes fi
 				}
 
 				dumpCol.Records = append(dumpCol.Records, rec)
+				return nil
+			})
+			if err != nil {
+				log.Warningf("err reading collection %q: %s\n", colName, err.Error())
 			}
-			iter.Close()
 		}
 
 		if dumpJSONFile {
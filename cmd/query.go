@@ -0,0 +1,78 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/alexandrestein/gotinydb/sql"
+)
+
+var (
+	queryFormat string
+)
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query [statement]",
+	Short: "Runs a SQL SELECT statement against the database",
+	Long: `Runs a read only SQL SELECT statement against the database and prints the result.
+
+The collections are the tables and the columns are JSON paths of the documents, "_id" is the document ID:
+	gotinydb query -d ./db -k KEY "SELECT address.city, COUNT(*) FROM users GROUP BY address.city ORDER BY 2 DESC"
+
+The output can be a text table, CSV or JSON.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := openDB(cmd, true)
+		if err != nil {
+			return
+		}
+		defer db.Close()
+
+		result, err := sql.Query(db, strings.Join(args, " "))
+		if err != nil {
+			log.Errorln("Can't run the statement:", err.Error())
+			return
+		}
+
+		switch queryFormat {
+		case "table":
+			err = result.WriteTable(os.Stdout)
+		case "csv":
+			err = result.WriteCSV(os.Stdout)
+		case "json":
+			err = result.WriteJSON(os.Stdout)
+		default:
+			log.Errorf("Unknown output format %q\n", queryFormat)
+			return
+		}
+		if err != nil {
+			log.Errorln("Can't write the result:", err.Error())
+		}
+	},
+}
+
+func init() {
+	queryCmd.Flags().StringVarP(&queryFormat, "format", "f", "table", "Defines the output format (table|csv|json)")
+
+	rootCmd.AddCommand(queryCmd)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	verifyFix bool
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that every index matches the saved documents",
+	Long: `Open the database and check every index of every collection.
+It lists the documents which are saved but not indexed and the documents which are indexed but not saved.
+
+With --fix the database is opened in read/write mode (no other service running on it) and the indexes are repaired.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := openDB(cmd, !verifyFix)
+		if err != nil {
+			return
+		}
+		defer db.Close()
+
+		inconsistent := 0
+		for _, colName := range db.GetCollections() {
+			col, err := db.Use(colName)
+			if err != nil {
+				log.Warningf("err opening collection %q: %s\n", colName, err.Error())
+				continue
+			}
+
+			reports, err := col.VerifyIndexes()
+			if err != nil {
+				log.Errorf("Can't verify indexes of collection %q: %s\n", colName, err.Error())
+				continue
+			}
+
+			for _, report := range reports {
+				if report.Consistent() {
+					log.Infof("Index %q of collection %q is consistent\n", report.IndexName, colName)
+					continue
+				}
+
+				inconsistent++
+				log.Warningf("Index %q of collection %q has %d missing documents and %d orphan references\n", report.IndexName, colName, len(report.MissingFromIndex), len(report.MissingFromCollection))
+				for _, id := range report.MissingFromIndex {
+					log.Debugf("Document %q is not indexed\n", id)
+				}
+				for _, id := range report.MissingFromCollection {
+					log.Debugf("Document %q is indexed but not saved\n", id)
+				}
+
+				if !verifyFix {
+					continue
+				}
+
+				err = report.Fix()
+				if err != nil {
+					log.Errorf("Can't fix index %q of collection %q: %s\n", report.IndexName, colName, err.Error())
+					continue
+				}
+				log.Infof("Index %q of collection %q is fixed\n", report.IndexName, colName)
+			}
+		}
+
+		if inconsistent != 0 && !verifyFix {
+			log.Warningf("%d inconsistent indexes found, run with --fix to repair them\n", inconsistent)
+		}
+	},
+}
+
+func init() {
+	verifyCmd.Flags().BoolVar(&verifyFix, "fix", false, "Repairs the inconsistent indexes")
+
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -4,14 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	"os"
 	"reflect"
+	"runtime"
 	"sync"
 	"time"
 
 	"github.com/alexandrestein/gotinydb/blevestore"
-	"github.com/alexandrestein/gotinydb/cipher"
 	"github.com/alexandrestein/gotinydb/transaction"
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/index/upsidedown"
@@ -29,12 +27,24 @@ type (
 		db *DB
 		// BleveIndexes in public for marshalling reason and should never be used directly
 		bleveIndexes []*BleveIndex
+		// vectorIndexes holds the nearest neighbors indexes
+		vectorIndexes []*VectorIndex
+		// schema validates the documents before they are saved
+		schema     *Schema
+		schemaLock *sync.RWMutex
+
+		// indexesLock protects the indexes while they are replaced
+		indexesLock *sync.RWMutex
+		// indexesInBuild keeps track of the documents written while an index is rebuilt
+		indexesInBuild map[string]*indexBuild
 	}
 
 	collectionExport struct {
 		dbExportElement
 
-		BleveIndexes []*bleveIndexExport
+		BleveIndexes  []*bleveIndexExport
+		VectorIndexes []*vectorIndexExport `json:",omitempty"`
+		Schema        json.RawMessage      `json:",omitempty"`
 	}
 
 	// Batch is a simple struct to manage multiple write in one commit
@@ -49,7 +59,8 @@ type (
 		i                         int
 		pointer                   interface{}
 		asBytes, encryptedAsBytes []byte
-		err                       error
+		// fields is the projection of the document if any
+		fields *projectionNode
 	}
 )
 
@@ -58,6 +69,9 @@ func newCollection(name string) *Collection {
 		dbElement: dbElement{
 			name: name,
 		},
+		indexesLock:    new(sync.RWMutex),
+		indexesInBuild: map[string]*indexBuild{},
+		schemaLock:     new(sync.RWMutex),
 	}
 }
 
@@ -72,8 +86,8 @@ func (c *Collection) buildIndexPrefix() []byte {
 
 // GetName returns the collection name
 func (c *Collection) GetBleveIndexes() []string {
-	c.db.lock.RLock()
-	defer c.db.lock.RUnlock()
+	c.indexesLock.RLock()
+	defer c.indexesLock.RUnlock()
 
 	ret := make([]string, len(c.bleveIndexes))
 
@@ -86,7 +100,14 @@ func (c *Collection) GetBleveIndexes() []string {
 
 // SetBleveIndex adds a bleve index to the collection.
 // It build a new index with the given index mapping.
-func (c *Collection) SetBleveIndex(name string, documentMapping *mapping.DocumentMapping) (err error) {
+func (c *Collection) SetBleveIndex(name string, documentMapping *mapping.DocumentMapping) error {
+	return c.SetBleveIndexWithAnalysis(name, documentMapping, nil)
+}
+
+// SetBleveIndexWithAnalysis adds a bleve index to the collection like *Collection.SetBleveIndex
+// with custom analyzers, tokenizers, token filters or char filters.
+// The analysis components can be used by the field mappings of the given document mapping.
+func (c *Collection) SetBleveIndexWithAnalysis(name string, documentMapping *mapping.DocumentMapping, analysis *IndexAnalysis) (err error) {
 	// Use only the tow first bytes as index prefix.
 	// The prefix is used to confine indexes with a prefixes.
 	prefix := c.buildIndexPrefix()
@@ -98,6 +119,7 @@ func (c *Collection) SetBleveIndex(name string, documentMapping *mapping.Documen
 	index.name = name
 	index.collection = c
 	index.prefix = prefix
+	index.analysis = analysis
 	err = index.buildSignature(documentMapping)
 	if err != nil {
 		return err
@@ -115,95 +137,137 @@ func (c *Collection) SetBleveIndex(name string, documentMapping *mapping.Documen
 			return ErrHashCollision
 		}
 	}
+	for _, i := range c.GetVectorIndexes() {
+		if i == name {
+			return ErrNameAllreadyExists
+		}
+	}
 
-	// Bleve needs to save some parts on the drive.
-	// The path is based on a part of the collection hash and the index prefix.
-	colHash := blake2b.Sum256([]byte(c.name))
-	index.path = fmt.Sprintf("%x%s%x", colHash[:2], string(os.PathSeparator), indexHash[:2])
+	err = c.buildBleveIndex(index, documentMapping)
+	if err != nil {
+		return err
+	}
+
+	// Add the new index to the list of index of this collection
+	c.indexesLock.Lock()
+	c.bleveIndexes = append(c.bleveIndexes, index)
+	c.indexesLock.Unlock()
 
+	// Index all existing values
+	err = c.indexAllValues(index)
+	if err != nil {
+		return err
+	}
+
+	// Save the new settup
+	return c.db.saveConfig()
+}
+
+// SetBleveIndexFor adds a bleve index to the collection with the mapping built
+// by MappingFromStruct from the given sample.
+func (c *Collection) SetBleveIndexFor(name string, sample interface{}) error {
+	documentMapping, err := MappingFromStruct(sample)
+	if err != nil {
+		return err
+	}
+
+	return c.SetBleveIndex(name, documentMapping)
+}
+
+// buildBleveIndex initializes the Bleve index of the given index pointer.
+// The index prefix must be set before calling.
+func (c *Collection) buildBleveIndex(index *BleveIndex, documentMapping *mapping.DocumentMapping) error {
 	// Build the index and set the given document index as default
 	bleveMapping := bleve.NewIndexMapping()
 	bleveMapping.StoreDynamic = false
 	bleveMapping.IndexDynamic = true
 	bleveMapping.DocValuesDynamic = false
 
+	// The fields keep their store flag for the highlights and the returned fields
 	for _, fieldMapping := range documentMapping.Fields {
-		fieldMapping.Store = false
 		fieldMapping.Index = true
 	}
 	bleveMapping.DefaultMapping = documentMapping
 
-	// Build the configuration to use the local bleve storage and initialize the index
-	config := blevestore.NewConfigMap(c.db.ctx, index.path, c.db.privateKey, prefix, c.db.badger, c.db.writeChan)
-	index.bleveIndex, err = bleve.NewUsing(c.db.path+string(os.PathSeparator)+index.path, bleveMapping, upsidedown.Name, blevestore.Name, config)
+	err := index.analysis.apply(bleveMapping)
 	if err != nil {
-		return
+		return err
 	}
 
-	// Save the on drive bleve element into the index struct itself
-	index.bleveIndexAsBytes, err = index.indexZipper()
+	return c.openBleveIndex(index, bleveMapping)
+}
+
+// openBleveIndex opens the Bleve index with the given mapping.
+// Every part of the index is saved into Badger so nothing is written on the drive.
+// If the index already exists the saved values are used.
+func (c *Collection) openBleveIndex(index *BleveIndex, indexMapping mapping.IndexMapping) (err error) {
+	config := blevestore.NewConfigMap(c.db.ctx, c.db.privateKey, index.prefix, c.db.badger, c.db.writeChan, c.db.readOnly)
+	index.bleveIndex, err = bleve.NewUsing("", indexMapping, upsidedown.Name, blevestore.Name, config)
 	if err != nil {
 		return err
 	}
 
-	// Add the new index to the list of index of this collection
-	c.bleveIndexes = append(c.bleveIndexes, index)
+	index.bleveIndex.SetName(c.name + "/" + index.name)
+	return nil
+}
 
-	// Index all existing values
-	err = c.db.badger.View(func(txn *badger.Txn) error {
-		iter := txn.NewIterator(badger.DefaultIteratorOptions)
-		defer iter.Close()
+// indexAllValues indexes every document of the collection.
+// The index writes are split into many transactions if they are too big for one.
+// The documents are read by *Collection.Scan which takes its snapshot when it's called.
+func (c *Collection) indexAllValues(index *BleveIndex) error {
+	// The metadata are read only if the index maps them
+	var txn *badger.Txn
+	if index.indexesMeta() {
+		txn = c.db.badger.NewTransaction(false)
+		defer txn.Discard()
+	}
 
-		colPrefix := c.buildDBKey("")
-		for iter.Seek(colPrefix); iter.ValidForPrefix(colPrefix); iter.Next() {
-			item := iter.Item()
+	err := index.setBulk(true)
+	if err != nil {
+		return err
+	}
+	defer index.setBulk(false)
 
-			var err error
-			var itemAsEncryptedBytes []byte
-			itemAsEncryptedBytes, err = item.ValueCopy(itemAsEncryptedBytes)
-			if err != nil {
-				continue
-			}
+	batch := index.bleveIndex.NewBatch()
 
-			var clearBytes []byte
-			clearBytes, err = cipher.Decrypt(c.db.privateKey, item.Key(), itemAsEncryptedBytes)
+	err = c.Scan(c.db.ctx, nil, func(id string, clearBytes []byte) error {
+		content, err := c.contentToIndex(txn, index, id, clearBytes)
+		if err != nil {
+			return err
+		}
 
-			id := string(item.Key()[len(colPrefix):])
+		err = batch.Index(id, content)
+		if err != nil {
+			return err
+		}
 
-			content := c.fromValueBytesGetContentToIndex(clearBytes)
-			err = index.bleveIndex.Index(id, content)
+		// Limit the size of the batch
+		if batch.Size() >= 1000 {
+			err = index.bleveIndex.Batch(batch)
 			if err != nil {
 				return err
 			}
+			batch.Reset()
 		}
-
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
-	// Save the new settup
-	return c.db.saveConfig()
+	return index.bleveIndex.Batch(batch)
 }
 
 func (c *Collection) putSendToWriteAndWaitForResponse(tr *transaction.Transaction) (err error) {
-	select {
-	case c.db.writeChan <- tr:
-	case <-c.db.ctx.Done():
-		return c.db.ctx.Err()
-	}
-
-	select {
-	case err = <-tr.ResponseChan:
-	case <-tr.Ctx.Done():
-		err = tr.Ctx.Err()
-	}
-
-	return err
+	return c.db.sendTransaction(tr)
 }
 
 func (c *Collection) putLoopForIndexes(tr *transaction.Transaction) (err error) {
+	c.indexesLock.RLock()
+	defer c.indexesLock.RUnlock()
+
+	c.touchIndexesInBuild(tr)
+
 	for _, index := range c.bleveIndexes {
 		for _, op := range tr.Operations {
 			// If remove the content no need to index it
@@ -211,20 +275,36 @@ func (c *Collection) putLoopForIndexes(tr *transaction.Transaction) (err error)
 				continue
 			}
 
-			err = index.bleveIndex.Index(op.CollectionID, op.Content)
+			content := op.Content
+			if op.Meta != nil && index.indexesMeta() {
+				content = c.fromValueBytesGetContentToIndex(op.Value, op.Meta)
+			}
+
+			err = index.bleveIndex.Index(op.CollectionID, content)
 			if err != nil {
 				return err
 			}
 		}
 	}
 
+	for _, index := range c.vectorIndexes {
+		err = index.update(tr.Operations)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (c *Collection) put(id string, content interface{}, clean bool, ttl time.Duration) error {
+func (c *Collection) put(id string, content interface{}, clean bool, ttl time.Duration, options []WriteOption) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	if writer := buildWriteOptions(options).writer; writer != "" {
+		ctx = WithWriter(ctx, writer)
+	}
+
 	tr, err := c.NewBatch(ctx)
 	if err != nil {
 		return err
@@ -245,20 +325,20 @@ func (c *Collection) put(id string, content interface{}, clean bool, ttl time.Du
 }
 
 // PutWithCleanHistory set the content to the given id but clean all previous records of this id
-func (c *Collection) PutWithCleanHistory(id string, content interface{}) (err error) {
-	return c.put(id, content, true, 0)
+func (c *Collection) PutWithCleanHistory(id string, content interface{}, options ...WriteOption) (err error) {
+	return c.put(id, content, true, 0, options)
 }
 
 // Put sets a new element into the collection.
 // If the content match some of the indexes it will be indexed
-func (c *Collection) Put(id string, content interface{}) error {
-	return c.put(id, content, false, 0)
+func (c *Collection) Put(id string, content interface{}, options ...WriteOption) error {
+	return c.put(id, content, false, 0, options)
 }
 
 // PutWithTTL does the same as *Collection.Put but removes the content and
 // its ID after the given duration
-func (c *Collection) PutWithTTL(id string, content interface{}, ttl time.Duration) error {
-	return c.put(id, content, false, ttl)
+func (c *Collection) PutWithTTL(id string, content interface{}, ttl time.Duration, options ...WriteOption) error {
+	return c.put(id, content, false, ttl, options)
 }
 
 // NewBatch build a new write transaction to do all write operation in one commit
@@ -285,7 +365,16 @@ func (c *Collection) buildOperation(id string, content interface{}, delete, clea
 		bytes = jsonBytes
 	}
 
-	return transaction.NewOperation(id, content, c.buildDBKey(id), bytes, delete, cleanHistory), nil
+	if !delete {
+		err := c.validateDocument(id, bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	op := transaction.NewOperation(id, content, c.buildDBKey(id), bytes, delete, cleanHistory)
+	op.MetaKey = c.buildMetaKey(id)
+	return op, nil
 }
 
 // writeBatch gives a simple access to batch operations
@@ -298,7 +387,8 @@ func (c *Collection) writeBatch(b *Batch) (err error) {
 	return c.putLoopForIndexes(b.tr)
 }
 
-func (c *Collection) fromValueBytesGetContentToIndex(input []byte) interface{} {
+// fromValueBytesGetContentToIndex returns the document to index with the metadata as "_meta" if any
+func (c *Collection) fromValueBytesGetContentToIndex(input, meta []byte) interface{} {
 	var elem interface{}
 	decoder := json.NewDecoder(bytes.NewBuffer(input))
 
@@ -306,11 +396,57 @@ func (c *Collection) fromValueBytesGetContentToIndex(input []byte) interface{} {
 		return nil
 	}
 
-	var ret interface{}
-	typed := elem.(map[string]interface{})
-	ret = typed
+	// Only the objects have fields to index
+	typed, ok := elem.(map[string]interface{})
+	if !ok {
+		return nil
+	}
 
-	return ret
+	if meta != nil {
+		var metaAsMap map[string]interface{}
+		if json.Unmarshal(meta, &metaAsMap) == nil {
+			typed[metaFieldName] = metaAsMap
+		}
+	}
+
+	return typed
+}
+
+// readDocuments calls fn with the decrypted content of the given documents.
+// The content is nil for the documents which are not saved.
+func (c *Collection) readDocuments(txn *badger.Txn, ids []string, fn func(id string, clearBytes []byte) error) error {
+	for _, id := range ids {
+		dbKey := c.buildDBKey(id)
+		item, err := txn.Get(dbKey)
+		if err == badger.ErrKeyNotFound {
+			err = fn(id, nil)
+			if err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		var encryptedValue []byte
+		encryptedValue, err = item.ValueCopy(encryptedValue)
+		if err != nil {
+			return err
+		}
+
+		var clearBytes []byte
+		clearBytes, err = c.db.decryptData(dbKey, encryptedValue)
+		if err != nil {
+			return err
+		}
+
+		err = fn(id, clearBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (c *Collection) getEncrypted(txn *badger.Txn, caller *multiGetCaller) (err error) {
@@ -346,12 +482,13 @@ func (c *Collection) buildGetCaller(txn *badger.Txn, id string, dest interface{}
 	return
 }
 
-func (c *Collection) get(txn *badger.Txn, id string, dest interface{}) (contentAsBytes []byte, err error) {
+func (c *Collection) get(txn *badger.Txn, id string, dest interface{}, options ...GetOption) (contentAsBytes []byte, err error) {
 	var caller *multiGetCaller
 	caller, err = c.buildGetCaller(txn, id, dest)
 	if err != nil {
 		return nil, err
 	}
+	caller.fields = buildGetOptions(options).fields
 
 	err = c.getEncrypted(txn, caller)
 	if err != nil {
@@ -375,6 +512,13 @@ func (c *Collection) decryptAndUnmarshal(caller *multiGetCaller) (err error) {
 		return err
 	}
 
+	if caller.fields != nil {
+		contentAsBytes, err = projectJSON(contentAsBytes, caller.fields)
+		if err != nil {
+			return err
+		}
+	}
+
 	caller.asBytes = contentAsBytes
 
 	if caller.pointer == nil {
@@ -394,9 +538,10 @@ func (c *Collection) decryptAndUnmarshal(caller *multiGetCaller) (err error) {
 
 // Get returns the saved element. It fills up the given dest pointer if provided.
 // It always returns the content as a stream of bytes and an error if any.
-func (c *Collection) Get(id string, dest interface{}) (contentAsBytes []byte, err error) {
+// The options like Fields can limit the returned content.
+func (c *Collection) Get(id string, dest interface{}, options ...GetOption) (contentAsBytes []byte, err error) {
 	c.db.badger.View(func(txn *badger.Txn) error {
-		contentAsBytes, err = c.get(txn, id, dest)
+		contentAsBytes, err = c.get(txn, id, dest, options...)
 		return nil
 	})
 
@@ -407,66 +552,97 @@ func (c *Collection) Get(id string, dest interface{}) (contentAsBytes []byte, er
 	return
 }
 
-// GetMulti open one badger transaction and get all document concurrently
-func (c *Collection) GetMulti(ids []string, destinations []interface{}) (contentsAsBytes [][]byte, err error) {
-	if len(ids) != len(destinations) {
-		return nil, ErrGetMultiNotEqual
+// getMultiWorkers is the number of documents decrypted and decoded at the same time by *Collection.GetMulti
+var getMultiWorkers = runtime.NumCPU()
+
+// GetMulti reads all the documents with one read transaction. They are decrypted and decoded
+// concurrently by a bounded number of workers.
+// The contents and the errors are in the order of the ids and the destinations can be nil.
+// A document which can't be read has a nil content and its error in errs, ErrNotFound if it's missing,
+// so the others are returned anyway. err is only set if the batch itself fails.
+func (c *Collection) GetMulti(ids []string, destinations []interface{}, options ...GetOption) (contentsAsBytes [][]byte, errs []error, err error) {
+	if destinations != nil && len(ids) != len(destinations) {
+		return nil, nil, ErrGetMultiNotEqual
 	}
 
+	fields := buildGetOptions(options).fields
+
 	contentsAsBytes = make([][]byte, len(ids))
+	errs = make([]error, len(ids))
 
-	var wg sync.WaitGroup
-	wg.Add(len(ids))
+	callers := make(chan *multiGetCaller, len(ids))
 
-	respChan := make(chan *multiGetCaller, len(ids))
+	var wg sync.WaitGroup
+	for worker := 0; worker < getMultiWorkers && worker < len(ids); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for caller := range callers {
+				errs[caller.i] = c.decryptAndUnmarshal(caller)
+				if errs[caller.i] == nil {
+					contentsAsBytes[caller.i] = caller.asBytes
+				}
+			}
+		}()
+	}
 
-	c.db.badger.View(func(txn *badger.Txn) error {
+	err = c.db.badger.View(func(txn *badger.Txn) error {
 		for i, id := range ids {
-			var caller *multiGetCaller
-			caller, err = c.buildGetCaller(txn, id, destinations[i])
+			var dest interface{}
+			if destinations != nil {
+				dest = destinations[i]
+			}
+
+			caller, err := c.buildGetCaller(txn, id, dest)
 			if err != nil {
-				caller.err = err
-				return err
+				errs[i] = err
+				continue
 			}
+			caller.i = i
+			caller.fields = fields
 
 			err = c.getEncrypted(txn, caller)
-			if err != nil {
-				caller.err = err
+			if err == badger.ErrKeyNotFound {
+				errs[i] = ErrNotFound
+				continue
+			} else if err != nil {
 				return err
 			}
 
-			go func() {
-				c.decryptAndUnmarshal(caller)
-				if caller.err != nil {
-					caller.err = err
-				}
-				respChan <- caller
-			}()
+			callers <- caller
 		}
 		return nil
 	})
 
-	go func() {
-		for {
-			caller := <-respChan
-			if caller.err != nil {
-				err = caller.err
-				return
-			}
+	close(callers)
+	wg.Wait()
 
-			contentsAsBytes[caller.i] = caller.asBytes
+	if err != nil {
+		return nil, nil, err
+	}
 
-			wg.Done()
-		}
-	}()
+	return contentsAsBytes, errs, nil
+}
 
+// GetMultiMap reads the documents like *Collection.GetMulti and returns the found ones by ID.
+// The missing documents are not part of the map.
+func (c *Collection) GetMultiMap(ids []string, options ...GetOption) (map[string][]byte, error) {
+	contentsAsBytes, errs, err := c.GetMulti(ids, nil, options...)
 	if err != nil {
 		return nil, err
 	}
 
-	wg.Wait()
+	ret := make(map[string][]byte, len(ids))
+	for i, id := range ids {
+		if errs[i] == ErrNotFound {
+			continue
+		} else if errs[i] != nil {
+			return nil, errs[i]
+		}
+		ret[id] = contentsAsBytes[i]
+	}
 
-	return
+	return ret, nil
 }
 
 // Delete deletes all references of the given id.
@@ -475,31 +651,34 @@ func (c *Collection) Delete(id string) (err error) {
 	defer cancel()
 
 	tr := transaction.New(ctx)
-	tr.AddOperation(
-		transaction.NewOperation(id, nil, c.buildDBKey(id), nil, true, false),
-	)
-
-	// Send to the write channel
-	select {
-	case c.db.writeChan <- tr:
-	case <-c.db.ctx.Done():
-		return c.db.ctx.Err()
-	}
+	op := transaction.NewOperation(id, nil, c.buildDBKey(id), nil, true, false)
+	op.MetaKey = c.buildMetaKey(id)
+	tr.AddOperation(op)
 
-	// Wait for response from the write routine
-	select {
-	case err = <-tr.ResponseChan:
-	case <-tr.Ctx.Done():
-		err = tr.Ctx.Err()
+	// The indexes are not touched if the write failed or the database is closed
+	err = c.db.sendTransaction(tr)
+	if err != nil {
+		return err
 	}
 
 	// Deletes from index
+	c.indexesLock.RLock()
+	c.touchIndexesInBuild(tr)
 	for _, index := range c.bleveIndexes {
 		err = index.bleveIndex.Delete(id)
 		if err != nil {
+			c.indexesLock.RUnlock()
+			return err
+		}
+	}
+	for _, index := range c.vectorIndexes {
+		err = index.update(tr.Operations)
+		if err != nil {
+			c.indexesLock.RUnlock()
 			return err
 		}
 	}
+	c.indexesLock.RUnlock()
 
 	c.deleteRelatedFiles(id)
 
@@ -524,14 +703,11 @@ func (c *Collection) buildDBKey(id string) []byte {
 	return append(key, []byte(id)...)
 }
 
-// buildToJustBigDBPrefix this is used when iterating values from the last one.
-// It gives the smalles to big prefix for the collection.
-func (c *Collection) buildJustTooBigDBPrefix() []byte {
-	return append(c.prefix, prefixCollectionsData+1)
-}
-
 // GetBleveIndex gives an  easy way to interact directly with bleve
 func (c *Collection) GetBleveIndex(name string) (*BleveIndex, error) {
+	c.indexesLock.RLock()
+	defer c.indexesLock.RUnlock()
+
 	for _, bi := range c.bleveIndexes {
 		if bi.name == name {
 			return bi, nil
@@ -540,8 +716,24 @@ func (c *Collection) GetBleveIndex(name string) (*BleveIndex, error) {
 	return nil, ErrIndexNotFound
 }
 
+// useBleveIndex returns the index like *Collection.GetBleveIndex and registers a reader.
+// The index is not closed by a rebuild until the returned function is called.
+func (c *Collection) useBleveIndex(name string) (*BleveIndex, func(), error) {
+	c.indexesLock.RLock()
+	defer c.indexesLock.RUnlock()
+
+	for _, bi := range c.bleveIndexes {
+		if bi.name == name {
+			bi.readers.Add(1)
+			return bi, bi.readers.Done, nil
+		}
+	}
+	return nil, nil, ErrIndexNotFound
+}
+
 // Search make a search with the default bleve search request bleve.NewSearchRequest()
-// and returns a local SearchResult pointer
+// and returns a local SearchResult pointer.
+// It returns ErrNotFound if nothing matches, use *Collection.SearchPage to get empty results.
 func (c *Collection) Search(indexName string, query query.Query) (*SearchResult, error) {
 	searchRequest := bleve.NewSearchRequest(query)
 
@@ -550,22 +742,34 @@ func (c *Collection) Search(indexName string, query query.Query) (*SearchResult,
 
 // SearchWithOptions does the same as *Collection.Search but you provide the searchRequest
 func (c *Collection) SearchWithOptions(indexName string, searchRequest *bleve.SearchRequest) (*SearchResult, error) {
+	ret, err := c.search(indexName, searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.BleveSearchResult.Hits.Len() == 0 {
+		return nil, ErrNotFound
+	}
+
+	return ret, nil
+}
+
+// search runs the search request on the given index.
+// Unlike *Collection.SearchWithOptions the result can be empty.
+func (c *Collection) search(indexName string, searchRequest *bleve.SearchRequest) (*SearchResult, error) {
 	ret := new(SearchResult)
 
-	index, err := c.GetBleveIndex(indexName)
+	index, release, err := c.useBleveIndex(indexName)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
 	ret.BleveSearchResult, err = index.bleveIndex.Search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
 
-	if ret.BleveSearchResult.Hits.Len() == 0 {
-		return nil, ErrNotFound
-	}
-
 	ret.c = c
 
 	return ret, nil
@@ -619,8 +823,15 @@ func (c *Collection) History(id string, limit int) (valuesAsBytes [][]byte, err
 	})
 }
 
-// DeleteIndex delete the index and all references
-func (c *Collection) DeleteIndex(name string) {
+// DeleteIndex delete the index and all references.
+// It returns ErrIndexInBuild if the index is rebuilt.
+func (c *Collection) DeleteIndex(name string) error {
+	c.indexesLock.Lock()
+	if _, inBuild := c.indexesInBuild[name]; inBuild {
+		c.indexesLock.Unlock()
+		return ErrIndexInBuild
+	}
+
 	var index *BleveIndex
 	for i, tmpIndex := range c.bleveIndexes {
 		if tmpIndex.name == name {
@@ -634,46 +845,33 @@ func (c *Collection) DeleteIndex(name string) {
 		}
 	}
 
-	index.close()
-	index.delete()
-
-	c.db.badger.DropPrefix(index.prefix)
-}
-
-func (c *Collection) getIterator(reverted bool) *CollectionIterator {
-	iterOptions := badger.DefaultIteratorOptions
-	iterOptions.Reverse = reverted
-
-	txn := c.db.badger.NewTransaction(false)
-	badgerIter := txn.NewIterator(iterOptions)
+	if index == nil {
+		defer c.indexesLock.Unlock()
+		return c.deleteVectorIndex(name)
+	}
+	c.indexesLock.Unlock()
 
-	tmpPrefix := c.buildDBKey("")
-	prefix := make([]byte, len(tmpPrefix))
-	copy(prefix, tmpPrefix)
+	// Removes the index once the searches started before are done
+	index.readers.Wait()
+	index.close()
 
-	baseIterator := &baseIterator{
-		txn:        txn,
-		badgerIter: badgerIter,
+	err := c.db.deletePrefix(index.prefix)
+	if err != nil {
+		return err
 	}
 
-	return &CollectionIterator{
-		baseIterator: baseIterator,
-		c:            c,
-		colPrefix:    prefix,
-	}
+	return c.db.saveConfig()
 }
 
 // GetIterator provides an easy way to list elements
 func (c *Collection) GetIterator() *CollectionIterator {
-	iter := c.getIterator(false)
-	iter.badgerIter.Seek(iter.colPrefix)
+	iter, _ := c.NewIterator(nil)
 	return iter
 }
 
 // GetRevertedIterator does same as above but work in the opposite way
 func (c *Collection) GetRevertedIterator() *CollectionIterator {
-	iter := c.getIterator(true)
-	iter.badgerIter.Seek(c.buildJustTooBigDBPrefix())
+	iter, _ := c.NewIterator(&IterOptions{Reverse: true})
 	return iter
 }
 
@@ -684,6 +882,7 @@ func (b *Batch) addOperation(id string, content interface{}, delete, cleanHistor
 		return err
 	}
 
+	op.Writer = writerFromContext(b.tr.Ctx)
 	b.tr.AddOperation(op)
 
 	return nil
@@ -721,7 +920,8 @@ func (b *Batch) Delete(id string) error {
 	return b.addOperation(id, nil, true, true)
 }
 
-// Write execute the batch
+// Write execute the batch.
+// The batch is written as one Badger transaction, badger.ErrTxnTooBig is returned if it does not fit into one.
 func (b *Batch) Write() error {
 	return b.c.writeBatch(b)
 }
@@ -0,0 +1,74 @@
+package gotinydb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestGetMulti(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	batch, _ := testCol.NewBatch(context.Background())
+	ids := []string{}
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("%03d", i)
+		batch.Put(id, map[string]int{"i": i})
+		ids = append(ids, id)
+	}
+	err = batch.Write()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The order is not the ID order and some documents are missing
+	ids = append([]string{"missing", "050", "", testUserID}, ids...)
+
+	destinations := make([]interface{}, len(ids))
+	for i := range destinations {
+		destinations[i] = new(struct{ I int })
+	}
+	// A document which can't be decoded does not fail the others
+	var wrongType int
+	destinations[3] = &wrongType
+
+	contents, errs, err := testCol.GetMulti(ids, destinations)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(contents) != len(ids) || len(errs) != len(ids) {
+		t.Errorf("expected %d results but got %d contents and %d errors", len(ids), len(contents), len(errs))
+		return
+	}
+	if errs[0] != ErrNotFound || contents[0] != nil || errs[2] != ErrEmptyID || errs[3] == nil || contents[3] != nil {
+		t.Errorf("unexpected errors %v", errs[:4])
+	}
+	for i, id := range ids[4:] {
+		expected := fmt.Sprintf(`{"i":%d}`, i)
+		if errs[i+4] != nil || string(contents[i+4]) != expected || destinations[i+4].(*struct{ I int }).I != i {
+			t.Errorf("%s: expected %s but got %s %v", id, expected, contents[i+4], errs[i+4])
+		}
+	}
+	if destinations[1].(*struct{ I int }).I != 50 {
+		t.Errorf("the destination is not filled up %v", destinations[1])
+	}
+
+	if _, _, err = testCol.GetMulti(ids, destinations[1:]); err != ErrGetMultiNotEqual {
+		t.Errorf("expected %v but got %v", ErrGetMultiNotEqual, err)
+	}
+
+	contentsMap, err := testCol.GetMultiMap([]string{"001", "missing", testUserID}, Fields("name"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(contentsMap) != 2 || string(contentsMap["001"]) != `{}` || string(contentsMap[testUserID]) != `{"name":"toto"}` {
+		t.Errorf("unexpected contents %v", contentsMap)
+	}
+}
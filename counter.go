@@ -0,0 +1,151 @@
+package gotinydb
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+	"golang.org/x/crypto/blake2b"
+)
+
+type (
+	// Counter is a persistent integer updated by the write loop.
+	// The concurrent updates never conflict and are never lost.
+	Counter struct {
+		db    *DB
+		name  string
+		dbKey []byte
+	}
+)
+
+// Counter returns the counter with the given name. A new counter is zero.
+func (d *DB) Counter(name string) *Counter {
+	hash := blake2b.Sum256([]byte(name))
+
+	return &Counter{
+		db:    d,
+		name:  name,
+		dbKey: append([]byte{prefixCounters}, hash[:]...),
+	}
+}
+
+// Name returns the name of the counter
+func (c *Counter) Name() string {
+	return c.name
+}
+
+// Get returns the value of the counter
+func (c *Counter) Get() (int64, error) {
+	asBytes, err := c.db.getClearValue(c.dbKey)
+	if err == ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(string(asBytes), 10, 64)
+}
+
+// Increment adds one to the counter and returns the new value
+func (c *Counter) Increment() (int64, error) {
+	return c.Add(1)
+}
+
+// Add adds the delta to the counter and returns the new value.
+// The addition is done by the write loop with the latest value.
+func (c *Counter) Add(delta int64) (value int64, err error) {
+	op := transaction.NewOperation("", nil, c.dbKey, nil, false, false)
+	op.Upsert = true
+	op.Patch = func(current []byte) ([]byte, error) {
+		value = 0
+		if current != nil {
+			var err error
+			value, err = strconv.ParseInt(string(current), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		value += delta
+		return []byte(strconv.FormatInt(value, 10)), nil
+	}
+
+	err = c.db.write(op)
+	if err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// Reset sets the counter to zero
+func (c *Counter) Reset() error {
+	return c.db.write(transaction.NewOperation("", nil, c.dbKey, nil, true, false))
+}
+
+// Increment adds the delta to the number at the JSON path of the document and returns the new value.
+// The path is made of the field names separated by dots like "stats.views".
+// The missing document, objects and number are created with zero before the addition.
+// Like *Collection.Patch the addition is done by the write loop with the latest version of the document
+// so the concurrent increments never conflict. The indexes mapping the path are updated.
+// ErrInvalidIncrement is returned if the path leads to something else than a number.
+func (c *Collection) Increment(id, jsonPath string, delta float64, options ...WriteOption) (value float64, err error) {
+	path := strings.Split(jsonPath, ".")
+	if jsonPath == "" {
+		return 0, ErrInvalidIncrement
+	}
+
+	err = c.patch(id, true, options, func(document interface{}) (interface{}, error) {
+		object, ok := document.(map[string]interface{})
+		if !ok {
+			return nil, ErrInvalidIncrement
+		}
+
+		parent := object
+		for _, key := range path[:len(path)-1] {
+			child, found := parent[key]
+			if !found || child == nil {
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+
+			parent, ok = child.(map[string]interface{})
+			if !ok {
+				return nil, ErrInvalidIncrement
+			}
+		}
+
+		key := path[len(path)-1]
+		var number json.Number
+		if current, found := parent[key]; found && current != nil {
+			number, ok = current.(json.Number)
+			if !ok {
+				return nil, ErrInvalidIncrement
+			}
+		}
+
+		number, value = addToNumber(number, delta)
+		parent[key] = number
+		return object, nil
+	})
+
+	return value, err
+}
+
+// addToNumber adds the delta to the JSON number. The integers stay integers if the delta is an integer.
+func addToNumber(number json.Number, delta float64) (json.Number, float64) {
+	if number == "" {
+		number = "0"
+	}
+
+	if i, err := number.Int64(); err == nil && delta == math.Trunc(delta) && math.Abs(delta) < 1<<53 {
+		i += int64(delta)
+		return json.Number(strconv.FormatInt(i, 10)), float64(i)
+	}
+
+	f, _ := number.Float64()
+	f += delta
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), f
+}
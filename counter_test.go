@@ -0,0 +1,118 @@
+package gotinydb
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestCounter(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	counter := testDB.Counter("page views")
+	if value, err := counter.Get(); err != nil || value != 0 {
+		t.Errorf("a new counter must be zero but got %d %v", value, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := counter.Increment(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, err := counter.Get(); err != nil || value != 5000 {
+		t.Errorf("expected %d but got %d %v", 5000, value, err)
+	}
+	if value, err := counter.Add(-10); err != nil || value != 4990 {
+		t.Errorf("expected %d but got %d %v", 4990, value, err)
+	}
+	if value, _ := testDB.Counter("other").Get(); value != 0 {
+		t.Errorf("the counters must be independent but got %d", value)
+	}
+
+	if err = counter.Reset(); err != nil {
+		t.Error(err)
+	}
+	if value, _ := counter.Get(); value != 0 {
+		t.Errorf("expected %d but got %d", 0, value)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := testCol.Increment(testUserID, "stats.views", 1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	document := struct {
+		Name  string `json:"name"`
+		Stats struct {
+			Views int `json:"views"`
+		} `json:"stats"`
+	}{}
+	if _, err = testCol.Get(testUserID, &document); err != nil || document.Stats.Views != 400 || document.Name != testUser.Name {
+		t.Errorf("unexpected document %+v %v", document, err)
+	}
+
+	// The indexes are updated
+	query := bleve.NewNumericRangeQuery(floatPointer(400), floatPointer(401))
+	query.SetField("stats.views")
+	result, err := testCol.Search("all", query)
+	if err != nil || result.BleveSearchResult.Total != 1 || result.BleveSearchResult.Hits[0].ID != testUserID {
+		t.Errorf("the incremented document is not found %v", err)
+	}
+
+	// Float values and missing documents
+	if value, err := testCol.Increment("new document", "score", 0.5); err != nil || value != 0.5 {
+		t.Errorf("expected %v but got %v %v", 0.5, value, err)
+	}
+	if value, err := testCol.Increment("new document", "score", 2); err != nil || value != 2.5 {
+		t.Errorf("expected %v but got %v %v", 2.5, value, err)
+	}
+	if content, _ := testCol.Get("new document", nil); string(content) != `{"score":2.5}` {
+		t.Errorf("unexpected document %s", content)
+	}
+
+	for _, path := range []string{"name", "name.first", ""} {
+		if _, err = testCol.Increment(testUserID, path, 1); err != ErrInvalidIncrement {
+			t.Errorf("%q: expected %v but got %v", path, ErrInvalidIncrement, err)
+		}
+	}
+	if _, err = testCol.Increment("", "views", 1); err != ErrEmptyID {
+		t.Errorf("expected %v but got %v", ErrEmptyID, err)
+	}
+}
+
+func floatPointer(f float64) *float64 {
+	return &f
+}
@@ -20,16 +20,13 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"os"
 	"reflect"
 	"runtime"
 	"sync"
 	"time"
 
-	"github.com/alexandrestein/gotinydb/blevestore"
 	"github.com/alexandrestein/gotinydb/cipher"
 	"github.com/alexandrestein/gotinydb/transaction"
-	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/mapping"
 	"github.com/dgraph-io/badger"
 	"github.com/dgraph-io/badger/pb"
@@ -38,6 +35,71 @@ import (
 	_ "github.com/blevesearch/bleve/analysis/analyzer/keyword"
 	_ "github.com/blevesearch/bleve/analysis/analyzer/simple"
 	_ "github.com/blevesearch/bleve/analysis/analyzer/standard"
+
+	// Components available for the custom analysis
+	_ "github.com/blevesearch/bleve/analysis/analyzer/custom"
+	_ "github.com/blevesearch/bleve/analysis/analyzer/web"
+	_ "github.com/blevesearch/bleve/analysis/char/asciifolding"
+	_ "github.com/blevesearch/bleve/analysis/char/html"
+	_ "github.com/blevesearch/bleve/analysis/char/regexp"
+	_ "github.com/blevesearch/bleve/analysis/char/zerowidthnonjoiner"
+	_ "github.com/blevesearch/bleve/analysis/token/apostrophe"
+	_ "github.com/blevesearch/bleve/analysis/token/camelcase"
+	_ "github.com/blevesearch/bleve/analysis/token/compound"
+	_ "github.com/blevesearch/bleve/analysis/token/edgengram"
+	_ "github.com/blevesearch/bleve/analysis/token/elision"
+	_ "github.com/blevesearch/bleve/analysis/token/keyword"
+	_ "github.com/blevesearch/bleve/analysis/token/length"
+	_ "github.com/blevesearch/bleve/analysis/token/lowercase"
+	_ "github.com/blevesearch/bleve/analysis/token/ngram"
+	_ "github.com/blevesearch/bleve/analysis/token/porter"
+	_ "github.com/blevesearch/bleve/analysis/token/reverse"
+	_ "github.com/blevesearch/bleve/analysis/token/shingle"
+	_ "github.com/blevesearch/bleve/analysis/token/stop"
+	_ "github.com/blevesearch/bleve/analysis/token/truncate"
+	_ "github.com/blevesearch/bleve/analysis/token/unicodenorm"
+	_ "github.com/blevesearch/bleve/analysis/token/unique"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/character"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/exception"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/letter"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/regexp"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/single"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/web"
+	_ "github.com/blevesearch/bleve/analysis/tokenizer/whitespace"
+	_ "github.com/blevesearch/bleve/analysis/tokenmap"
+
+	// Language analyzers
+	_ "github.com/blevesearch/bleve/analysis/lang/ar"
+	_ "github.com/blevesearch/bleve/analysis/lang/bg"
+	_ "github.com/blevesearch/bleve/analysis/lang/ca"
+	_ "github.com/blevesearch/bleve/analysis/lang/cjk"
+	_ "github.com/blevesearch/bleve/analysis/lang/ckb"
+	_ "github.com/blevesearch/bleve/analysis/lang/cs"
+	_ "github.com/blevesearch/bleve/analysis/lang/da"
+	_ "github.com/blevesearch/bleve/analysis/lang/de"
+	_ "github.com/blevesearch/bleve/analysis/lang/el"
+	_ "github.com/blevesearch/bleve/analysis/lang/en"
+	_ "github.com/blevesearch/bleve/analysis/lang/es"
+	_ "github.com/blevesearch/bleve/analysis/lang/eu"
+	_ "github.com/blevesearch/bleve/analysis/lang/fa"
+	_ "github.com/blevesearch/bleve/analysis/lang/fi"
+	_ "github.com/blevesearch/bleve/analysis/lang/fr"
+	_ "github.com/blevesearch/bleve/analysis/lang/ga"
+	_ "github.com/blevesearch/bleve/analysis/lang/gl"
+	_ "github.com/blevesearch/bleve/analysis/lang/hi"
+	_ "github.com/blevesearch/bleve/analysis/lang/hu"
+	_ "github.com/blevesearch/bleve/analysis/lang/hy"
+	_ "github.com/blevesearch/bleve/analysis/lang/id"
+	_ "github.com/blevesearch/bleve/analysis/lang/in"
+	_ "github.com/blevesearch/bleve/analysis/lang/it"
+	_ "github.com/blevesearch/bleve/analysis/lang/nl"
+	_ "github.com/blevesearch/bleve/analysis/lang/no"
+	_ "github.com/blevesearch/bleve/analysis/lang/pt"
+	_ "github.com/blevesearch/bleve/analysis/lang/ro"
+	_ "github.com/blevesearch/bleve/analysis/lang/ru"
+	_ "github.com/blevesearch/bleve/analysis/lang/sv"
+	_ "github.com/blevesearch/bleve/analysis/lang/tr"
 )
 
 type (
@@ -55,8 +117,9 @@ type (
 		// This is the primary key used to derive every records.
 		privateKey [32]byte
 
-		path   string
-		badger *badger.DB
+		path     string
+		readOnly bool
+		badger   *badger.DB
 		// Collection is public for marshaling reason and should never be used.
 		// It contains the collections pointers used to manage the documents.
 		collections []*Collection
@@ -64,7 +127,17 @@ type (
 		// FileStore provides all accessibility to the file storage facilities
 		fileStore *FileStore
 
+		// queues keeps the queues by name to share their locks
+		queues map[string]*Queue
+		// timeSeries keeps the time series by name for the background rollups
+		timeSeries map[string]*TimeSeries
+
+		// logger reports the errors of the background loops
+		logger badger.Logger
+
 		writeChan chan *transaction.Transaction
+		// loops waits for the background loops to return before closing Badger
+		loops sync.WaitGroup
 	}
 
 	dbExport struct {
@@ -114,12 +187,17 @@ func open(path string, configKey [32]byte, badgerOptions *badger.Options) (db *D
 	db = new(DB)
 	db.path = path
 	db.configKey = configKey
+	if badgerOptions != nil {
+		db.readOnly = badgerOptions.ReadOnly
+	}
 
 	db.lock = new(sync.RWMutex)
 
 	db.ctx, db.cancel = context.WithCancel(context.Background())
 
 	db.fileStore = &FileStore{db}
+	db.queues = map[string]*Queue{}
+	db.timeSeries = map[string]*TimeSeries{}
 
 	if badgerOptions == nil {
 		tmpOption := badger.DefaultOptions(path)
@@ -134,6 +212,7 @@ func open(path string, configKey [32]byte, badgerOptions *badger.Options) (db *D
 
 		badgerOptions = &tmpOption
 	}
+	db.logger = badgerOptions.Logger
 
 	db.writeChan = make(chan *transaction.Transaction, 1000)
 
@@ -157,9 +236,18 @@ func open(path string, configKey [32]byte, badgerOptions *badger.Options) (db *D
 }
 
 func (d *DB) startBackgroundLoops() {
-	go d.goRoutineLoopForWrites()
-	go d.goRoutineLoopForGC()
-	go d.goWatchForTTLToClean()
+	for _, loop := range []func(){
+		d.goRoutineLoopForWrites,
+		d.goRoutineLoopForGC,
+		d.goWatchForTTLToClean,
+		d.goRoutineLoopForRollups,
+	} {
+		d.loops.Add(1)
+		go func(loop func()) {
+			defer d.loops.Done()
+			loop()
+		}(loop)
+	}
 }
 
 // GetCollections returns a slice of the collections name
@@ -216,6 +304,20 @@ func (d *DB) Use(colName string) (col *Collection, err error) {
 	return
 }
 
+// getCollection returns an existing collection without creating it
+func (d *DB) getCollection(colName string) (*Collection, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	for _, col := range d.collections {
+		if col.name == colName {
+			return col, nil
+		}
+	}
+
+	return nil, ErrCollectionNotFound
+}
+
 // UpdateKey updates the database master key
 func (d *DB) UpdateKey(newKey [32]byte) (err error) {
 	d.configKey = newKey
@@ -223,9 +325,23 @@ func (d *DB) UpdateKey(newKey [32]byte) (err error) {
 	return d.saveConfig()
 }
 
+// SetLogger sets the logger of the errors which have no caller to return to,
+// like the failed time series rollups. By default it's the logger of the Badger
+// options which drops everything when the database is opened with Open.
+func (d *DB) SetLogger(logger badger.Logger) {
+	if logger == nil {
+		logger = new(fakeLogger)
+	}
+
+	d.lock.Lock()
+	d.logger = logger
+	d.lock.Unlock()
+}
+
 // Close closes the database and all subcomposants. It returns the error if any
 func (d *DB) Close() (err error) {
 	d.cancel()
+	d.loops.Wait()
 
 	// In case of any error
 	defer func() {
@@ -411,17 +527,6 @@ func (d *DB) load(r io.Reader) error {
 		return err
 	}
 
-	for _, col := range d.collections {
-		col.db = d
-		for _, index := range col.bleveIndexes {
-			index.collection = col
-			err := index.indexUnzipper()
-			if err != nil {
-				return err
-			}
-		}
-	}
-
 	return d.loadCollections()
 }
 
@@ -522,37 +627,190 @@ func (d *DB) goRoutineLoopForWrites() {
 		default:
 		}
 
-		err := badgerStore.Update(func(txn *badger.Txn) error {
-			for _, transaction := range waitingWrites {
-				for _, op := range transaction.Operations {
-					var err error
-					if op.Delete {
-						err = txn.Delete(op.DBKey)
-					} else {
-						if op.CleanHistory {
-							entry := badger.NewEntry(op.DBKey, cipher.Encrypt(d.privateKey, op.DBKey, op.Value))
-							entry.WithDiscard()
-							err = txn.SetEntry(entry)
-						} else {
-							err = txn.Set(op.DBKey, cipher.Encrypt(d.privateKey, op.DBKey, op.Value))
-						}
-					}
-
-					// Returns the write error to the caller
-					if err != nil {
-						go d.nonBlockingResponseChan(localCtx, transaction, err)
-					}
+		// Every transaction is written entirely or not at all
+		written := []*transaction.Transaction{}
+		txn := badgerStore.NewTransaction(true)
+		for _, tr := range waitingWrites {
+			err := d.writeTransaction(txn, tr, false)
+
+			// The previous transactions are committed and the transaction is tried alone
+			if err == badger.ErrTxnTooBig && len(written) > 0 {
+				txn.Discard()
+				d.commitTransactions(localCtx, badgerStore, written)
+				written = nil
 
+				txn = badgerStore.NewTransaction(true)
+				err = d.writeTransaction(txn, tr, false)
+			}
+
+			if err == nil {
+				written = append(written, tr)
+				continue
+			}
+
+			// Badger has no savepoint. The partial writes of the failed transaction are discarded
+			// with the Badger transaction and the previous transactions are written again.
+			txn.Discard()
+			go d.nonBlockingResponseChan(localCtx, tr, err)
+
+			txn, err = d.replayTransactions(badgerStore, written)
+			if err != nil {
+				for _, writtenTr := range written {
+					go d.nonBlockingResponseChan(localCtx, writtenTr, err)
 				}
+				written = nil
+				txn = badgerStore.NewTransaction(true)
 			}
-			return nil
-		})
+		}
+		err := txn.Commit()
 
 		// Dispatch the commit response to all callers
-		for _, op := range waitingWrites {
-			go d.nonBlockingResponseChan(localCtx, op, err)
+		for _, tr := range written {
+			go d.nonBlockingResponseChan(localCtx, tr, err)
+		}
+	}
+}
+
+// writeTransaction adds all the operations of the transaction to the Badger transaction.
+// When the transaction is replayed the conditions and the patches are not called again
+// and the values they produced are written.
+func (d *DB) writeTransaction(txn *badger.Txn, tr *transaction.Transaction, replay bool) error {
+	for _, op := range tr.Operations {
+		err := d.writeOperation(txn, op, replay)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// replayTransactions writes the transactions into a new Badger transaction
+func (d *DB) replayTransactions(badgerStore *badger.DB, trs []*transaction.Transaction) (*badger.Txn, error) {
+	txn := badgerStore.NewTransaction(true)
+	for _, tr := range trs {
+		err := d.writeTransaction(txn, tr, true)
+		if err != nil {
+			txn.Discard()
+			return nil, err
+		}
+	}
+	return txn, nil
+}
+
+// commitTransactions writes the transactions into a new Badger transaction, commits it and responds to the callers
+func (d *DB) commitTransactions(ctx context.Context, badgerStore *badger.DB, trs []*transaction.Transaction) {
+	txn, err := d.replayTransactions(badgerStore, trs)
+	if err == nil {
+		err = txn.Commit()
+	}
+
+	for _, tr := range trs {
+		go d.nonBlockingResponseChan(ctx, tr, err)
+	}
+}
+
+// writeOperation adds the operation and the document metadata if any to the Badger transaction
+func (d *DB) writeOperation(txn *badger.Txn, op *transaction.Operation, replay bool) (err error) {
+	if op.Condition != nil && !replay {
+		err = d.checkCondition(txn, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.Patch != nil && !replay {
+		err = d.applyPatch(txn, op)
+		if err != nil {
+			return err
+		}
+	}
+
+	if op.Delete {
+		err = txn.Delete(op.DBKey)
+	} else if op.CleanHistory {
+		entry := badger.NewEntry(op.DBKey, cipher.Encrypt(d.privateKey, op.DBKey, op.Value))
+		entry.WithDiscard()
+		err = txn.SetEntry(entry)
+	} else if op.ExpiresAt != 0 {
+		entry := badger.NewEntry(op.DBKey, cipher.Encrypt(d.privateKey, op.DBKey, op.Value))
+		entry.ExpiresAt = op.ExpiresAt
+		err = txn.SetEntry(entry)
+	} else {
+		err = txn.Set(op.DBKey, cipher.Encrypt(d.privateKey, op.DBKey, op.Value))
+	}
+	if err != nil || op.MetaKey == nil {
+		return err
+	}
+
+	return d.writeMeta(txn, op)
+}
+
+// checkCondition calls the condition of the operation with the saved value
+func (d *DB) checkCondition(txn *badger.Txn, op *transaction.Operation) error {
+	item, err := txn.Get(op.DBKey)
+	if err == badger.ErrKeyNotFound {
+		return op.Condition(nil, false)
+	} else if err != nil {
+		return err
+	}
+
+	encrypted, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	current, err := d.decryptData(op.DBKey, encrypted)
+	if err != nil {
+		return err
+	}
+
+	return op.Condition(current, true)
+}
+
+// write sends the operations to the write loop as one transaction and waits for the response
+func (d *DB) write(ops ...*transaction.Operation) (err error) {
+	tr := transaction.New(context.Background())
+	for _, op := range ops {
+		tr.AddOperation(op)
+	}
+
+	return d.sendTransaction(tr)
+}
+
+// sendTransaction sends the transaction to the write loop and waits for the response.
+// It stops waiting when the context of the transaction is done or when the database is closed.
+func (d *DB) sendTransaction(tr *transaction.Transaction) (err error) {
+	err = d.queueTransaction(tr)
+	if err != nil {
+		return err
+	}
+
+	return d.waitTransaction(tr)
+}
+
+// queueTransaction sends the transaction to the write loop without waiting for the response
+func (d *DB) queueTransaction(tr *transaction.Transaction) error {
+	select {
+	case d.writeChan <- tr:
+		return nil
+	case <-tr.Ctx.Done():
+		return tr.Ctx.Err()
+	case <-d.ctx.Done():
+		return d.ctx.Err()
+	}
+}
+
+// waitTransaction waits for the response of a transaction sent by queueTransaction
+func (d *DB) waitTransaction(tr *transaction.Transaction) (err error) {
+	select {
+	case err = <-tr.ResponseChan:
+	case <-tr.Ctx.Done():
+		err = tr.Ctx.Err()
+	case <-d.ctx.Done():
+		err = d.ctx.Err()
+	}
+
+	return err
 }
 
 func (d *DB) nonBlockingResponseChan(ctx context.Context, tx *transaction.Transaction, err error) {
@@ -567,6 +825,32 @@ func (d *DB) nonBlockingResponseChan(ctx context.Context, tx *transaction.Transa
 	}
 }
 
+// getClearValue returns the decrypted value saved at the key or ErrNotFound
+func (d *DB) getClearValue(dbKey []byte) (value []byte, err error) {
+	err = d.badger.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(dbKey)
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		value, err = item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		value, err = d.decryptData(dbKey, value)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
 func (d *DB) decryptData(dbKey, encryptedData []byte) (clear []byte, err error) {
 	return cipher.Decrypt(d.privateKey, dbKey, encryptedData)
 }
@@ -591,14 +875,21 @@ func (d *DB) saveConfig() (err error) {
 				collections[i].BleveIndexes = append(
 					collections[i].BleveIndexes,
 					&bleveIndexExport{
-						Name:              index.Name(),
-						Path:              index.path,
-						Signature:         index.signature,
-						Prefix:            index.prefix,
-						BleveIndexAsBytes: index.bleveIndexAsBytes,
+						Name:      index.Name(),
+						Signature: index.signature,
+						Prefix:    index.prefix,
+						Analysis:  index.analysis,
 					},
 				)
 			}
+
+			for _, index := range col.vectorIndexes {
+				collections[i].VectorIndexes = append(collections[i].VectorIndexes, index.export())
+			}
+
+			if schema := col.GetSchema(); schema != nil {
+				collections[i].Schema = schema.raw
+			}
 		}
 
 		conf := &dbExport{
@@ -690,13 +981,9 @@ func (d *DB) loadConfig() error {
 
 	collections := make([]*Collection, len(dbConfig.Collections))
 	for i, savedCol := range dbConfig.Collections {
-		col := &Collection{
-			dbElement: dbElement{
-				name:   savedCol.Name,
-				prefix: savedCol.Prefix,
-			},
-			db: d,
-		}
+		col := newCollection(savedCol.Name)
+		col.prefix = savedCol.Prefix
+		col.db = d
 
 		for _, savedIndex := range savedCol.BleveIndexes {
 			index := &BleveIndex{
@@ -704,13 +991,25 @@ func (d *DB) loadConfig() error {
 					name:   savedIndex.Name,
 					prefix: savedIndex.Prefix,
 				},
-				path:              savedIndex.Path,
-				bleveIndexAsBytes: savedIndex.BleveIndexAsBytes,
-				signature:         savedIndex.Signature,
+				signature: savedIndex.Signature,
+				analysis:  savedIndex.Analysis,
 			}
 			col.bleveIndexes = append(col.bleveIndexes, index)
 		}
 
+		for _, savedIndex := range savedCol.VectorIndexes {
+			index := newVectorIndex(savedIndex.Name, savedIndex.Prefix, savedIndex.Path, savedIndex.Dims, savedIndex.Metric)
+			col.vectorIndexes = append(col.vectorIndexes, index)
+		}
+
+		if len(savedCol.Schema) != 0 {
+			col.schema, err = CompileSchema(savedCol.Schema)
+			if err != nil {
+				d.lock.Unlock()
+				return err
+			}
+		}
+
 		collections[i] = col
 	}
 
@@ -736,8 +1035,6 @@ func (d *DB) loadConfig() error {
 	// *d = *db
 	// d.lock.Unlock()
 
-	d.startBackgroundLoops()
-
 	return nil
 }
 
@@ -745,16 +1042,31 @@ func (d *DB) loadCollections() (err error) {
 	for _, col := range d.collections {
 		for _, index := range col.bleveIndexes {
 			index.collection = col
-			indexPrefix := make([]byte, len(index.prefix))
-			copy(indexPrefix, index.prefix)
 
-			config := blevestore.NewConfigMap(d.ctx, index.path, d.privateKey, indexPrefix, d.badger, d.writeChan)
-			index.bleveIndex, err = bleve.OpenUsing(d.path+string(os.PathSeparator)+index.path, config)
+			var indexMapping *mapping.IndexMappingImpl
+			indexMapping, err = index.loadMapping()
+			if err != nil {
+				return fmt.Errorf("can't load index mapping in loadCollection: %s", err.Error())
+			}
+
+			// Defines the analysis components missing from the saved mapping
+			err = index.analysis.apply(indexMapping)
+			if err != nil {
+				return fmt.Errorf("can't load index analysis in loadCollection: %s", err.Error())
+			}
+
+			err = col.openBleveIndex(index, indexMapping)
 			if err != nil {
 				return fmt.Errorf("can't load index in loadCollection: %s", err.Error())
-				// if index.bleveIndex == nil {
-				// 	return
-				// }
+			}
+		}
+
+		for _, index := range col.vectorIndexes {
+			index.collection = col
+
+			err = index.load()
+			if err != nil {
+				return fmt.Errorf("can't load vector index in loadCollection: %s", err.Error())
 			}
 		}
 	}
@@ -96,18 +96,8 @@ func (fs *FileStore) putFileTTL(id string, ttl time.Duration) {
 		),
 	)
 
-	// Do the writing:
-	select {
-	case fs.db.writeChan <- tx:
-	case <-fs.db.ctx.Done():
-		return
-	}
-
-	// Wait for the response
-	select {
-	case <-tx.ResponseChan:
-	case <-tx.Ctx.Done():
-	}
+	// Do the writing
+	fs.db.sendTransaction(tx)
 }
 
 // PutFileRelated does the same as *DB.PutFile but the file is automatically removed
@@ -116,6 +106,11 @@ func (fs *FileStore) putFileTTL(id string, ttl time.Duration) {
 // Ones the post is removed the images and the medias are not needed anymore.
 // This provide a easy way remove files automatically based on collection documents.
 func (fs *FileStore) PutFileRelated(id string, name string, reader io.Reader, colName, documentID string) (n int, err error) {
+	// The store can't be read once the database is closed
+	if err = fs.db.ctx.Err(); err != nil {
+		return
+	}
+
 	fs.DeleteFile(id)
 
 	meta := fs.buildMeta(id, name)
@@ -193,20 +188,8 @@ func (fs *FileStore) writeFileChunk(id string, chunk int, content []byte) (err e
 	tx.AddOperation(
 		transaction.NewOperation("", nil, fs.buildFilePrefix(id, chunk), content, false, true),
 	)
-	// Run the insertion
-	select {
-	case fs.db.writeChan <- tx:
-	case <-fs.db.ctx.Done():
-		return fs.db.ctx.Err()
-	}
-
-	// And wait for the end of the insertion
-	select {
-	case err = <-tx.ResponseChan:
-	case <-tx.Ctx.Done():
-		err = tx.Ctx.Err()
-	}
-	return
+	// Run the insertion and wait for the end of it
+	return fs.db.sendTransaction(tx)
 }
 
 func (fs *FileStore) getFileMetaWithTxn(txn *badger.Txn, id, name string) (meta *FileMeta, err error) {
@@ -276,19 +259,8 @@ func (fs *FileStore) putFileMeta(meta *FileMeta) (err error) {
 	tx.AddOperation(
 		transaction.NewOperation("", nil, metaID, metaAsBytes, false, true),
 	)
-	// Run the insertion
-	select {
-	case fs.db.writeChan <- tx:
-	case <-fs.db.ctx.Done():
-		return fs.db.ctx.Err()
-	}
-	// And wait for the end of the insertion
-	select {
-	case err = <-tx.ResponseChan:
-	case <-tx.Ctx.Done():
-		err = tx.Ctx.Err()
-	}
-	return
+	// Run the insertion and wait for the end of it
+	return fs.db.sendTransaction(tx)
 }
 
 // buildRelatedFileID returns the id of the saved list of files related to the given document into the given collection
@@ -363,17 +335,8 @@ func (fs *FileStore) addRelatedFileIDs(colName, documentID string, fileIDsToAdd
 			transaction.NewOperation("", fileIDs, fs.buildRelatedID(colName, documentID), retBytes, false, true),
 		)
 
-		// Send the write request
-		fs.db.writeChan <- tx
-
-		// Wait for the write response
-		select {
-		case err = <-tx.ResponseChan:
-		case <-tx.Ctx.Done():
-			err = tx.Ctx.Err()
-		}
-
-		return err
+		// Send the write request and wait for the response
+		return fs.db.sendTransaction(tx)
 	})
 }
 
@@ -415,20 +378,8 @@ func (fs *FileStore) deleteRelatedFileIDs(colName, documentID string, fileIDsToD
 			)
 		}
 
-		// Send the write request
-		fs.db.writeChan <- tx
-
-		// Wait for the write response
-		select {
-		case err = <-tx.ResponseChan:
-		case <-tx.Ctx.Done():
-			err = tx.Ctx.Err()
-		}
-		if err != nil {
-			return err
-		}
-
-		return nil
+		// Send the write request and wait for the response
+		return fs.db.sendTransaction(tx)
 	})
 }
 
@@ -523,6 +474,11 @@ func (fs *FileStore) GetFileWriterRelated(id, name string, colName, documentID s
 
 // DeleteFile deletes every chunks of the given file ID
 func (fs *FileStore) DeleteFile(id string) (err error) {
+	// The store can't be read once the database is closed
+	if err = fs.db.ctx.Err(); err != nil {
+		return
+	}
+
 	listOfTx := []*transaction.Transaction{}
 
 	// Open a read transaction to get every IDs
@@ -553,16 +509,15 @@ func (fs *FileStore) DeleteFile(id string) (err error) {
 			tx.AddOperation(
 				transaction.NewOperation("", nil, key, nil, true, true),
 			)
+			err = fs.db.queueTransaction(tx)
+			if err != nil {
+				return err
+			}
 			listOfTx = append(listOfTx, tx)
-			fs.db.writeChan <- tx
 		}
 
 		for _, tx := range listOfTx {
-			select {
-			case err = <-tx.ResponseChan:
-			case <-tx.Ctx.Done():
-				err = tx.Ctx.Err()
-			}
+			err = fs.db.waitTransaction(tx)
 			if err != nil {
 				return err
 			}
@@ -640,22 +595,71 @@ func (fs *FileStore) newReadWriter(id, name string, writer bool, timeOut time.Du
 
 // GetFileIterator returns a file iterator which help to list existing files
 func (fs *FileStore) GetFileIterator() *FileIterator {
+	iter, _ := fs.NewFileIterator(nil)
+	return iter
+}
+
+// NewFileIterator returns a file iterator with the given options.
+// The files are ordered by the hash of their IDs so Prefix, Start and End filter the files
+// on their IDs and Reverse only changes the order. KeysOnly has no effect.
+func (fs *FileStore) NewFileIterator(options *IterOptions) (*FileIterator, error) {
+	if options == nil {
+		options = new(IterOptions)
+	}
+
+	var cursor *iteratorCursor
+	if options.Cursor != "" {
+		var err error
+		cursor, err = fs.db.decodeCursor([]byte{prefixFiles}, options.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Reverse != options.Reverse {
+			return nil, ErrInvalidCursor
+		}
+	}
+
 	iterOptions := badger.DefaultIteratorOptions
 	iterOptions.PrefetchValues = true
 	iterOptions.PrefetchSize = 1
+	iterOptions.Reverse = options.Reverse
 
 	txn := fs.db.badger.NewTransaction(false)
 	badgerIter := txn.NewIterator(iterOptions)
 
-	badgerIter.Seek([]byte{prefixFiles})
-
-	return &FileIterator{
+	iter := &FileIterator{
 		baseIterator: &baseIterator{
 			txn:        txn,
 			badgerIter: badgerIter,
+			options:    options,
 		},
 		fs: fs,
 	}
+
+	if cursor != nil {
+		// Start from the file of the cursor which is skipped
+		badgerIter.Seek(fs.buildFilePrefix(cursor.ID, 0))
+		if iter.valid([]byte{prefixFiles}) {
+			if isMeta, _ := iter.isMetaChunk(); isMeta && iter.meta.ID == cursor.ID {
+				badgerIter.Next()
+			}
+		}
+	} else if options.Reverse {
+		badgerIter.Seek([]byte{prefixFiles + 1})
+		for badgerIter.Valid() && badgerIter.Item().Key()[0] > prefixFiles {
+			badgerIter.Next()
+		}
+	} else {
+		badgerIter.Seek([]byte{prefixFiles})
+	}
+
+	err := iter.seekMeta()
+	if err != nil && err != ErrFileItemIteratorNotValid {
+		iter.Close()
+		return nil, err
+	}
+
+	return iter, nil
 }
 
 // Read implements the io.Reader interface
@@ -961,24 +965,34 @@ func (i *FileIterator) GetMeta() *FileMeta {
 
 // Next moves to the next valid metadata element
 func (i *FileIterator) Next() error {
+	i.count++
 	i.badgerIter.Next()
 
-goToNext:
-	if !i.Valid() {
+	err := i.seekMeta()
+	if err != nil {
+		return err
+	}
+
+	if i.limitReached() {
 		return ErrFileItemIteratorNotValid
 	}
+	return nil
+}
 
-	isMeta, err := i.isMetaChunk()
-	if !isMeta || err != nil {
+// seekMeta moves the cursor to the next metadata of a file which is part of the options range
+func (i *FileIterator) seekMeta() error {
+	for ; i.valid([]byte{prefixFiles}); i.badgerIter.Next() {
+		isMeta, err := i.isMetaChunk()
 		if err != nil {
 			return err
 		}
 
-		i.badgerIter.Next()
-		goto goToNext
+		if isMeta && i.options.hasID(i.meta.ID) {
+			return nil
+		}
 	}
 
-	return nil
+	return ErrFileItemIteratorNotValid
 }
 
 // Seek moves to the meta coresponding to the given id
@@ -988,13 +1002,30 @@ func (i *FileIterator) Seek(id string) {
 
 // Valid checks if the cursor point a valid metadata document
 func (i *FileIterator) Valid() bool {
+	if i.limitReached() {
+		return false
+	}
+
 	valid := i.valid([]byte{prefixFiles})
 	if valid {
-		i.isMetaChunk()
+		if isMeta, _ := i.isMetaChunk(); isMeta {
+			i.lastID = i.meta.ID
+		}
 	}
 	return valid
 }
 
+// Cursor returns an opaque token to continue the iteration after the current file with IterOptions.Cursor.
+// When the iterator is not valid anymore it returns the token to continue after the last file
+// or an empty string if there is no more files.
+func (i *FileIterator) Cursor() string {
+	if !i.Valid() && (i.lastID == "" || !i.valid([]byte{prefixFiles})) {
+		return ""
+	}
+
+	return i.fs.db.encodeCursor([]byte{prefixFiles}, i.lastID, i.options.Reverse)
+}
+
 func (i *FileIterator) isMetaChunk() (bool, error) {
 	dbKey := i.item.Key()
 	if len(dbKey) != 34 || dbKey[len(dbKey)-1] != 0 {
@@ -0,0 +1,808 @@
+package gotinydb
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+type (
+	// Filter is a MongoDB like filter document used by *Collection.Find:
+	//	Filter{
+	//		"age":  Filter{"$gt": 30},
+	//		"tags": Filter{"$in": []string{"admin", "staff"}},
+	//		"$or":  []Filter{{"name": "Alice"}, {"address.city": "Paris"}},
+	//	}
+	//
+	// The field operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists,
+	// $regex, $size and $not. The logical operators are $and, $or and $nor.
+	// A value without operator is an equality. The arrays match if one of their elements matches.
+	Filter map[string]interface{}
+
+	// FindOptions defines the projection, the order and the paging of *Collection.Find
+	FindOptions struct {
+		// Fields limits the content of the responses to the given JSON paths
+		Fields []string
+		// Sort orders the documents by the given JSON paths, a "-" prefix reverses the order
+		Sort []string
+		// Skip ignores the first matching documents
+		Skip int
+		// Limit returns at most the given number of documents if positive
+		Limit int
+	}
+
+	// FindResult is returned by *Collection.Find
+	FindResult struct {
+		Responses []*Response
+		// IndexName is the name of the index used to select the documents, empty if
+		// the all collection was scanned
+		IndexName string
+	}
+
+	// filterNode is an element of a compiled filter
+	filterNode interface {
+		match(document interface{}) bool
+		// bleveQuery returns a query matching at least every matching document
+		// or nil if the index can't select the documents
+		bleveQuery(indexMapping *mapping.IndexMappingImpl) query.Query
+	}
+
+	logicalFilter struct {
+		operator string
+		children []filterNode
+	}
+
+	fieldFilter struct {
+		path       string
+		conditions []*filterCondition
+	}
+
+	filterCondition struct {
+		operator string
+		operand  interface{}
+		regexp   *regexp.Regexp
+		not      []*filterCondition
+	}
+
+	findMatch struct {
+		id       string
+		content  []byte
+		document interface{}
+		// seq is the position of the match in the scan
+		seq int
+	}
+
+	findSortField struct {
+		path       []string
+		descending bool
+	}
+
+	// sortedFindMatches keeps the matches to sort, at most max of them if max is positive
+	sortedFindMatches struct {
+		matches []*findMatch
+		sortBy  []findSortField
+		max     int
+	}
+)
+
+// errFindDone stops the scan of *Collection.FindEach when the limit is reached
+var errFindDone = fmt.Errorf("the limit is reached")
+
+// ParseFilter reads a JSON filter document
+func ParseFilter(input string) (Filter, error) {
+	filter := Filter{}
+	err := json.Unmarshal([]byte(input), &filter)
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Find returns the documents matching the filter without the need of an index.
+// The collection is scanned with a *CollectionIterator. If an index maps the fields
+// of the filter the index is used to select the documents to check. Only the numeric,
+// boolean and keyword text fields are used, the other text fields are scanned.
+// The order is the ID order if no sort is given.
+// The responses are kept in memory, *Collection.FindEach streams them.
+func (c *Collection) Find(filter Filter, options *FindOptions) (*FindResult, error) {
+	ret := &FindResult{Responses: []*Response{}}
+
+	var err error
+	ret.IndexName, err = c.FindEach(filter, options, func(response *Response) error {
+		ret.Responses = append(ret.Responses, response)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// FindEach calls fn with the documents matching the filter like *Collection.Find returns them.
+// Without sort the documents are given while the collection is scanned and the scan stops
+// when the limit is reached or at the first error of fn.
+// With a sort and a limit only the first documents of the order are kept in memory until the
+// end of the scan. It returns the name of the index used to select the documents if any.
+func (c *Collection) FindEach(filter Filter, options *FindOptions, fn func(response *Response) error) (indexName string, err error) {
+	if options == nil {
+		options = new(FindOptions)
+	}
+
+	root, err := compileFilter(filter)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	for _, name := range c.GetBleveIndexes() {
+		index, release, err := c.useBleveIndex(name)
+		if err != nil {
+			continue
+		}
+		indexMapping, ok := index.bleveIndex.Mapping().(*mapping.IndexMappingImpl)
+		if !ok {
+			release()
+			continue
+		}
+
+		q := root.bleveQuery(indexMapping)
+		if q == nil {
+			release()
+			continue
+		}
+
+		candidates, err = index.searchIDs(q)
+		release()
+		if err != nil {
+			return "", err
+		}
+		indexName = name
+		break
+	}
+
+	// Only the sorted matches are kept, the others are given as soon as they are found
+	sorted := &sortedFindMatches{sortBy: parseFindSort(options.Sort)}
+	if options.Limit > 0 {
+		sorted.max = options.Skip + options.Limit
+	}
+
+	found := 0
+	check := func(iter *CollectionIterator) error {
+		content := iter.GetBytes()
+
+		var document interface{}
+		if json.Unmarshal(content, &document) != nil || !root.match(document) {
+			return nil
+		}
+
+		m := &findMatch{id: iter.GetID(), content: content, document: document, seq: found}
+		found++
+
+		if len(options.Sort) != 0 {
+			sorted.add(m)
+			return nil
+		}
+
+		if m.seq >= options.Skip {
+			err := c.callFindFunction(m, options.Fields, fn)
+			if err != nil {
+				return err
+			}
+		}
+		if options.Limit > 0 && found == options.Skip+options.Limit {
+			return errFindDone
+		}
+		return nil
+	}
+
+	iter := c.GetIterator()
+	defer iter.Close()
+
+	if indexName == "" {
+		for ; iter.Valid() && err == nil; iter.Next() {
+			err = check(iter)
+		}
+	} else {
+		for _, id := range candidates {
+			iter.Seek(id)
+			if iter.Valid() && iter.GetID() == id {
+				err = check(iter)
+				if err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err == errFindDone {
+		return indexName, nil
+	} else if err != nil {
+		return indexName, err
+	}
+
+	matches := sorted.ordered()
+	if options.Skip >= len(matches) {
+		return indexName, nil
+	}
+	for _, m := range matches[options.Skip:] {
+		err = c.callFindFunction(m, options.Fields, fn)
+		if err != nil {
+			return indexName, err
+		}
+	}
+
+	return indexName, nil
+}
+
+// callFindFunction calls the function of *Collection.FindEach with the projected document
+func (c *Collection) callFindFunction(m *findMatch, fields []string, fn func(response *Response) error) error {
+	content := m.content
+	if len(fields) != 0 {
+		var err error
+		content, err = json.Marshal(project(m.document, fields))
+		if err != nil {
+			return err
+		}
+	}
+
+	return fn(&Response{
+		ID:         m.id,
+		Collection: c.name,
+		Content:    content,
+	})
+}
+
+// All unmarshals every response into the destination slice pointer.
+// The elements of the slice can be values or pointers.
+func (r *FindResult) All(dest interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return ErrNotSlicePointer
+	}
+
+	sliceValue := destValue.Elem()
+	elemType := sliceValue.Type().Elem()
+	isPointer := elemType.Kind() == reflect.Ptr
+	if isPointer {
+		elemType = elemType.Elem()
+	}
+
+	for _, response := range r.Responses {
+		newElem := reflect.New(elemType)
+		err := json.Unmarshal(response.Content, newElem.Interface())
+		if err != nil {
+			return err
+		}
+
+		if isPointer {
+			sliceValue = reflect.Append(sliceValue, newElem)
+		} else {
+			sliceValue = reflect.Append(sliceValue, newElem.Elem())
+		}
+	}
+
+	destValue.Elem().Set(sliceValue)
+	return nil
+}
+
+// compileFilter checks the filter and builds the tree used to match the documents.
+// The filter goes through the JSON encoding to compare the values like the saved documents.
+func compileFilter(filter Filter) (filterNode, error) {
+	asJSON, err := json.Marshal(filter)
+	if err != nil {
+		return nil, ErrInvalidFilter
+	}
+	var normalized map[string]interface{}
+	err = json.Unmarshal(asJSON, &normalized)
+	if err != nil {
+		return nil, ErrInvalidFilter
+	}
+
+	return compileFilterDocument(normalized)
+}
+
+func compileFilterDocument(filter map[string]interface{}) (filterNode, error) {
+	root := &logicalFilter{operator: "$and"}
+
+	for key, value := range filter {
+		switch key {
+		case "$and", "$or", "$nor":
+			filters, ok := value.([]interface{})
+			if !ok || len(filters) == 0 {
+				return nil, ErrInvalidFilter
+			}
+
+			node := &logicalFilter{operator: key}
+			for _, subFilter := range filters {
+				subFilterMap, ok := subFilter.(map[string]interface{})
+				if !ok {
+					return nil, ErrInvalidFilter
+				}
+
+				child, err := compileFilterDocument(subFilterMap)
+				if err != nil {
+					return nil, err
+				}
+				node.children = append(node.children, child)
+			}
+			root.children = append(root.children, node)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, ErrInvalidFilter
+			}
+
+			conditions, err := compileConditions(value)
+			if err != nil {
+				return nil, err
+			}
+			root.children = append(root.children, &fieldFilter{path: key, conditions: conditions})
+		}
+	}
+
+	return root, nil
+}
+
+// compileConditions reads the operators of a field
+func compileConditions(value interface{}) ([]*filterCondition, error) {
+	operators, ok := value.(map[string]interface{})
+	if !ok || !isOperatorDocument(operators) {
+		// Implicit equality
+		return []*filterCondition{{operator: "$eq", operand: value}}, nil
+	}
+
+	conditions := []*filterCondition{}
+	for operator, operand := range operators {
+		condition := &filterCondition{operator: operator, operand: operand}
+
+		switch operator {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+		case "$in", "$nin":
+			if _, ok := operand.([]interface{}); !ok {
+				return nil, ErrInvalidFilter
+			}
+		case "$exists":
+			if _, ok := operand.(bool); !ok {
+				return nil, ErrInvalidFilter
+			}
+		case "$size":
+			if _, ok := operand.(float64); !ok {
+				return nil, ErrInvalidFilter
+			}
+		case "$regex":
+			pattern, ok := operand.(string)
+			if !ok {
+				return nil, ErrInvalidFilter
+			}
+			var err error
+			condition.regexp, err = regexp.Compile(pattern)
+			if err != nil {
+				return nil, ErrInvalidFilter
+			}
+		case "$not":
+			notOperators, ok := operand.(map[string]interface{})
+			if !ok || !isOperatorDocument(notOperators) {
+				return nil, ErrInvalidFilter
+			}
+			var err error
+			condition.not, err = compileConditions(notOperators)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, ErrInvalidFilter
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	return conditions, nil
+}
+
+// isOperatorDocument returns true if the keys are operators
+func isOperatorDocument(document map[string]interface{}) bool {
+	if len(document) == 0 {
+		return false
+	}
+	for key := range document {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *logicalFilter) match(document interface{}) bool {
+	switch f.operator {
+	case "$or":
+		for _, child := range f.children {
+			if child.match(document) {
+				return true
+			}
+		}
+		return false
+	case "$nor":
+		for _, child := range f.children {
+			if child.match(document) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, child := range f.children {
+		if !child.match(document) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *logicalFilter) bleveQuery(indexMapping *mapping.IndexMappingImpl) query.Query {
+	queries := []query.Query{}
+	for _, child := range f.children {
+		q := child.bleveQuery(indexMapping)
+		if q == nil {
+			// Every alternative must be selected by the index
+			if f.operator == "$or" {
+				return nil
+			}
+			continue
+		}
+		queries = append(queries, q)
+	}
+
+	if len(queries) == 0 || f.operator == "$nor" {
+		return nil
+	}
+	if len(queries) == 1 {
+		return queries[0]
+	}
+
+	if f.operator == "$or" {
+		return bleve.NewDisjunctionQuery(queries...)
+	}
+	return bleve.NewConjunctionQuery(queries...)
+}
+
+func (f *fieldFilter) match(document interface{}) bool {
+	path := strings.Split(f.path, ".")
+	values := valuesAtPath(document, path)
+	raw, exists := rawValueAtPath(document, path)
+
+	for _, condition := range f.conditions {
+		if !condition.match(values, raw, exists) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *fieldFilter) bleveQuery(indexMapping *mapping.IndexMappingImpl) query.Query {
+	fieldMapping := fieldMappingForPath(indexMapping.DefaultMapping, f.path)
+	if fieldMapping == nil {
+		return nil
+	}
+	isKeyword := indexMapping.AnalyzerNameForPath(f.path) == keyword.Name
+
+	queries := []query.Query{}
+	for _, condition := range f.conditions {
+		if q := condition.bleveQuery(f.path, fieldMapping.Type, isKeyword); q != nil {
+			queries = append(queries, q)
+		}
+	}
+
+	if len(queries) == 0 {
+		return nil
+	}
+	if len(queries) == 1 {
+		return queries[0]
+	}
+	return bleve.NewConjunctionQuery(queries...)
+}
+
+func (fc *filterCondition) match(values []interface{}, raw interface{}, exists bool) bool {
+	switch fc.operator {
+	case "$eq":
+		return filterEqual(values, raw, exists, fc.operand)
+	case "$ne":
+		return !filterEqual(values, raw, exists, fc.operand)
+	case "$in", "$nin":
+		in := false
+		for _, operand := range fc.operand.([]interface{}) {
+			if filterEqual(values, raw, exists, operand) {
+				in = true
+				break
+			}
+		}
+		return in == (fc.operator == "$in")
+	case "$exists":
+		return exists == fc.operand.(bool)
+	case "$size":
+		array, ok := raw.([]interface{})
+		return ok && float64(len(array)) == fc.operand.(float64)
+	case "$regex":
+		for _, value := range values {
+			if s, ok := value.(string); ok && fc.regexp.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	case "$not":
+		for _, condition := range fc.not {
+			if !condition.match(values, raw, exists) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Comparisons
+	for _, value := range values {
+		cmp, ok := compareFilterValues(value, fc.operand)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case fc.operator == "$gt" && cmp > 0,
+			fc.operator == "$gte" && cmp >= 0,
+			fc.operator == "$lt" && cmp < 0,
+			fc.operator == "$lte" && cmp <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// bleveQuery returns the index query selecting the documents of the condition
+func (fc *filterCondition) bleveQuery(field, fieldType string, isKeyword bool) query.Query {
+	switch fc.operator {
+	case "$eq":
+		return equalityQuery(field, fieldType, isKeyword, fc.operand)
+	case "$in":
+		queries := []query.Query{}
+		for _, operand := range fc.operand.([]interface{}) {
+			q := equalityQuery(field, fieldType, isKeyword, operand)
+			if q == nil {
+				return nil
+			}
+			queries = append(queries, q)
+		}
+		if len(queries) == 0 {
+			return nil
+		}
+		return bleve.NewDisjunctionQuery(queries...)
+	case "$gt", "$gte", "$lt", "$lte":
+		f, ok := fc.operand.(float64)
+		if !ok || fieldType != "number" {
+			return nil
+		}
+
+		inclusive := fc.operator == "$gte" || fc.operator == "$lte"
+		var q *query.NumericRangeQuery
+		if fc.operator == "$gt" || fc.operator == "$gte" {
+			q = bleve.NewNumericRangeInclusiveQuery(&f, nil, &inclusive, nil)
+		} else {
+			q = bleve.NewNumericRangeInclusiveQuery(nil, &f, nil, &inclusive)
+		}
+		q.SetField(field)
+		return q
+	}
+
+	return nil
+}
+
+// equalityQuery returns the index query selecting the documents with the given value
+func equalityQuery(field, fieldType string, isKeyword bool, value interface{}) query.Query {
+	switch typed := value.(type) {
+	case string:
+		// The analyzers can drop or change the terms of the value,
+		// only the keyword fields index the exact value.
+		if fieldType != "text" || !isKeyword || typed == "" {
+			return nil
+		}
+		q := bleve.NewTermQuery(typed)
+		q.SetField(field)
+		return q
+	case float64:
+		if fieldType != "number" {
+			return nil
+		}
+		inclusive := true
+		q := bleve.NewNumericRangeInclusiveQuery(&typed, &typed, &inclusive, &inclusive)
+		q.SetField(field)
+		return q
+	case bool:
+		if fieldType != "boolean" {
+			return nil
+		}
+		q := bleve.NewBoolFieldQuery(typed)
+		q.SetField(field)
+		return q
+	}
+
+	return nil
+}
+
+// filterEqual returns true if the field or one of its elements equals the operand.
+// A nil operand matches the missing fields.
+func filterEqual(values []interface{}, raw interface{}, exists bool, operand interface{}) bool {
+	if operand == nil {
+		return !exists || raw == nil
+	}
+	if reflect.DeepEqual(raw, operand) {
+		return true
+	}
+	for _, value := range values {
+		if reflect.DeepEqual(value, operand) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareFilterValues compares the numbers and the strings
+func compareFilterValues(a, b interface{}) (int, bool) {
+	switch typedA := a.(type) {
+	case float64:
+		typedB, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case typedA < typedB:
+			return -1, true
+		case typedA > typedB:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		typedB, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(typedA, typedB), true
+	}
+	return 0, false
+}
+
+// rawValueAtPath returns the value at the given path without going through the arrays
+func rawValueAtPath(document interface{}, path []string) (interface{}, bool) {
+	for _, name := range path {
+		object, ok := document.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		document, ok = object[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return document, true
+}
+
+// project builds a new document with only the given paths
+func project(document interface{}, fields []string) map[string]interface{} {
+	ret := map[string]interface{}{}
+
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		value, ok := rawValueAtPath(document, path)
+		if !ok {
+			continue
+		}
+
+		parent := ret
+		for _, name := range path[:len(path)-1] {
+			child, ok := parent[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[name] = child
+			}
+			parent = child
+		}
+		parent[path[len(path)-1]] = value
+	}
+
+	return ret
+}
+
+// parseFindSort splits the sort fields of FindOptions into paths and directions
+func parseFindSort(sortBy []string) []findSortField {
+	ret := make([]findSortField, len(sortBy))
+	for i, field := range sortBy {
+		ret[i] = findSortField{
+			path:       strings.Split(strings.TrimPrefix(field, "-"), "."),
+			descending: strings.HasPrefix(field, "-"),
+		}
+	}
+	return ret
+}
+
+// add keeps the match. If the number of matches is limited the last one of the order is dropped.
+func (s *sortedFindMatches) add(m *findMatch) {
+	if s.max <= 0 || len(s.matches) < s.max {
+		heap.Push(s, m)
+		return
+	}
+
+	if s.before(m, s.matches[0]) {
+		s.matches[0] = m
+		heap.Fix(s, 0)
+	}
+}
+
+// ordered returns the kept matches in the sort order
+func (s *sortedFindMatches) ordered() []*findMatch {
+	sort.Slice(s.matches, func(i, j int) bool {
+		return s.before(s.matches[i], s.matches[j])
+	})
+	return s.matches
+}
+
+// before returns true if a comes before b in the sort order.
+// The missing values come first and the values of different types are ordered
+// numbers, strings, booleans and then the others.
+// The matches with the same sort values stay in the scan order.
+func (s *sortedFindMatches) before(a, b *findMatch) bool {
+	typeRank := func(value interface{}) int {
+		switch value.(type) {
+		case nil:
+			return 0
+		case float64:
+			return 1
+		case string:
+			return 2
+		case bool:
+			return 3
+		}
+		return 4
+	}
+
+	for _, field := range s.sortBy {
+		aValue, _ := rawValueAtPath(a.document, field.path)
+		bValue, _ := rawValueAtPath(b.document, field.path)
+
+		cmp := typeRank(aValue) - typeRank(bValue)
+		if cmp == 0 {
+			if typed, ok := aValue.(bool); ok && typed != bValue.(bool) {
+				cmp = 1
+				if !typed {
+					cmp = -1
+				}
+			} else {
+				cmp, _ = compareFilterValues(aValue, bValue)
+			}
+		}
+
+		if cmp == 0 {
+			continue
+		}
+		if field.descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	}
+	return a.seq < b.seq
+}
+
+// The heap functions keep the last match of the order at the top
+
+func (s *sortedFindMatches) Len() int           { return len(s.matches) }
+func (s *sortedFindMatches) Less(i, j int) bool { return s.before(s.matches[j], s.matches[i]) }
+func (s *sortedFindMatches) Swap(i, j int)      { s.matches[i], s.matches[j] = s.matches[j], s.matches[i] }
+func (s *sortedFindMatches) Push(x interface{}) { s.matches = append(s.matches, x.(*findMatch)) }
+func (s *sortedFindMatches) Pop() interface{} {
+	last := s.matches[len(s.matches)-1]
+	s.matches = s.matches[:len(s.matches)-1]
+	return last
+}
@@ -0,0 +1,194 @@
+package gotinydb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+type findTestPerson struct {
+	Name    string   `json:"name"`
+	Age     int      `json:"age"`
+	Tags    []string `json:"tags,omitempty"`
+	Address struct {
+		City string `json:"city"`
+	} `json:"address"`
+}
+
+func TestFind(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	personCol, err := testDB.Use("persons")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	persons := map[string]struct {
+		name, city string
+		age        int
+		tags       []string
+	}{
+		"p1": {"Alice", "Paris", 34, []string{"admin", "staff"}},
+		"p2": {"Bob", "Lyon", 25, []string{"staff"}},
+		"p3": {"Carol", "Paris", 41, nil},
+		"p4": {"Dave", "Nantes", 30, []string{"guest"}},
+		"p5": {"Eve", "Lyon", 52, []string{"admin"}},
+	}
+	batch, _ := personCol.NewBatch(context.Background())
+	for id, p := range persons {
+		person := &findTestPerson{Name: p.name, Age: p.age, Tags: p.tags}
+		person.Address.City = p.city
+		batch.Put(id, person)
+	}
+	err = batch.Write()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ids := func(result *FindResult) []string {
+		ret := []string{}
+		for _, response := range result.Responses {
+			ret = append(ret, response.ID)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		options  *FindOptions
+		expected []string
+	}{
+		{"all", nil, nil, []string{"p1", "p2", "p3", "p4", "p5"}},
+		{"greater", Filter{"age": Filter{"$gt": 30}}, nil, []string{"p1", "p3", "p5"}},
+		{"in", Filter{"tags": Filter{"$in": []string{"admin", "guest"}}}, nil, []string{"p1", "p4", "p5"}},
+		{"nested equality", Filter{"address.city": "Paris", "age": Filter{"$lt": 40}}, nil, []string{"p1"}},
+		{"or", Filter{"$or": []Filter{{"name": "Bob"}, {"age": Filter{"$gte": 52}}}}, nil, []string{"p2", "p5"}},
+		{"not exists", Filter{"tags": Filter{"$exists": false}}, nil, []string{"p3"}},
+		{"not", Filter{"age": Filter{"$not": Filter{"$gt": 30}}}, nil, []string{"p2", "p4"}},
+		{"regex and nin", Filter{"name": Filter{"$regex": "^[A-C]"}, "address.city": Filter{"$nin": []string{"Lyon"}}}, nil, []string{"p1", "p3"}},
+		{"sort skip limit", Filter{}, &FindOptions{Sort: []string{"address.city", "-age"}, Skip: 1, Limit: 3}, []string{"p2", "p4", "p3"}},
+		{"limit", nil, &FindOptions{Limit: 2}, []string{"p1", "p2"}},
+		{"skip and limit", nil, &FindOptions{Skip: 3, Limit: 5}, []string{"p4", "p5"}},
+		{"sort limit with equal values", nil, &FindOptions{Sort: []string{"address.city"}, Limit: 3}, []string{"p2", "p5", "p4"}},
+		{"sort descending limit", nil, &FindOptions{Sort: []string{"-age"}, Limit: 2}, []string{"p5", "p3"}},
+	}
+
+	check := func(step string, expectedIndex string) {
+		for _, test := range tests {
+			result, err := personCol.Find(test.filter, test.options)
+			if err != nil {
+				t.Errorf("%s %s: %s", step, test.name, err.Error())
+				continue
+			}
+			if got := ids(result); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("%s %s: expected %v but got %v", step, test.name, test.expected, got)
+			}
+		}
+
+		result, _ := personCol.Find(Filter{"age": Filter{"$gt": 30}}, nil)
+		if result.IndexName != expectedIndex {
+			t.Errorf("%s: expected index %q to be used but got %q", step, expectedIndex, result.IndexName)
+		}
+	}
+
+	check("scan", "")
+
+	personMapping := bleve.NewDocumentStaticMapping()
+	personMapping.AddFieldMappingsAt("age", bleve.NewNumericFieldMapping())
+	tagsMapping := bleve.NewTextFieldMapping()
+	tagsMapping.Analyzer = "keyword"
+	personMapping.AddFieldMappingsAt("tags", tagsMapping)
+	personMapping.AddFieldMappingsAt("name", bleve.NewTextFieldMapping())
+	err = personCol.SetBleveIndex("persons", personMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	check("index", "persons")
+
+	// Projection
+	result, err := personCol.Find(Filter{"name": "Alice"}, &FindOptions{Fields: []string{"name", "address.city"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(result.Responses) != 1 {
+		t.Errorf("expected one response but got %d", len(result.Responses))
+		return
+	}
+	var projected map[string]interface{}
+	json.Unmarshal(result.Responses[0].Content, &projected)
+	expected := map[string]interface{}{"name": "Alice", "address": map[string]interface{}{"city": "Paris"}}
+	if !reflect.DeepEqual(projected, expected) {
+		t.Errorf("expected %v but got %v", expected, projected)
+	}
+
+	found := []*findTestPerson{}
+	err = result.All(&found)
+	if err != nil || len(found) != 1 || found[0].Name != "Alice" || found[0].Age != 0 {
+		t.Errorf("unexpected projected persons %v %v", found, err)
+	}
+
+	// The streaming stops at the first error
+	stopErr := errors.New("stop")
+	streamed := []string{}
+	indexName, err := personCol.FindEach(nil, nil, func(response *Response) error {
+		streamed = append(streamed, response.ID)
+		if len(streamed) == 2 {
+			return stopErr
+		}
+		return nil
+	})
+	if err != stopErr || indexName != "" || !reflect.DeepEqual(streamed, []string{"p1", "p2"}) {
+		t.Errorf("unexpected streaming %v %q %v", streamed, indexName, err)
+	}
+
+	// JSON filters
+	filter, err := ParseFilter(`{"age": {"$lte": 25}}`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err = personCol.Find(filter, nil)
+	if err != nil || !reflect.DeepEqual(ids(result), []string{"p2"}) {
+		t.Errorf("unexpected JSON filter result %v %v", result, err)
+	}
+
+	// The analyzed text fields are scanned, the stop words are not indexed
+	err = personCol.Put("p6", &findTestPerson{Name: "The", Age: 60})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err = personCol.Find(Filter{"name": "The"}, nil)
+	if err != nil || !reflect.DeepEqual(ids(result), []string{"p6"}) || result.IndexName != "" {
+		t.Errorf("unexpected analyzed text result %v %v", result, err)
+	}
+	result, err = personCol.Find(Filter{"tags": "staff"}, nil)
+	if err != nil || !reflect.DeepEqual(ids(result), []string{"p1", "p2"}) || result.IndexName != "persons" {
+		t.Errorf("unexpected keyword result %v %v", result, err)
+	}
+
+	for _, filter := range []Filter{
+		{"age": Filter{"$unknown": 1}},
+		{"$where": "true"},
+		{"tags": Filter{"$in": "admin"}},
+		{"$or": "nothing"},
+	} {
+		if _, err = personCol.Find(filter, nil); err != ErrInvalidFilter {
+			t.Errorf("expected %v for %v but got %v", ErrInvalidFilter, filter, err)
+		}
+	}
+}
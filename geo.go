@@ -0,0 +1,143 @@
+package gotinydb
+
+import (
+	"math"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/geo"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/numeric"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+type (
+	// GeoPoint is a location saved as {"lat": x, "lon": y}.
+	// It can be used inside the documents and is detected by MappingFromStruct.
+	GeoPoint struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+
+	// GeoDistanceSort sorts the hits by the distance between the geo point
+	// of the field and the given location. The closest hits come first.
+	GeoDistanceSort struct {
+		Field string
+		Lat   float64
+		Lon   float64
+	}
+)
+
+// AddGeoPointMapping adds a geo point field mapping to the document mapping at the given path.
+// The missing sub documents of the path are added with the same dynamic setting as the document.
+// The indexed values can be objects with "lat" and "lon" (or "lng") fields, [lon, lat] arrays
+// or "lat,lon" strings.
+func AddGeoPointMapping(documentMapping *mapping.DocumentMapping, path string) *mapping.DocumentMapping {
+	parts := strings.Split(path, ".")
+
+	current := documentMapping
+	for _, part := range parts[:len(parts)-1] {
+		subMapping, ok := current.Properties[part]
+		if !ok {
+			subMapping = bleve.NewDocumentMapping()
+			subMapping.Dynamic = documentMapping.Dynamic
+			current.AddSubDocumentMapping(part, subMapping)
+		}
+		current = subMapping
+	}
+
+	current.AddFieldMappingsAt(parts[len(parts)-1], bleve.NewGeoPointFieldMapping())
+
+	return documentMapping
+}
+
+// NewGeoNearQuery returns a query matching the geo points of the field which are
+// within the radius of the given location. The radius is a distance like "500m" or "10km".
+func NewGeoNearQuery(field string, lat, lon float64, radius string) query.Query {
+	q := bleve.NewGeoDistanceQuery(lon, lat, radius)
+	q.SetField(field)
+	return q
+}
+
+// NewGeoBoundingBoxQuery returns a query matching the geo points of the field which are
+// inside the box defined by its top left and bottom right corners
+func NewGeoBoundingBoxQuery(field string, topLeft, bottomRight GeoPoint) query.Query {
+	q := bleve.NewGeoBoundingBoxQuery(topLeft.Lon, topLeft.Lat, bottomRight.Lon, bottomRight.Lat)
+	q.SetField(field)
+	return q
+}
+
+// NewGeoPolygonQuery returns a query matching the geo points of the field which are
+// inside the polygon defined by the given points.
+// The polygon is closed by joining the last point to the first one.
+func NewGeoPolygonQuery(field string, points ...GeoPoint) query.Query {
+	polygon := make([]geo.Point, len(points), len(points)+1)
+	for i, point := range points {
+		polygon[i] = geo.Point{Lon: point.Lon, Lat: point.Lat}
+	}
+	// Bleve only checks the edges between the given points
+	if len(points) > 0 && points[0] != points[len(points)-1] {
+		polygon = append(polygon, polygon[0])
+	}
+
+	q := query.NewGeoBoundingPolygonQuery(polygon)
+	q.SetField(field)
+	return q
+}
+
+// SearchNear returns an iterator over the documents with a geo point in the field
+// within the radius of the given location. The radius is a distance like "500m" or "10km".
+// The hits are sorted by distance and Response.Distance is set in meters.
+func (c *Collection) SearchNear(indexName, field string, lat, lon float64, radius string) (*SearchIterator, error) {
+	_, err := geo.ParseDistance(radius)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &SearchOptions{
+		SortByDistance: &GeoDistanceSort{Field: field, Lat: lat, Lon: lon},
+	}
+
+	return c.NewSearchIterator(indexName, NewGeoNearQuery(field, lat, lon, radius), options)
+}
+
+// searchSort returns the Bleve sort of the distance
+func (s *GeoDistanceSort) searchSort() search.SearchSort {
+	// The unit is valid so no error is possible
+	sort, _ := search.NewSortGeoDistance(s.Field, "m", s.Lon, s.Lat, false)
+	return sort
+}
+
+// geoDistance returns the distance in meters computed by the geo distance sort of the request
+func geoDistance(searchRequest *bleve.SearchRequest, docMatch *search.DocumentMatch) (float64, bool) {
+	if searchRequest == nil {
+		return 0, false
+	}
+
+	for i, sort := range searchRequest.Sort {
+		geoSort, ok := sort.(*search.SortGeoDistance)
+		if !ok || i >= len(docMatch.Sort) {
+			continue
+		}
+
+		i64, err := numeric.PrefixCoded(docMatch.Sort[i]).Int64()
+		// The document has no geo point
+		if err != nil || i64 == math.MaxInt64 {
+			return 0, false
+		}
+
+		distance := numeric.Int64ToFloat64(i64)
+		if geoSort.Unit != "" {
+			unit, err := geo.ParseDistanceUnit(geoSort.Unit)
+			if err != nil {
+				return 0, false
+			}
+			distance *= unit
+		}
+
+		return distance, true
+	}
+
+	return 0, false
+}
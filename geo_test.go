@@ -0,0 +1,185 @@
+package gotinydb
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+type (
+	geoTestPlace struct {
+		Location GeoPoint `json:"location"`
+	}
+	geoTestCity struct {
+		Name  string       `json:"name"`
+		Place geoTestPlace `json:"place"`
+	}
+)
+
+var geoTestCities = map[string]GeoPoint{
+	"paris":      {Lat: 48.8566, Lon: 2.3522},
+	"versailles": {Lat: 48.8049, Lon: 2.1204},
+	"orleans":    {Lat: 47.9030, Lon: 1.9093},
+	"london":     {Lat: 51.5074, Lon: -0.1278},
+	"lyon":       {Lat: 45.7640, Lon: 4.8357},
+}
+
+func TestGeo(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	err = testCol.SetBleveIndex("geo", AddGeoPointMapping(bleve.NewDocumentStaticMapping(), "place.location"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for name, point := range geoTestCities {
+		err = testCol.Put(name, &geoTestCity{Name: name, Place: geoTestPlace{point}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// Other geo point formats
+	testCol.Put("madrid", map[string]interface{}{"place": map[string]interface{}{"location": []float64{-3.7038, 40.4168}}})
+	testCol.Put("rome", map[string]interface{}{"place": map[string]interface{}{"location": "41.9028,12.4964"}})
+
+	checkIterator := func(step string, iter *SearchIterator, expected []string) []*Response {
+		responses := []*Response{}
+		for {
+			response, err := iter.NextResponse(nil)
+			if err == ErrEndOfQueryResult {
+				break
+			} else if err != nil {
+				t.Errorf("%s: %s", step, err.Error())
+				return nil
+			}
+			responses = append(responses, response)
+		}
+
+		if len(responses) != len(expected) {
+			t.Errorf("%s: expected %d responses but got %d", step, len(expected), len(responses))
+			return nil
+		}
+		for i, response := range responses {
+			if response.ID != expected[i] {
+				t.Errorf("%s: expected %q at %d but got %q", step, expected[i], i, response.ID)
+			}
+		}
+		return responses
+	}
+
+	iter, err := testCol.SearchNear("geo", "place.location", 48.8566, 2.3522, "400km")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	responses := checkIterator("near", iter, []string{"paris", "versailles", "orleans", "london", "lyon"})
+	if responses != nil {
+		if responses[0].Distance > 1 {
+			t.Errorf("expected Paris to be at 0m but got %f", responses[0].Distance)
+		}
+		if responses[1].Distance < 16000 || responses[1].Distance > 19000 {
+			t.Errorf("expected Versailles to be around 17km but got %f", responses[1].Distance)
+		}
+		if responses[4].Distance < 380000 || responses[4].Distance > 400000 {
+			t.Errorf("expected Lyon to be around 390km but got %f", responses[4].Distance)
+		}
+	}
+
+	iter, err = testCol.SearchNear("geo", "place.location", 48.8566, 2.3522, "20km")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkIterator("near small radius", iter, []string{"paris", "versailles"})
+
+	iter, err = testCol.SearchNear("geo", "place.location", 40, 0, "2000km")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkIterator("other formats", iter, []string{"madrid", "lyon", "orleans", "versailles", "paris", "rome", "london"})
+
+	// Bounding box sorted by distance from Orléans
+	iter, err = testCol.NewSearchIterator("geo", NewGeoBoundingBoxQuery("place.location", GeoPoint{Lat: 49.5, Lon: 1.5}, GeoPoint{Lat: 47.5, Lon: 3}), &SearchOptions{
+		SortByDistance: &GeoDistanceSort{Field: "place.location", Lat: 47.9030, Lon: 1.9093},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkIterator("bounding box", iter, []string{"orleans", "versailles", "paris"})
+
+	// Strip from London to Lyon without Orléans
+	polygon := NewGeoPolygonQuery("place.location", GeoPoint{Lat: 52, Lon: -1}, GeoPoint{Lat: 52, Lon: 1}, GeoPoint{Lat: 45, Lon: 5.5}, GeoPoint{Lat: 45, Lon: 4.6})
+	result, err := testCol.SearchPage("geo", polygon, &SearchOptions{
+		SortByDistance: &GeoDistanceSort{Field: "place.location", Lat: 45.7640, Lon: 4.8357},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []string{"lyon", "paris", "versailles", "london"}
+	if result.Total() != uint64(len(expected)) {
+		t.Errorf("expected %d polygon hits but got %d", len(expected), result.Total())
+	}
+	for _, id := range expected {
+		response, err := result.NextResponse(nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if response.ID != id {
+			t.Errorf("expected %q but got %q", id, response.ID)
+		}
+	}
+
+	if _, err = testCol.SearchNear("geo", "place.location", 0, 0, "far"); err == nil {
+		t.Errorf("expected an error with an invalid radius")
+	}
+	if _, err = testCol.SearchNear("unknown", "place.location", 0, 0, "1km"); err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+}
+
+func TestGeoMappingFromStruct(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	err = testCol.SetBleveIndexFor("geo", &geoTestCity{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for name, point := range geoTestCities {
+		testCol.Put(name, &geoTestCity{Name: name, Place: geoTestPlace{point}})
+	}
+
+	iter, err := testCol.SearchNear("geo", "place.location", 51.5074, -0.1278, "1km")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	city := new(geoTestCity)
+	response, err := iter.NextResponse(city)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if response.ID != "london" || city.Name != "london" || response.Distance > 1 {
+		t.Errorf("unexpected response %q %v %f", response.ID, city, response.Distance)
+	}
+	if _, err = iter.NextResponse(nil); err != ErrEndOfQueryResult {
+		t.Errorf("expected %v but got %v", ErrEndOfQueryResult, err)
+	}
+}
@@ -1,19 +1,19 @@
 package gotinydb
 
 import (
-	"archive/zip"
-	"bytes"
-	"compress/flate"
 	"encoding/json"
-	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"strings"
+	"sync"
 
 	"golang.org/x/crypto/blake2b"
 
+	"github.com/alexandrestein/gotinydb/blevestore"
+
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index/upsidedown"
 	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/dgraph-io/badger"
 )
 
 type (
@@ -25,23 +25,28 @@ type (
 		// has been updated since initialization.
 		signature [blake2b.Size256]byte
 
+		// analysis holds the custom analysis components of the index
+		analysis *IndexAnalysis
+
 		collection *Collection
 
 		bleveIndex bleve.Index
-		path       string
 
-		bleveIndexAsBytes []byte
+		// readers counts the searches using the index so a rebuild closes it after them
+		readers sync.WaitGroup
 	}
 
 	bleveIndexExport struct {
-		Name              string
-		Signature         [blake2b.Size256]byte
-		Path              string
-		Prefix            []byte
-		BleveIndexAsBytes []byte
+		Name      string
+		Signature [blake2b.Size256]byte
+		Prefix    []byte
+		Analysis  *IndexAnalysis `json:",omitempty"`
 	}
 )
 
+// mappingInternalKey is the key Bleve uses to save the index mapping
+var mappingInternalKey = []byte("_mapping")
+
 func newIndex(name string) *BleveIndex {
 	return &BleveIndex{
 		dbElement: dbElement{
@@ -54,124 +59,157 @@ func (i *BleveIndex) close() error {
 	return i.bleveIndex.Close()
 }
 
-func (i *BleveIndex) delete() {
-	os.RemoveAll(i.collection.db.path + string(os.PathSeparator) + i.path)
-}
+// loadMapping reads the index mapping Bleve saved into the store
+func (i *BleveIndex) loadMapping() (*mapping.IndexMappingImpl, error) {
+	storeKey := make([]byte, len(i.prefix))
+	copy(storeKey, i.prefix)
+	storeKey = append(storeKey, upsidedown.NewInternalRow(mappingInternalKey, nil).Key()...)
 
-func (i *BleveIndex) indexZipper() ([]byte, error) {
-	// Get a Buffer to Write To
-	buff := bytes.NewBuffer(nil)
+	var mappingAsBytes []byte
+	err := i.collection.db.badger.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(storeKey)
+		if err != nil {
+			return err
+		}
 
-	// Create a new zip archive.
-	w := zip.NewWriter(buff)
-	w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
-		return flate.NewWriter(out, flate.BestCompression)
-	})
+		var encryptedValue []byte
+		encryptedValue, err = item.ValueCopy(encryptedValue)
+		if err != nil {
+			return err
+		}
 
-	// Add some files to the archive.
-	err := i.addFiles(w, i.collection.db.path+string(os.PathSeparator)+i.path, "")
+		mappingAsBytes, err = i.collection.db.decryptData(storeKey, encryptedValue)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	// Make sure to check the error on Close.
-	err = w.Close()
+	indexMapping := bleve.NewIndexMapping()
+	err = json.Unmarshal(mappingAsBytes, indexMapping)
 	if err != nil {
 		return nil, err
 	}
 
-	return buff.Bytes(), nil
+	return indexMapping, nil
 }
 
-func (i *BleveIndex) addFiles(w *zip.Writer, basePath, baseInZip string) error {
-	// Open the Directory
-	files, err := ioutil.ReadDir(basePath)
-	if err != nil {
-		return err
+// buildSignature hashes the document mapping and the analysis of the index.
+// The analysis must be set before calling.
+func (i *BleveIndex) buildSignature(documentMapping *mapping.DocumentMapping) error {
+	var definition interface{} = documentMapping
+	// Indexes without analysis keep the signature of the document mapping only
+	if i.analysis != nil {
+		definition = []interface{}{documentMapping, i.analysis}
 	}
 
-	for _, file := range files {
-		if !file.IsDir() {
-			dat, err := ioutil.ReadFile(basePath + string(os.PathSeparator) + file.Name())
-			if err != nil {
-				return err
-			}
-
-			// Add some files to the archive.
-			f, err := w.Create(baseInZip + file.Name())
-			if err != nil {
-				return err
-			}
-			_, err = f.Write(dat)
-			if err != nil {
-				return err
-			}
-		} else if file.IsDir() {
-
-			newBase := basePath + file.Name() + string(os.PathSeparator)
-
-			err := i.addFiles(w, newBase, file.Name()+string(os.PathSeparator))
-			if err != nil {
-				return err
-			}
-		}
+	resp, err := json.Marshal(definition)
+	if err != nil {
+		return err
 	}
 
+	i.signature = blake2b.Sum256(resp)
 	return nil
 }
 
-func (i *BleveIndex) indexUnzipper() error {
-	buff := bytes.NewReader(i.bleveIndexAsBytes)
-	// Open a zip archive for reading.
-	r, err := zip.NewReader(buff, int64(buff.Len()))
-	if err != nil {
-		return err
+// documentMapping returns the document mapping the index was built with
+func (i *BleveIndex) documentMapping() *mapping.DocumentMapping {
+	if indexMapping, ok := i.bleveIndex.Mapping().(*mapping.IndexMappingImpl); ok {
+		return indexMapping.DefaultMapping
 	}
-	r.RegisterDecompressor(zip.Deflate, func(r io.Reader) io.ReadCloser {
-		return flate.NewReader(r)
-	})
+	return bleve.NewDocumentMapping()
+}
 
-	// Iterate through the files in the archive,
-	// printing some of their contents.
-	for _, f := range r.File {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer rc.Close()
+// searchIDs returns the IDs of every document matched by the query
+func (i *BleveIndex) searchIDs(q query.Query) ([]string, error) {
+	pageSize := 1000
+	req := bleve.NewSearchRequestOptions(q, pageSize, 0, false)
+	// Stable order between the pages
+	req.SortBy([]string{"_id"})
 
-		var fileBytes []byte
-		fileBytes, err = ioutil.ReadAll(rc)
+	ids := []string{}
+	for {
+		result, err := i.bleveIndex.Search(req)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		filePath := i.collection.db.path + string(os.PathSeparator) + i.path + string(os.PathSeparator) + f.Name
-
-		err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
-		if err != nil {
-			return err
+		for _, hit := range result.Hits {
+			ids = append(ids, hit.ID)
 		}
 
-		err = ioutil.WriteFile(filePath, fileBytes, 0640)
-		if err != nil {
-			return err
+		if len(result.Hits) < pageSize {
+			return ids, nil
 		}
-		err = rc.Close()
-		if err != nil {
-			return err
+		req.From += pageSize
+	}
+}
+
+// fieldMappingForPath returns the field mapping explicitly defined for the given path.
+// It returns nil if the field is not indexed or if the path has many field mappings.
+func fieldMappingForPath(documentMapping *mapping.DocumentMapping, path string) *mapping.FieldMapping {
+	for _, name := range strings.Split(path, ".") {
+		if documentMapping == nil {
+			return nil
 		}
+		documentMapping = documentMapping.Properties[name]
 	}
 
-	return nil
+	if documentMapping == nil || len(documentMapping.Fields) != 1 || !documentMapping.Fields[0].Index {
+		return nil
+	}
+	return documentMapping.Fields[0]
 }
 
-func (i *BleveIndex) buildSignature(documentMapping *mapping.DocumentMapping) error {
-	resp, err := json.Marshal(documentMapping)
+// setBulk lets the index writes be split into many Badger transactions
+func (i *BleveIndex) setBulk(bulk bool) error {
+	_, kvStore, err := i.bleveIndex.Advanced()
 	if err != nil {
 		return err
 	}
 
-	i.signature = blake2b.Sum256(resp)
+	if bulkStore, ok := kvStore.(*blevestore.Store); ok {
+		bulkStore.SetBulk(bulk)
+	}
 	return nil
 }
+
+// listIDs returns every document ID referenced by the index
+func (i *BleveIndex) listIDs() (map[string]struct{}, error) {
+	advancedIndex, _, err := i.bleveIndex.Advanced()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := advancedIndex.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	docIDReader, err := reader.DocIDReaderAll()
+	if err != nil {
+		return nil, err
+	}
+	defer docIDReader.Close()
+
+	ret := map[string]struct{}{}
+	for {
+		internalID, err := docIDReader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if internalID == nil {
+			break
+		}
+
+		var id string
+		id, err = reader.ExternalID(internalID)
+		if err != nil {
+			return nil, err
+		}
+		ret[id] = struct{}{}
+	}
+
+	return ret, nil
+}
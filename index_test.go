@@ -1,6 +1,11 @@
 package gotinydb
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
 
@@ -196,3 +201,118 @@ func TestIndexResultNext(t *testing.T) {
 		return
 	}
 }
+
+func TestIndexSavedInBadger(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	checkNoDirectory := func() {
+		files, err := ioutil.ReadDir(testPath)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				t.Errorf("the database directory must not contain any directory but has %q", file.Name())
+			}
+		}
+	}
+	checkNoDirectory()
+
+	// The indexes must be usable in read only mode
+	testDB.Close()
+	testDB, err = OpenReadOnly(testPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testCol, err = testDB.Use(testColName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Email))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Loading a backup must not write anything outside Badger
+	backup := bytes.NewBuffer(nil)
+	err = testDB.Backup(backup)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testDB.Close()
+	os.RemoveAll(testPath)
+
+	testDB, err = Open(testPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = testDB.Load(backup)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	checkNoDirectory()
+
+	testCol, err = testDB.Use(testColName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Email))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIndexLargeCollection(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// The writes of the index are bigger than a single Badger transaction
+	for i := 0; i < 3000; i += 500 {
+		batch, _ := testCol.NewBatch(context.Background())
+		for j := i; j < i+500; j++ {
+			batch.Put(fmt.Sprintf("large %04d", j), &testUserStruct{Name: fmt.Sprintf("name %d", j), Email: fmt.Sprintf("large%d@internet.org", j%3)})
+		}
+		err = batch.Write()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	nameMapping := bleve.NewDocumentStaticMapping()
+	emailMapping := bleve.NewTextFieldMapping()
+	emailMapping.Analyzer = "keyword"
+	nameMapping.AddFieldMappingsAt("email", emailMapping)
+	err = testCol.SetBleveIndex("large", nameMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	q := bleve.NewTermQuery("large1@internet.org")
+	q.SetField("email")
+	result, err := testCol.SearchPage("large", q, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.BleveSearchResult.Total != 1000 {
+		t.Errorf("expected 1000 documents but got %d", result.BleveSearchResult.Total)
+	}
+}
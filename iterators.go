@@ -1,14 +1,48 @@
 package gotinydb
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/alexandrestein/gotinydb/cipher"
 	"github.com/dgraph-io/badger"
 )
 
 type (
+	// IterOptions defines the range, the order and the size of the iterations.
+	// The range goes from Start included to End excluded and it's walked backward with Reverse.
+	IterOptions struct {
+		// Prefix limits the iteration to the IDs starting with the prefix
+		Prefix string
+		// Start is the smallest ID of the iteration if not empty
+		Start string
+		// End is the first ID out of the iteration if not empty
+		End string
+		// Limit is the maximum number of elements if positive
+		Limit int
+		// Reverse iterates from the biggest ID to the smallest one
+		Reverse bool
+		// KeysOnly does not prefetch the values when only the IDs are needed.
+		// The values can still be read.
+		KeysOnly bool
+		// Cursor continues a previous iteration after the element given by the Cursor method
+		// of the iterator. The other options must be the same.
+		Cursor string
+	}
+
 	baseIterator struct {
 		txn        *badger.Txn
 		badgerIter *badger.Iterator
 		item       *badger.Item
+
+		options *IterOptions
+		// count is the number of elements passed by Next
+		count int
+		// lastID is the ID of the last valid element
+		lastID string
 	}
 
 	// CollectionIterator provides a nice way to list elements
@@ -17,6 +51,10 @@ type (
 
 		c         *Collection
 		colPrefix []byte
+		// prefix is the collection prefix with the IDs prefix of the options
+		prefix []byte
+		// lower is the first key of a reverse iteration and upper is the first key out of a regular one
+		lower, upper []byte
 	}
 
 	// FileIterator provides easy access to all written files
@@ -26,6 +64,12 @@ type (
 		fs   *FileStore
 		meta *FileMeta
 	}
+
+	// iteratorCursor is the content of the continuation tokens
+	iteratorCursor struct {
+		ID      string `json:"id"`
+		Reverse bool   `json:"reverse"`
+	}
 )
 
 func (i *baseIterator) valid(prefix []byte) bool {
@@ -43,6 +87,11 @@ func (i *baseIterator) valid(prefix []byte) bool {
 	return true
 }
 
+// limitReached returns true if the iterator has returned the maximum number of elements
+func (i *baseIterator) limitReached() bool {
+	return i.options.Limit > 0 && i.count >= i.options.Limit
+}
+
 // Close closes the current iterator and it's related components.
 // This method needs to be called ones the iterator is no more needed.
 func (i *baseIterator) Close() {
@@ -50,27 +99,36 @@ func (i *baseIterator) Close() {
 	i.txn.Discard()
 }
 
-func (i *CollectionIterator) get(dest interface{}) []byte {
+func (i *CollectionIterator) get(dest interface{}, options []GetOption) ([]byte, error) {
 	caller := new(multiGetCaller)
 	caller.id = i.GetID()
 	caller.dbID = i.getDBKey()
 	caller.pointer = dest
+	caller.fields = buildGetOptions(options).fields
 
-	caller.encryptedAsBytes, _ = i.item.ValueCopy(caller.encryptedAsBytes)
+	var err error
+	caller.encryptedAsBytes, err = i.item.ValueCopy(caller.encryptedAsBytes)
+	if err != nil {
+		return nil, err
+	}
 
-	i.c.decryptAndUnmarshal(caller)
+	err = i.c.decryptAndUnmarshal(caller)
 
-	return caller.asBytes
+	return caller.asBytes, err
 }
 
-// GetBytes returns the document as a slice of bytes
-func (i *CollectionIterator) GetBytes() []byte {
-	return i.get(nil)
+// GetBytes returns the document as a slice of bytes.
+// The options like Fields can limit the returned content.
+func (i *CollectionIterator) GetBytes(options ...GetOption) []byte {
+	asBytes, _ := i.get(nil, options)
+	return asBytes
 }
 
-// GetValue tries to fill-up the dest pointer with the coresponding document
-func (i *CollectionIterator) GetValue(dest interface{}) {
-	i.get(dest)
+// GetValue tries to fill-up the dest pointer with the coresponding document.
+// It returns the decoding error if any.
+func (i *CollectionIterator) GetValue(dest interface{}, options ...GetOption) error {
+	_, err := i.get(dest, options)
+	return err
 }
 
 func (i *CollectionIterator) getDBKey() []byte {
@@ -100,13 +158,47 @@ func (i *CollectionIterator) GetID() string {
 // it will move to the smallest bigger key than the current one. If the iterator is
 // in reverted mode it will move to the biggest smaller key than the current one.
 func (i *CollectionIterator) Next() {
+	i.count++
 	i.badgerIter.Next()
 }
 
 // Valid returns true if the cursor still on valid value.
-// It returns false if the iteration is done
+// It returns false if the iteration is done or the limit is reached
 func (i *CollectionIterator) Valid() bool {
-	return i.valid(i.colPrefix)
+	if i.limitReached() || !i.inRange() {
+		return false
+	}
+
+	i.lastID = string(i.item.Key()[len(i.colPrefix):])
+	return true
+}
+
+// Cursor returns an opaque token to continue the iteration after the current element with IterOptions.Cursor.
+// When the iterator is not valid anymore it returns the token to continue after the last element
+// or an empty string if there is nothing more in the range.
+func (i *CollectionIterator) Cursor() string {
+	if i.Valid() {
+		return i.c.db.encodeCursor(i.colPrefix, i.lastID, i.options.Reverse)
+	}
+
+	if i.lastID == "" || !i.inRange() {
+		return ""
+	}
+
+	return i.c.db.encodeCursor(i.colPrefix, i.lastID, i.options.Reverse)
+}
+
+// inRange returns true if the current element is part of the iteration range
+func (i *CollectionIterator) inRange() bool {
+	if !i.valid(i.prefix) {
+		return false
+	}
+
+	key := i.item.Key()
+	if i.options.Reverse {
+		return i.lower == nil || bytes.Compare(key, i.lower) >= 0
+	}
+	return i.upper == nil || bytes.Compare(key, i.upper) < 0
 }
 
 // Seek would seek to the provided key if present.
@@ -115,3 +207,172 @@ func (i *CollectionIterator) Valid() bool {
 func (i *CollectionIterator) Seek(id string) {
 	i.badgerIter.Seek(i.c.buildDBKey(id))
 }
+
+// NewIterator returns an iterator over the range defined by the options.
+// If the options are nil every element is returned. The iterator needs to be closed.
+func (c *Collection) NewIterator(options *IterOptions) (*CollectionIterator, error) {
+	if options == nil {
+		options = new(IterOptions)
+	}
+
+	iterOptions := badger.DefaultIteratorOptions
+	iterOptions.Reverse = options.Reverse
+	iterOptions.PrefetchValues = !options.KeysOnly
+
+	colPrefix := c.buildDBKey("")
+	iter := &CollectionIterator{
+		c:         c,
+		colPrefix: colPrefix,
+		prefix:    c.buildDBKey(options.Prefix),
+	}
+
+	var after []byte
+	if options.Cursor != "" {
+		cursor, err := c.db.decodeCursor(colPrefix, options.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Reverse != options.Reverse {
+			return nil, ErrInvalidCursor
+		}
+		after = c.buildDBKey(cursor.ID)
+	}
+
+	if options.Reverse {
+		if options.Start != "" {
+			iter.lower = c.buildDBKey(options.Start)
+		}
+
+		iter.upper = prefixUpperBound(iter.prefix)
+		if options.End != "" {
+			iter.upper = minKey(iter.upper, c.buildDBKey(options.End))
+		}
+		if after != nil {
+			iter.upper = minKey(iter.upper, after)
+		}
+	} else {
+		iter.lower = iter.prefix
+		if options.Start != "" {
+			iter.lower = maxKey(iter.lower, c.buildDBKey(options.Start))
+		}
+		if after != nil {
+			// The smallest key after the cursor
+			iter.lower = maxKey(iter.lower, append(after, 0))
+		}
+
+		if options.End != "" {
+			iter.upper = c.buildDBKey(options.End)
+		}
+	}
+
+	txn := c.db.badger.NewTransaction(false)
+	iter.baseIterator = &baseIterator{
+		txn:        txn,
+		badgerIter: txn.NewIterator(iterOptions),
+		options:    options,
+	}
+
+	if options.Reverse {
+		// The upper bound is excluded
+		iter.badgerIter.Seek(iter.upper)
+		for iter.badgerIter.Valid() && bytes.Compare(iter.badgerIter.Item().Key(), iter.upper) >= 0 {
+			iter.badgerIter.Next()
+		}
+	} else {
+		iter.badgerIter.Seek(iter.lower)
+	}
+
+	return iter, nil
+}
+
+// ForEach calls fn with every element of the range defined by the options and closes the iterator.
+// The value is nil with IterOptions.KeysOnly. The iteration stops at the first error of fn or
+// when the context is done. It returns the cursor to continue the iteration if the limit is reached.
+func (c *Collection) ForEach(ctx context.Context, options *IterOptions, fn func(id string, value []byte) error) (cursor string, err error) {
+	iter, err := c.NewIterator(options)
+	if err != nil {
+		return "", err
+	}
+	defer iter.Close()
+
+	for ; iter.Valid(); iter.Next() {
+		if err = ctx.Err(); err != nil {
+			return "", err
+		}
+
+		var value []byte
+		if !iter.options.KeysOnly {
+			value, err = iter.get(nil, nil)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		err = fn(iter.GetID(), value)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return iter.Cursor(), nil
+}
+
+// hasID returns true if the ID is part of the range of the options
+func (o *IterOptions) hasID(id string) bool {
+	return strings.HasPrefix(id, o.Prefix) &&
+		(o.Start == "" || id >= o.Start) &&
+		(o.End == "" || id < o.End)
+}
+
+// encodeCursor returns the continuation token of the element with the given ID.
+// The token is encrypted with the prefix of the iterated elements.
+func (d *DB) encodeCursor(prefix []byte, id string, reverse bool) string {
+	asBytes, _ := json.Marshal(&iteratorCursor{ID: id, Reverse: reverse})
+	return base64.RawURLEncoding.EncodeToString(cipher.Encrypt(d.privateKey, prefix, asBytes))
+}
+
+func (d *DB) decodeCursor(prefix []byte, token string) (*iteratorCursor, error) {
+	encrypted, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	asBytes, err := cipher.Decrypt(d.privateKey, prefix, encrypted)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := new(iteratorCursor)
+	err = json.Unmarshal(asBytes, cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// prefixUpperBound returns the smallest key bigger than every key starting with the prefix
+func prefixUpperBound(prefix []byte) []byte {
+	upper := append([]byte{}, prefix...)
+	for i := len(upper) - 1; i >= 0; i-- {
+		if upper[i] < 0xff {
+			upper[i]++
+			return upper[:i+1]
+		}
+	}
+	return nil
+}
+
+func minKey(a, b []byte) []byte {
+	if a == nil || bytes.Compare(b, a) < 0 {
+		return b
+	}
+	return a
+}
+
+func maxKey(a, b []byte) []byte {
+	if bytes.Compare(b, a) > 0 {
+		return b
+	}
+	return a
+}
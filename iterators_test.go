@@ -2,6 +2,7 @@ package gotinydb
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"fmt"
 	"reflect"
@@ -107,3 +108,188 @@ func TestFileIterator(t *testing.T) {
 		t.Errorf("this test must loop %d times but it looks like it did only %d", 5, n)
 	}
 }
+
+func TestCollectionIteratorOptions(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	batch, _ := testCol.NewBatch(context.Background())
+	for _, id := range []string{"user:41:a", "user:42:a", "user:42:b", "user:42:c", "user:42:d", "user:43:a", "user:42"} {
+		batch.Put(id, map[string]string{"id": id})
+	}
+	err = batch.Write()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	list := func(options *IterOptions) (ids []string, cursor string) {
+		iter, err := testCol.NewIterator(options)
+		if err != nil {
+			t.Error(err)
+			return nil, ""
+		}
+		defer iter.Close()
+
+		for ; iter.Valid(); iter.Next() {
+			ids = append(ids, iter.GetID())
+		}
+		return ids, iter.Cursor()
+	}
+
+	tests := []struct {
+		options  *IterOptions
+		expected []string
+	}{
+		{&IterOptions{Prefix: "user:42:"}, []string{"user:42:a", "user:42:b", "user:42:c", "user:42:d"}},
+		{&IterOptions{Prefix: "user:42:", Reverse: true}, []string{"user:42:d", "user:42:c", "user:42:b", "user:42:a"}},
+		{&IterOptions{Start: "user:42:b", End: "user:43"}, []string{"user:42:b", "user:42:c", "user:42:d"}},
+		{&IterOptions{Start: "user:42:b", End: "user:42:d", Reverse: true}, []string{"user:42:c", "user:42:b"}},
+		{&IterOptions{Prefix: "user:", Start: "user:42", Limit: 2, KeysOnly: true}, []string{"user:42", "user:42:a"}},
+		{&IterOptions{Prefix: "user:4", Reverse: true, Limit: 1}, []string{"user:43:a"}},
+		{&IterOptions{Prefix: "none"}, nil},
+	}
+	for i, test := range tests {
+		ids, _ := list(test.options)
+		if !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%d: expected %v but got %v", i, test.expected, ids)
+		}
+	}
+
+	// Pagination with the cursors
+	for _, reverse := range []bool{false, true} {
+		options := &IterOptions{Prefix: "user:", Limit: 3, Reverse: reverse}
+		all, _ := list(&IterOptions{Prefix: "user:", Reverse: reverse})
+
+		pages := []string{}
+		for page := 0; page < 5; page++ {
+			ids, cursor := list(options)
+			pages = append(pages, ids...)
+			if cursor == "" {
+				break
+			}
+			options.Cursor = cursor
+		}
+		if !reflect.DeepEqual(pages, all) {
+			t.Errorf("the pages %v do not match %v", pages, all)
+		}
+	}
+
+	_, cursor := list(&IterOptions{Limit: 1})
+	if _, err = testCol.NewIterator(&IterOptions{Cursor: cursor, Reverse: true}); err != ErrInvalidCursor {
+		t.Errorf("expected %v but got %v", ErrInvalidCursor, err)
+	}
+	if _, err = testCol.NewIterator(&IterOptions{Cursor: "not a cursor"}); err != ErrInvalidCursor {
+		t.Errorf("expected %v but got %v", ErrInvalidCursor, err)
+	}
+	otherCol, _ := testDB.Use("other collection")
+	if _, err = otherCol.NewIterator(&IterOptions{Cursor: cursor}); err != ErrInvalidCursor {
+		t.Errorf("the cursor of an other collection is accepted: %v", err)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	values := map[string]string{}
+	cursor, err := testCol.ForEach(context.Background(), &IterOptions{Limit: 1}, func(id string, value []byte) error {
+		values[id] = string(value)
+		return nil
+	})
+	if err != nil || cursor == "" || len(values) != 1 || values[testUserID] == "" {
+		t.Errorf("unexpected first page %v %q %v", values, cursor, err)
+	}
+
+	cursor, err = testCol.ForEach(context.Background(), &IterOptions{Cursor: cursor, KeysOnly: true}, func(id string, value []byte) error {
+		values[id] = string(value)
+		return nil
+	})
+	if err != nil || cursor != "" || len(values) != 2 || values[cloneTestUserID] != "" {
+		t.Errorf("unexpected last page %v %q %v", values, cursor, err)
+	}
+
+	stop := fmt.Errorf("stop")
+	if _, err = testCol.ForEach(context.Background(), nil, func(string, []byte) error { return stop }); err != stop {
+		t.Errorf("expected %v but got %v", stop, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = testCol.ForEach(ctx, nil, func(string, []byte) error { return nil }); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestFileIteratorOptions(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	for _, id := range []string{"a:1", "a:2", "a:3", "b:1", "b:2"} {
+		_, err := testDB.GetFileStore().PutFile(id, id, bytes.NewBufferString(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(options *IterOptions) (ids []string, cursor string) {
+		iter, err := testDB.GetFileStore().NewFileIterator(options)
+		if err != nil {
+			t.Error(err)
+			return nil, ""
+		}
+		defer iter.Close()
+
+		for ; iter.Valid(); iter.Next() {
+			ids = append(ids, iter.GetMeta().ID)
+		}
+		return ids, iter.Cursor()
+	}
+
+	all, _ := list(nil)
+	reversed, _ := list(&IterOptions{Reverse: true})
+	if len(all) != 5 || len(reversed) != 5 {
+		t.Errorf("unexpected files %v %v", all, reversed)
+		return
+	}
+	for i := range all {
+		if all[i] != reversed[4-i] {
+			t.Errorf("the reversed order %v does not match %v", reversed, all)
+			break
+		}
+	}
+
+	ids, _ := list(&IterOptions{Prefix: "a:", End: "a:3"})
+	if len(ids) != 2 {
+		t.Errorf("unexpected filtered files %v", ids)
+	}
+
+	for _, reverse := range []bool{false, true} {
+		options := &IterOptions{Limit: 2, Reverse: reverse}
+		pages := []string{}
+		for page := 0; page < 5; page++ {
+			ids, cursor := list(options)
+			pages = append(pages, ids...)
+			if cursor == "" {
+				break
+			}
+			options.Cursor = cursor
+		}
+		expected := all
+		if reverse {
+			expected = reversed
+		}
+		if !reflect.DeepEqual(pages, expected) {
+			t.Errorf("the pages %v do not match %v", pages, expected)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package gotinydb
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/dgraph-io/badger"
+	"golang.org/x/crypto/blake2b"
+)
+
+type (
+	// KVStore saves raw values by raw keys in a namespace.
+	// The values are encrypted, written by the write loop and saved by the backups
+	// like the documents but there is no JSON encoding, no index and no metadata.
+	KVStore struct {
+		db        *DB
+		namespace string
+		prefix    []byte
+	}
+)
+
+// errCompareFailed is returned by the condition of *KVStore.CompareAndSwap when the value changed
+var errCompareFailed = fmt.Errorf("the value is not the expected one")
+
+// KV returns the key-value store of the namespace
+func (d *DB) KV(namespace string) *KVStore {
+	hash := blake2b.Sum256([]byte(namespace))
+
+	return &KVStore{
+		db:        d,
+		namespace: namespace,
+		prefix:    append([]byte{prefixKV}, hash[:]...),
+	}
+}
+
+// Namespace returns the namespace of the store
+func (kv *KVStore) Namespace() string {
+	return kv.namespace
+}
+
+// Get returns the value of the key or ErrNotFound
+func (kv *KVStore) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyID
+	}
+
+	return kv.db.getClearValue(kv.buildDBKey(key))
+}
+
+// Set saves the value of the key
+func (kv *KVStore) Set(key, value []byte) error {
+	return kv.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL does the same as *KVStore.Set but the key is removed after the given duration.
+// The expiration is done by Badger without any TTL record.
+func (kv *KVStore) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	if len(key) == 0 {
+		return ErrEmptyID
+	}
+
+	op := transaction.NewOperation("", nil, kv.buildDBKey(key), value, false, false)
+	if ttl > 0 {
+		op.ExpiresAt = unixCeil(time.Now().Add(ttl))
+	}
+
+	return kv.db.write(op)
+}
+
+// Delete removes the key
+func (kv *KVStore) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyID
+	}
+
+	return kv.db.write(transaction.NewOperation("", nil, kv.buildDBKey(key), nil, true, false))
+}
+
+// CompareAndSwap sets the new value only if the saved value is the old one.
+// A nil old value means the key must not exist and a nil new value deletes the key.
+// The comparison and the write are done in the same transaction.
+// It returns false if the saved value is not the old one.
+func (kv *KVStore) CompareAndSwap(key, oldValue, newValue []byte) (swapped bool, err error) {
+	if len(key) == 0 {
+		return false, ErrEmptyID
+	}
+
+	op := transaction.NewOperation("", nil, kv.buildDBKey(key), newValue, newValue == nil, false)
+	op.Condition = func(current []byte, found bool) error {
+		if (oldValue == nil && !found) || (oldValue != nil && found && bytes.Equal(current, oldValue)) {
+			return nil
+		}
+		return errCompareFailed
+	}
+
+	err = kv.db.write(op)
+	if err == errCompareFailed {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Iterate calls fn with every key starting with the prefix and its value in the keys order.
+// The iteration stops at the first error of fn. The slices are only valid during the call.
+func (kv *KVStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	dbPrefix := kv.buildDBKey(prefix)
+
+	return kv.db.badger.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(dbPrefix); iter.ValidForPrefix(dbPrefix); iter.Next() {
+			item := iter.Item()
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			value, err = kv.db.decryptData(item.Key(), value)
+			if err != nil {
+				return err
+			}
+
+			err = fn(item.Key()[len(kv.prefix):], value)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (kv *KVStore) buildDBKey(key []byte) []byte {
+	return append(append([]byte{}, kv.prefix...), key...)
+}
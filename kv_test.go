@@ -0,0 +1,228 @@
+package gotinydb
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/dgraph-io/badger"
+)
+
+func TestKV(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	kv := testDB.KV("raw")
+	other := testDB.KV("other")
+
+	if _, err = kv.Get([]byte("missing")); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+	if err = kv.Set(nil, []byte("value")); err != ErrEmptyID {
+		t.Errorf("expected %v but got %v", ErrEmptyID, err)
+	}
+
+	// The values are not JSON
+	values := map[string][]byte{
+		"a:1": {0, 1, 2},
+		"a:2": []byte("not JSON"),
+		"b:1": {},
+	}
+	for key, value := range values {
+		if err = kv.Set([]byte(key), value); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	other.Set([]byte("a:3"), []byte("other namespace"))
+
+	for key, value := range values {
+		if saved, err := kv.Get([]byte(key)); err != nil || !bytes.Equal(saved, value) {
+			t.Errorf("%s: expected %v but got %v %v", key, value, saved, err)
+		}
+	}
+
+	keys := []string{}
+	err = kv.Iterate([]byte("a:"), func(key, value []byte) error {
+		if !bytes.Equal(value, values[string(key)]) {
+			t.Errorf("%s: expected %v but got %v", key, values[string(key)], value)
+		}
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil || fmt.Sprint(keys) != "[a:1 a:2]" {
+		t.Errorf("unexpected iteration %v %v", keys, err)
+	}
+
+	if err = kv.Delete([]byte("a:1")); err != nil {
+		t.Error(err)
+	}
+	if _, err = kv.Get([]byte("a:1")); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+
+	// Compare and swap
+	tests := []struct {
+		old, new []byte
+		swapped  bool
+	}{
+		{[]byte("wrong"), []byte("1"), false},
+		{nil, []byte("1"), true},
+		{nil, []byte("2"), false},
+		{[]byte("1"), []byte("2"), true},
+		{[]byte("1"), nil, false},
+		{[]byte("2"), nil, true},
+	}
+	for i, test := range tests {
+		swapped, err := kv.CompareAndSwap([]byte("cas"), test.old, test.new)
+		if err != nil || swapped != test.swapped {
+			t.Errorf("%d: expected %v but got %v %v", i, test.swapped, swapped, err)
+		}
+	}
+	if _, err = kv.Get([]byte("cas")); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+
+	// Concurrent increments with compare and swap
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				for {
+					current, err := kv.Get([]byte("counter"))
+					if err == ErrNotFound {
+						current = nil
+					}
+					n, _ := strconv.Atoi(string(current))
+					if swapped, _ := kv.CompareAndSwap([]byte("counter"), current, []byte(strconv.Itoa(n+1))); swapped {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if counter, _ := kv.Get([]byte("counter")); string(counter) != "100" {
+		t.Errorf("expected %q but got %q", "100", counter)
+	}
+
+	// The backups contain the key-value stores
+	var backup bytes.Buffer
+	if err = testDB.Backup(&backup); err != nil {
+		t.Error(err)
+		return
+	}
+
+	restoredDBPath := os.TempDir() + "/restoredKVDB"
+	defer os.RemoveAll(restoredDBPath)
+
+	restoredDB, err := Open(restoredDBPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer restoredDB.Close()
+
+	if err = restoredDB.Load(&backup); err != nil {
+		t.Error(err)
+		return
+	}
+	if value, err := restoredDB.KV("raw").Get([]byte("a:2")); err != nil || string(value) != "not JSON" {
+		t.Errorf("unexpected restored value %q %v", value, err)
+	}
+}
+
+func TestKVTTL(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	kv := testDB.KV("ttl")
+	if err = kv.SetWithTTL([]byte("short"), []byte("value"), time.Second); err != nil {
+		t.Error(err)
+		return
+	}
+	kv.Set([]byte("long"), []byte("value"))
+
+	if _, err = kv.Get([]byte("short")); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(time.Second * 2)
+
+	if _, err = kv.Get([]byte("short")); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+	if _, err = kv.Get([]byte("long")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWriteAtomicity(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	kv := testDB.KV("atomic")
+
+	// The second operation fails so the first one is not written
+	first := transaction.NewOperation("", nil, kv.buildDBKey([]byte("first")), []byte("value"), false, false)
+	second := transaction.NewOperation("", nil, kv.buildDBKey([]byte("second")), []byte("value"), false, false)
+	second.Condition = func(current []byte, found bool) error {
+		return errCompareFailed
+	}
+
+	// The other transactions of the same Badger transaction are written
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := kv.Set([]byte(strconv.Itoa(i)), []byte("value")); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	if err = testDB.write(first, second); err != errCompareFailed {
+		t.Errorf("expected %v but got %v", errCompareFailed, err)
+	}
+	wg.Wait()
+
+	if _, err = kv.Get([]byte("first")); err != ErrNotFound {
+		t.Errorf("the operations of a failed transaction must not be written but got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err = kv.Get([]byte(strconv.Itoa(i))); err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+	}
+
+	// A transaction too big for Badger is not split
+	ops := []*transaction.Operation{}
+	for i := 0; i < 5000; i++ {
+		ops = append(ops, transaction.NewOperation("", nil, kv.buildDBKey([]byte(fmt.Sprintf("big %d", i))), []byte("value"), false, false))
+	}
+	if err = testDB.write(ops...); err != badger.ErrTxnTooBig {
+		t.Errorf("expected %v but got %v", badger.ErrTxnTooBig, err)
+	}
+	err = kv.Iterate([]byte("big "), func(key, value []byte) error {
+		return fmt.Errorf("the big transaction is partly written")
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
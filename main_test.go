@@ -1,6 +1,8 @@
 package gotinydb
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"log"
@@ -187,7 +189,10 @@ func TestDeleteParts(t *testing.T) {
 
 	bleveIndex, _ := testCol.GetBleveIndex(testIndexName)
 	prefix := bleveIndex.prefix
-	testCol.DeleteIndex(testIndexName)
+	if err := testCol.DeleteIndex(testIndexName); err != nil {
+		t.Error(err)
+		return
+	}
 
 	time.Sleep(time.Second)
 
@@ -292,3 +297,37 @@ func TestChangeKey(t *testing.T) {
 		return
 	}
 }
+
+func TestWritesAfterClose(t *testing.T) {
+	defer os.RemoveAll(testPath)
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	err = testDB.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The writes return instead of waiting for the stopped write loop
+	if err = testCol.Put(testUserID, testUser); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if err = testCol.Delete(testUserID); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if err = testDB.KV("closed").Set([]byte("key"), []byte("value")); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if err = testCol.PutWithTTL(testUserID, testUser, time.Minute); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if _, err = testDB.GetFileStore().PutFile("file ID", "file name", bytes.NewBuffer([]byte("content"))); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if err = testDB.GetFileStore().DeleteFile("file ID"); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
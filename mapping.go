@@ -0,0 +1,283 @@
+package gotinydb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/mapping"
+)
+
+const (
+	// mappingTagName is the struct tag read by MappingFromStruct
+	mappingTagName = "gotinydb"
+
+	mappingTypeText     = "text"
+	mappingTypeKeyword  = "keyword"
+	mappingTypeNumeric  = "numeric"
+	mappingTypeDatetime = "datetime"
+	mappingTypeBoolean  = "boolean"
+	mappingTypeGeoPoint = "geopoint"
+)
+
+type (
+	// fieldTag is the parsed content of a gotinydb struct tag
+	fieldTag struct {
+		skip      bool
+		fieldType string
+		analyzer  string
+		store     bool
+	}
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// MappingFromStruct builds a static document mapping from the given struct sample.
+// Every exported field is indexed depending on its type and the field names are
+// the ones used by the JSON encoding.
+//
+// The mapping can be tuned with the gotinydb struct tag:
+//
+//	Email   string    `json:"email" gotinydb:"index,analyzer=keyword"`
+//	Secret  string    `gotinydb:"-"`
+//	Place   []float64 `json:"place" gotinydb:"type=geopoint"`
+//	Comment string    `gotinydb:"store"`
+//
+// The available options are "index" (default), "-" to skip the field,
+// "analyzer=<name>" for text fields, "store" to keep the value in the index for the
+// highlights and SearchOptions.Fields and
+// "type=<text|keyword|numeric|datetime|boolean|geopoint>" to override the type detection.
+// Strings are text, numbers are numeric, booleans are boolean, time.Time are datetime and
+// structs with "lat" and "lon" (or "lng") fields are geo points.
+// Nested structs are sub documents and slices, arrays and pointers use the mapping of their elements.
+func MappingFromStruct(v interface{}) (*mapping.DocumentMapping, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+
+	return documentMappingFromType(t, map[reflect.Type]bool{})
+}
+
+func documentMappingFromType(t reflect.Type, parents map[reflect.Type]bool) (*mapping.DocumentMapping, error) {
+	// Prevent infinite recursion with self referencing types
+	parents[t] = true
+	defer delete(parents, t)
+
+	documentMapping := bleve.NewDocumentStaticMapping()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// Not exported
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name, omit := jsonFieldName(field)
+		if omit {
+			continue
+		}
+
+		tag, err := parseFieldTag(field.Tag.Get(mappingTagName))
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %s", field.Name, err.Error())
+		}
+		if tag.skip {
+			continue
+		}
+
+		fieldType := derefType(field.Type)
+		if field.PkgPath != "" && fieldType.Kind() != reflect.Struct {
+			continue
+		}
+
+		// Embedded structs without JSON name are flattened by the JSON encoding
+		if field.Anonymous && field.Tag.Get("json") == "" && fieldType.Kind() == reflect.Struct {
+			if parents[fieldType] {
+				continue
+			}
+			var embedded *mapping.DocumentMapping
+			embedded, err = documentMappingFromType(fieldType, parents)
+			if err != nil {
+				return nil, err
+			}
+			for propName, prop := range embedded.Properties {
+				documentMapping.AddSubDocumentMapping(propName, prop)
+			}
+			continue
+		}
+
+		err = addFieldToDocumentMapping(documentMapping, name, fieldType, tag, parents)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %s", field.Name, err.Error())
+		}
+	}
+
+	return documentMapping, nil
+}
+
+func addFieldToDocumentMapping(documentMapping *mapping.DocumentMapping, name string, t reflect.Type, tag *fieldTag, parents map[reflect.Type]bool) error {
+	// Slices and arrays are indexed as multiple values of the same field
+	// except for geo points defined as [lon, lat]
+	for (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && tag.fieldType != mappingTypeGeoPoint {
+		// Raw bytes are not indexed
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		t = derefType(t.Elem())
+	}
+
+	fieldType := tag.fieldType
+	if fieldType == "" {
+		fieldType = detectFieldType(t)
+	}
+
+	var fieldMapping *mapping.FieldMapping
+	switch fieldType {
+	case mappingTypeText:
+		fieldMapping = bleve.NewTextFieldMapping()
+	case mappingTypeKeyword:
+		fieldMapping = bleve.NewTextFieldMapping()
+		fieldMapping.Analyzer = "keyword"
+	case mappingTypeNumeric:
+		fieldMapping = bleve.NewNumericFieldMapping()
+	case mappingTypeDatetime:
+		fieldMapping = bleve.NewDateTimeFieldMapping()
+	case mappingTypeBoolean:
+		fieldMapping = bleve.NewBooleanFieldMapping()
+	case mappingTypeGeoPoint:
+		fieldMapping = bleve.NewGeoPointFieldMapping()
+	case "struct":
+		if parents[t] {
+			return nil
+		}
+		subMapping, err := documentMappingFromType(t, parents)
+		if err != nil {
+			return err
+		}
+		documentMapping.AddSubDocumentMapping(name, subMapping)
+		return nil
+	case "map":
+		documentMapping.AddSubDocumentMapping(name, bleve.NewDocumentMapping())
+		return nil
+	default:
+		// Interfaces, channels, functions... can't be mapped
+		return nil
+	}
+
+	if tag.analyzer != "" {
+		fieldMapping.Analyzer = tag.analyzer
+	}
+	fieldMapping.Store = tag.store
+
+	documentMapping.AddFieldMappingsAt(name, fieldMapping)
+	return nil
+}
+
+func detectFieldType(t reflect.Type) string {
+	if t == timeType {
+		return mappingTypeDatetime
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return mappingTypeText
+	case reflect.Bool:
+		return mappingTypeBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return mappingTypeNumeric
+	case reflect.Struct:
+		if isGeoPointStruct(t) {
+			return mappingTypeGeoPoint
+		}
+		return "struct"
+	case reflect.Map:
+		return "map"
+	}
+
+	return ""
+}
+
+// isGeoPointStruct returns true if the struct is saved as {"lat": x, "lon": y}
+func isGeoPointStruct(t reflect.Type) bool {
+	lat, lon := false, false
+	for i := 0; i < t.NumField(); i++ {
+		name, omit := jsonFieldName(t.Field(i))
+		if omit {
+			continue
+		}
+
+		switch strings.ToLower(name) {
+		case "lat":
+			lat = true
+		case "lon", "lng":
+			lon = true
+		}
+	}
+	return lat && lon
+}
+
+func parseFieldTag(input string) (*fieldTag, error) {
+	tag := new(fieldTag)
+	if input == "" {
+		return tag, nil
+	}
+	if input == "-" {
+		tag.skip = true
+		return tag, nil
+	}
+
+	for _, option := range strings.Split(input, ",") {
+		option = strings.TrimSpace(option)
+		key, value := option, ""
+		if i := strings.Index(option, "="); i >= 0 {
+			key, value = option[:i], option[i+1:]
+		}
+
+		switch key {
+		case "", "index":
+		case "store":
+			tag.store = true
+		case "analyzer":
+			tag.analyzer = value
+		case "type":
+			switch value {
+			case mappingTypeText, mappingTypeKeyword, mappingTypeNumeric,
+				mappingTypeDatetime, mappingTypeBoolean, mappingTypeGeoPoint:
+				tag.fieldType = value
+			default:
+				return nil, fmt.Errorf("unknown type %q", value)
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+
+	return tag, nil
+}
+
+// jsonFieldName returns the name used by the JSON encoding and true if the field is not encoded
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	jsonTag := field.Tag.Get("json")
+	if jsonTag == "-" {
+		return "", true
+	}
+	if name := strings.Split(jsonTag, ",")[0]; name != "" {
+		return name, false
+	}
+	return field.Name, false
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
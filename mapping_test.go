@@ -0,0 +1,159 @@
+package gotinydb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+type (
+	mappingTestLocation struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+
+	mappingTestBase struct {
+		Created time.Time `json:"created"`
+	}
+
+	mappingTestProduct struct {
+		mappingTestBase
+
+		Ref         string                `json:"ref" gotinydb:"index,analyzer=keyword"`
+		Description string                `json:"description" gotinydb:"store"`
+		Price       float64               `json:"price"`
+		Available   bool                  `json:"available"`
+		Tags        []string              `json:"tags"`
+		Shop        *mappingTestLocation  `json:"shop"`
+		Seller      *testUserStruct       `json:"seller"`
+		Related     []*mappingTestProduct `json:"related"`
+		Secret      string                `json:"secret" gotinydb:"-"`
+		Ignored     string                `json:"-"`
+		Raw         []byte                `json:"raw"`
+
+		internal string
+	}
+)
+
+func TestMappingFromStruct(t *testing.T) {
+	documentMapping, err := MappingFromStruct(&mappingTestProduct{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expectedTypes := map[string]string{
+		"ref":         "text",
+		"description": "text",
+		"price":       "number",
+		"available":   "boolean",
+		"tags":        "text",
+		"shop":        "geopoint",
+		"created":     "datetime",
+	}
+	for name, expectedType := range expectedTypes {
+		prop, ok := documentMapping.Properties[name]
+		if !ok || len(prop.Fields) != 1 {
+			t.Errorf("the field %q must be mapped", name)
+			continue
+		}
+		if prop.Fields[0].Type != expectedType {
+			t.Errorf("expected field %q to be %q but got %q", name, expectedType, prop.Fields[0].Type)
+		}
+	}
+
+	if a := documentMapping.Properties["ref"].Fields[0].Analyzer; a != "keyword" {
+		t.Errorf("expected the analyzer to be %q but got %q", "keyword", a)
+	}
+	if !documentMapping.Properties["description"].Fields[0].Store || documentMapping.Properties["ref"].Fields[0].Store {
+		t.Errorf("only the description must be stored")
+	}
+
+	for _, name := range []string{"secret", "Ignored", "raw", "internal", "mappingTestBase"} {
+		if _, ok := documentMapping.Properties[name]; ok {
+			t.Errorf("the field %q must not be mapped", name)
+		}
+	}
+
+	seller, ok := documentMapping.Properties["seller"]
+	if !ok {
+		t.Errorf("the nested struct must be mapped")
+		return
+	}
+	if _, ok := seller.Properties["oauth"].Properties["URL"]; !ok {
+		t.Errorf("the deeply nested struct must be mapped")
+	}
+
+	// Self referencing types are mapped only once
+	if _, ok := documentMapping.Properties["related"]; ok {
+		t.Errorf("recursive types must be ignored")
+	}
+
+	if _, err = MappingFromStruct("not a struct"); err != ErrNotStruct {
+		t.Errorf("expected %v but got %v", ErrNotStruct, err)
+	}
+	if _, err = MappingFromStruct(&struct {
+		Bad string `gotinydb:"type=unknown"`
+	}{}); err == nil {
+		t.Errorf("unknown types must be rejected")
+	}
+}
+
+func TestSetBleveIndexFor(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	productCol, err := testDB.Use("products")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = productCol.SetBleveIndexFor("products", &mappingTestProduct{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = productCol.Put("p1", &mappingTestProduct{
+		mappingTestBase: mappingTestBase{Created: time.Now()},
+		Ref:             "AB-12 x",
+		Price:           12.5,
+		Tags:            []string{"blue", "small"},
+		Shop:            &mappingTestLocation{Lat: 48.85, Lon: 2.35},
+		Secret:          "hidden",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// The keyword analyzer keeps the exact value
+	refQuery := bleve.NewTermQuery("AB-12 x")
+	refQuery.SetField("ref")
+	if _, err = productCol.Search("products", refQuery); err != nil {
+		t.Errorf("the exact reference must match: %v", err)
+	}
+
+	priceMin, priceMax := 10.0, 20.0
+	priceQuery := bleve.NewNumericRangeQuery(&priceMin, &priceMax)
+	priceQuery.SetField("price")
+	if _, err = productCol.Search("products", priceQuery); err != nil {
+		t.Errorf("the price must be indexed: %v", err)
+	}
+
+	geoQuery := bleve.NewGeoDistanceQuery(2.35, 48.85, "1km")
+	geoQuery.SetField("shop")
+	if _, err = productCol.Search("products", geoQuery); err != nil {
+		t.Errorf("the location must be indexed: %v", err)
+	}
+
+	secretQuery := bleve.NewMatchQuery("hidden")
+	if _, err = productCol.Search("products", secretQuery); err != ErrNotFound {
+		t.Errorf("the secret must not be indexed but got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package gotinydb
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/alexandrestein/gotinydb/cipher"
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/dgraph-io/badger"
+)
+
+type (
+	// DocMeta is the metadata saved with every documents.
+	// It's updated by the database on every writes.
+	// The documents saved before the metadata support have a zero DocMeta until the next write.
+	//
+	// The metadata are saved in their own record next to the document instead of an envelope
+	// around the value. The saved documents keep the format of the previous versions so the
+	// existing databases and backups need no migration, the reads which do not ask for the
+	// metadata do not decode them and the records of the metadata can be written without history.
+	DocMeta struct {
+		Created  time.Time `json:"created"`
+		Updated  time.Time `json:"updated"`
+		Revision uint64    `json:"revision"`
+		// Writer is the identity given with WithWriter or AsWriter to the last write
+		Writer string `json:"writer,omitempty"`
+	}
+
+	writerContextKey struct{}
+
+	// WriteOption changes the way a document is written by *Collection.Put, *Collection.Patch
+	// and the other single document writes
+	WriteOption func(*writeOptions)
+
+	writeOptions struct {
+		writer string
+	}
+)
+
+// metaFieldName is the field of the indexed documents containing the metadata
+const metaFieldName = "_meta"
+
+// WithWriter returns a context which saves the writer identity into the metadata of
+// the documents written by the batches built with it
+func WithWriter(ctx context.Context, writer string) context.Context {
+	return context.WithValue(ctx, writerContextKey{}, writer)
+}
+
+// AsWriter saves the writer identity into the metadata of the document like WithWriter does
+// for the batches. The deletions remove the metadata so they do not use it.
+func AsWriter(writer string) WriteOption {
+	return func(o *writeOptions) {
+		o.writer = writer
+	}
+}
+
+func buildWriteOptions(options []WriteOption) *writeOptions {
+	ret := new(writeOptions)
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func writerFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	writer, _ := ctx.Value(writerContextKey{}).(string)
+	return writer
+}
+
+// AddMetaMapping adds the mapping of the document metadata to the document mapping.
+// The metadata are indexed as "_meta.created", "_meta.updated", "_meta.revision" and "_meta.writer"
+// only by the indexes having this mapping. They are not part of the "_all" field.
+func AddMetaMapping(documentMapping *mapping.DocumentMapping) *mapping.DocumentMapping {
+	created := bleve.NewDateTimeFieldMapping()
+	updated := bleve.NewDateTimeFieldMapping()
+	revision := bleve.NewNumericFieldMapping()
+	writer := bleve.NewTextFieldMapping()
+	writer.Analyzer = "keyword"
+
+	metaMapping := bleve.NewDocumentStaticMapping()
+	for name, fieldMapping := range map[string]*mapping.FieldMapping{"created": created, "updated": updated, "revision": revision, "writer": writer} {
+		fieldMapping.IncludeInAll = false
+		metaMapping.AddFieldMappingsAt(name, fieldMapping)
+	}
+
+	documentMapping.AddSubDocumentMapping(metaFieldName, metaMapping)
+
+	return documentMapping
+}
+
+// GetWithMeta does the same as *Collection.Get but returns the metadata of the document
+func (c *Collection) GetWithMeta(id string, dest interface{}, options ...GetOption) (meta *DocMeta, err error) {
+	err = c.db.badger.View(func(txn *badger.Txn) error {
+		_, err := c.get(txn, id, dest, options...)
+		if err != nil {
+			return err
+		}
+
+		meta, err = c.getMeta(txn, id)
+		return err
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+
+	return meta, err
+}
+
+// GetMeta returns the metadata of the current document
+func (i *CollectionIterator) GetMeta() (*DocMeta, error) {
+	return i.c.getMeta(i.txn, i.GetID())
+}
+
+func (c *Collection) buildMetaKey(id string) []byte {
+	// Copy the prefix to prevent race
+	prefix := make([]byte, len(c.prefix))
+	copy(prefix, c.prefix)
+
+	key := append(prefix, prefixCollectionsMeta)
+	return append(key, []byte(id)...)
+}
+
+// getMetaAsBytes returns the JSON encoded metadata of the document or nil if there is none
+func (c *Collection) getMetaAsBytes(txn *badger.Txn, id string) ([]byte, error) {
+	return c.db.readMeta(txn, c.buildMetaKey(id))
+}
+
+// contentToIndex returns the document to index with its metadata if the index maps them
+func (c *Collection) contentToIndex(txn *badger.Txn, index *BleveIndex, id string, clearBytes []byte) (interface{}, error) {
+	if !index.indexesMeta() {
+		return c.fromValueBytesGetContentToIndex(clearBytes, nil), nil
+	}
+
+	meta, err := c.getMetaAsBytes(txn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.fromValueBytesGetContentToIndex(clearBytes, meta), nil
+}
+
+// indexesMeta returns true if the index mapping has the metadata mapping added by AddMetaMapping
+func (i *BleveIndex) indexesMeta() bool {
+	indexMapping, ok := i.bleveIndex.Mapping().(*mapping.IndexMappingImpl)
+	if !ok || indexMapping.DefaultMapping == nil {
+		return false
+	}
+
+	_, ok = indexMapping.DefaultMapping.Properties[metaFieldName]
+	return ok
+}
+
+func (c *Collection) getMeta(txn *badger.Txn, id string) (*DocMeta, error) {
+	asBytes, err := c.getMetaAsBytes(txn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := new(DocMeta)
+	if asBytes == nil {
+		return meta, nil
+	}
+
+	return meta, json.Unmarshal(asBytes, meta)
+}
+
+func (d *DB) readMeta(txn *badger.Txn, metaKey []byte) ([]byte, error) {
+	item, err := txn.Get(metaKey)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var encrypted []byte
+	encrypted, err = item.ValueCopy(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.Decrypt(d.privateKey, metaKey, encrypted)
+}
+
+// writeMeta updates the metadata of the document written by the operation.
+// It's called by the write loop so the revisions follow the writes order.
+func (d *DB) writeMeta(txn *badger.Txn, op *transaction.Operation) error {
+	if op.Delete {
+		return txn.Delete(op.MetaKey)
+	}
+
+	meta := new(DocMeta)
+	previous, err := d.readMeta(txn, op.MetaKey)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		err = json.Unmarshal(previous, meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if meta.Created.IsZero() {
+		meta.Created = now
+	}
+	meta.Updated = now
+	meta.Revision++
+	meta.Writer = op.Writer
+
+	op.Meta, err = json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	// The previous metadata are not kept
+	entry := badger.NewEntry(op.MetaKey, cipher.Encrypt(d.privateKey, op.MetaKey, op.Meta))
+	entry.WithDiscard()
+	return txn.SetEntry(entry)
+}
@@ -0,0 +1,188 @@
+package gotinydb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestDocumentMeta(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// The users are saved by openT
+	user := new(testUserStruct)
+	first, err := testCol.GetWithMeta(testUserID, user)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if first.Revision != 1 || first.Created.IsZero() || !first.Created.Equal(first.Updated) || first.Writer != "" || user.Email != testUser.Email {
+		t.Errorf("unexpected metadata %+v for %v", first, user)
+	}
+
+	// Index the documents before the updates
+	err = testCol.SetBleveIndex("meta", AddMetaMapping(bleve.NewDocumentStaticMapping()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	time.Sleep(time.Millisecond * 10)
+	since := time.Now()
+
+	batch, _ := testCol.NewBatch(WithWriter(context.Background(), "alice"))
+	batch.Put(testUserID, testUser)
+	batch.Put("new", testUser)
+	err = batch.Write()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	second, err := testCol.GetWithMeta(testUserID, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if second.Revision != 2 || !second.Created.Equal(first.Created) || !second.Updated.After(since) || second.Writer != "alice" {
+		t.Errorf("unexpected metadata %+v after %+v", second, first)
+	}
+
+	// The writer is the one of the last write
+	testCol.Put(testUserID, testUser)
+	third, _ := testCol.GetWithMeta(testUserID, nil)
+	if third.Revision != 3 || third.Writer != "" {
+		t.Errorf("unexpected metadata %+v", third)
+	}
+
+	// Recently changed documents
+	recent := bleve.NewDateRangeQuery(since, time.Time{})
+	recent.SetField("_meta.updated")
+	result, err := testCol.SearchPage("meta", recent, &SearchOptions{SortBy: []string{"_id"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Total() != 2 || result.BleveSearchResult.Hits[0].ID != "new" || result.BleveSearchResult.Hits[1].ID != testUserID {
+		t.Errorf("unexpected recently changed documents %v", result.BleveSearchResult.Hits)
+	}
+
+	writer := bleve.NewTermQuery("alice")
+	writer.SetField("_meta.writer")
+	result, err = testCol.SearchPage("meta", writer, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Total() != 1 || result.BleveSearchResult.Hits[0].ID != "new" {
+		t.Errorf("unexpected documents written by alice %v", result.BleveSearchResult.Hits)
+	}
+
+	// The rebuilt index has the same metadata
+	err = testCol.RebuildIndex("meta")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	result, err = testCol.SearchPage("meta", recent, nil)
+	if err != nil || result.Total() != 2 {
+		t.Errorf("unexpected result after rebuild %v %v", result, err)
+	}
+
+	iter := testCol.GetIterator()
+	defer iter.Close()
+	revisions := map[string]uint64{}
+	for ; iter.Valid(); iter.Next() {
+		meta, err := iter.GetMeta()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		revisions[iter.GetID()] = meta.Revision
+	}
+	if len(revisions) != 3 || revisions[testUserID] != 3 || revisions["new"] != 1 || revisions[cloneTestUserID] != 1 {
+		t.Errorf("unexpected revisions %v", revisions)
+	}
+
+	// The metadata are removed with the document
+	err = testCol.Delete(testUserID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = testCol.GetWithMeta(testUserID, nil); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+	testCol.Put(testUserID, testUser)
+	fourth, _ := testCol.GetWithMeta(testUserID, nil)
+	if fourth.Revision != 1 || !fourth.Created.After(third.Updated) {
+		t.Errorf("unexpected metadata %+v after delete", fourth)
+	}
+
+	// The writer of the single writes
+	checkWriter := func(step, expected string) {
+		meta, err := testCol.GetWithMeta(testUserID, nil)
+		if err != nil || meta.Writer != expected {
+			t.Errorf("%s: expected writer %q but got %+v %v", step, expected, meta, err)
+		}
+	}
+	testCol.Put(testUserID, testUser, AsWriter("bob"))
+	checkWriter("put", "bob")
+	testCol.Patch(testUserID, map[string]string{"name": "patched"}, AsWriter("carol"))
+	checkWriter("patch", "carol")
+	testCol.ApplyJSONPatch(testUserID, []JSONPatchOperation{{Op: "replace", Path: "/name", Value: "json patched"}}, AsWriter("dave"))
+	checkWriter("JSON patch", "dave")
+	testCol.Increment(testUserID, "visits", 1)
+	checkWriter("increment without writer", "")
+}
+
+func TestDocumentMetaNonObject(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// Existing documents which are not objects are skipped when the index is built
+	err = testCol.Put("array", []byte(`[1,2]`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = testCol.SetBleveIndex("meta", AddMetaMapping(bleve.NewDocumentStaticMapping()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = testCol.Put("scalar", []byte(`42`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = testCol.RebuildIndex("meta")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Only the objects are indexed with their metadata
+	q := bleve.NewNumericRangeQuery(&[]float64{1}[0], nil)
+	q.SetField("_meta.revision")
+	result, err := testCol.SearchPage("meta", q, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.BleveSearchResult.Total != 2 {
+		t.Errorf("expected %d documents but got %d", 2, result.BleveSearchResult.Total)
+	}
+}
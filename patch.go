@@ -0,0 +1,596 @@
+package gotinydb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/dgraph-io/badger"
+)
+
+type (
+	// JSONPatchOperation is an operation of a JSON Patch (RFC 6902).
+	// Op is one of "add", "remove", "replace", "move", "copy" or "test".
+	JSONPatchOperation struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		From  string      `json:"from,omitempty"`
+		Value interface{} `json:"value"`
+	}
+)
+
+// Patch applies the JSON Merge Patch (RFC 7396) to the document.
+// The patch can be JSON as a slice of bytes or any value which is converted to JSON.
+// It's applied to the latest version of the document by the write loop so it never
+// conflicts with the other writes. Only the indexes mapping the changed fields are updated.
+func (c *Collection) Patch(id string, mergePatch interface{}, options ...WriteOption) error {
+	patch, err := toJSONValue(mergePatch)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+	}
+
+	return c.patch(id, false, options, func(document interface{}) (interface{}, error) {
+		return mergePatchValue(document, patch), nil
+	})
+}
+
+// ApplyJSONPatch applies the JSON Patch (RFC 6902) operations to the document like *Collection.Patch.
+// The operations are applied in order and nothing is saved if one of them fails.
+// ErrPatchTestFailed is returned when a "test" operation does not match.
+func (c *Collection) ApplyJSONPatch(id string, ops []JSONPatchOperation, options ...WriteOption) error {
+	values := make([]interface{}, len(ops))
+	for i, op := range ops {
+		var err error
+		values[i], err = toJSONValue(op.Value)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPatch, err.Error())
+		}
+	}
+
+	return c.patch(id, false, options, func(document interface{}) (interface{}, error) {
+		var err error
+		for i, op := range ops {
+			// The value is copied because the next operations can modify it
+			document, err = applyJSONPatchOperation(document, op, copyJSONValue(values[i]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return document, nil
+	})
+}
+
+// patch sends the patch function to the write loop and updates the indexes.
+// With upsert a missing document is patched as an empty object.
+func (c *Collection) patch(id string, upsert bool, options []WriteOption, apply func(document interface{}) (interface{}, error)) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Those are set by the write loop
+	var previous, patched interface{}
+
+	op := transaction.NewOperation(id, nil, c.buildDBKey(id), nil, false, false)
+	op.MetaKey = c.buildMetaKey(id)
+	op.Writer = buildWriteOptions(options).writer
+	op.Upsert = upsert
+	op.Patch = func(current []byte) ([]byte, error) {
+		var document interface{} = map[string]interface{}{}
+		if current != nil {
+			var err error
+			previous, err = decodeJSONValue(current)
+			if err != nil {
+				return nil, err
+			}
+
+			// The patches modify the document so previous is kept untouched
+			document, _ = decodeJSONValue(current)
+		}
+
+		var err error
+		patched, err = apply(document)
+		if err != nil {
+			return nil, err
+		}
+
+		asBytes, err := json.Marshal(patched)
+		if err != nil {
+			return nil, err
+		}
+
+		return asBytes, c.validateDocument(id, asBytes)
+	}
+
+	tr := transaction.NewWithOperation(ctx, op)
+	err := c.putSendToWriteAndWaitForResponse(tr)
+	if err != nil {
+		return err
+	}
+
+	return c.indexPatch(tr, changedPaths(previous, patched, nil, nil))
+}
+
+// indexPatch updates the indexes which maps one of the changed paths
+func (c *Collection) indexPatch(tr *transaction.Transaction, changed [][]string) (err error) {
+	c.indexesLock.RLock()
+	defer c.indexesLock.RUnlock()
+
+	c.touchIndexesInBuild(tr)
+
+	op := tr.Operations[0]
+	for _, index := range c.bleveIndexes {
+		indexesMeta := index.indexesMeta()
+		if !indexesMeta && !index.mapsOneOf(changed) {
+			continue
+		}
+
+		var meta []byte
+		if indexesMeta {
+			meta = op.Meta
+		}
+
+		err = index.bleveIndex.Index(op.CollectionID, c.fromValueBytesGetContentToIndex(op.Value, meta))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, index := range c.vectorIndexes {
+		path := strings.Split(index.path, ".")
+		for _, changedPath := range changed {
+			if isPathPrefix(path, changedPath) || isPathPrefix(changedPath, path) {
+				err = index.update(tr.Operations)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyPatch sets the value of the operation from the saved document
+func (d *DB) applyPatch(txn *badger.Txn, op *transaction.Operation) error {
+	item, err := txn.Get(op.DBKey)
+	if err == badger.ErrKeyNotFound {
+		if op.Upsert {
+			op.Value, err = op.Patch(nil)
+			return err
+		}
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var encrypted []byte
+	encrypted, err = item.ValueCopy(encrypted)
+	if err != nil {
+		return err
+	}
+
+	current, err := d.decryptData(op.DBKey, encrypted)
+	if err != nil {
+		return err
+	}
+
+	op.Value, err = op.Patch(current)
+	return err
+}
+
+// mapsOneOf returns true if one of the paths is indexed by the index
+func (i *BleveIndex) mapsOneOf(paths [][]string) bool {
+	indexMapping, ok := i.bleveIndex.Mapping().(*mapping.IndexMappingImpl)
+	if !ok || indexMapping.DefaultMapping == nil {
+		return true
+	}
+
+	for _, path := range paths {
+		if documentMappingMaps(indexMapping.DefaultMapping, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentMappingMaps returns true if the path or a part of its value is indexed by the mapping
+func documentMappingMaps(documentMapping *mapping.DocumentMapping, path []string) bool {
+	current := documentMapping
+	for _, part := range path {
+		if !current.Enabled {
+			return false
+		}
+
+		sub, ok := current.Properties[part]
+		if !ok {
+			return current.Dynamic
+		}
+		if len(sub.Fields) != 0 {
+			return true
+		}
+		current = sub
+	}
+
+	// The changed value is an object, it's mapped if any of its fields can be
+	return current.Enabled && (current.Dynamic || len(current.Properties) != 0)
+}
+
+// changedPaths lists the paths of the values which are different between the two documents.
+// The arrays are compared as a whole since the indexes do not use the positions.
+func changedPaths(a, b interface{}, path []string, changed [][]string) [][]string {
+	objectA, okA := a.(map[string]interface{})
+	objectB, okB := b.(map[string]interface{})
+	if !okA || !okB {
+		if !jsonEqual(a, b) {
+			changed = append(changed, append([]string{}, path...))
+		}
+		return changed
+	}
+
+	for key, value := range objectA {
+		changed = changedPaths(value, objectB[key], append(path, key), changed)
+	}
+	for key := range objectB {
+		if _, ok := objectA[key]; !ok {
+			changed = append(changed, append(append([]string{}, path...), key))
+		}
+	}
+
+	return changed
+}
+
+func isPathPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergePatchValue applies the merge patch to the target as defined by RFC 7396
+func mergePatchValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatchValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+func applyJSONPatchOperation(document interface{}, op JSONPatchOperation, value interface{}) (interface{}, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s %q %s", ErrInvalidPatch, op.Op, op.Path, fmt.Sprintf(format, args...))
+	}
+
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	switch op.Op {
+	case "add":
+		return addAtPointer(document, path, value, invalid)
+	case "remove":
+		if len(path) == 0 {
+			return nil, invalid("can't remove the document")
+		}
+		document, _, err = removeAtPointer(document, path, invalid)
+		return document, err
+	case "replace":
+		if _, err = getAtPointer(document, path, invalid); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		return updateAtPointer(document, path[:len(path)-1], func(parent interface{}) (interface{}, error) {
+			switch typed := parent.(type) {
+			case map[string]interface{}:
+				typed[path[len(path)-1]] = value
+			case []interface{}:
+				i, _ := arrayIndex(path[len(path)-1], len(typed)-1)
+				typed[i] = value
+			}
+			return parent, nil
+		}, invalid)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, invalid(err.Error())
+		}
+
+		var moved interface{}
+		if op.Op == "move" {
+			if isPathPrefix(from, path) && len(from) != len(path) {
+				return nil, invalid("can't move a value into itself")
+			}
+			document, moved, err = removeAtPointer(document, from, invalid)
+		} else {
+			moved, err = getAtPointer(document, from, invalid)
+			moved = copyJSONValue(moved)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return addAtPointer(document, path, moved, invalid)
+	case "test":
+		current, err := getAtPointer(document, path, invalid)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, value) {
+			return nil, fmt.Errorf("%w: %q", ErrPatchTestFailed, op.Path)
+		}
+		return document, nil
+	}
+
+	return nil, invalid("is not a known operation")
+}
+
+func addAtPointer(document interface{}, path []string, value interface{}, invalid func(string, ...interface{}) error) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	last := path[len(path)-1]
+	return updateAtPointer(document, path[:len(path)-1], func(parent interface{}) (interface{}, error) {
+		switch typed := parent.(type) {
+		case map[string]interface{}:
+			typed[last] = value
+			return typed, nil
+		case []interface{}:
+			i := len(typed)
+			if last != "-" {
+				var err error
+				i, err = arrayIndex(last, len(typed))
+				if err != nil {
+					return nil, invalid(err.Error())
+				}
+			}
+			typed = append(typed, nil)
+			copy(typed[i+1:], typed[i:])
+			typed[i] = value
+			return typed, nil
+		}
+		return nil, invalid("the parent is not an object or an array")
+	}, invalid)
+}
+
+func removeAtPointer(document interface{}, path []string, invalid func(string, ...interface{}) error) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, document, nil
+	}
+
+	var removed interface{}
+	last := path[len(path)-1]
+	document, err := updateAtPointer(document, path[:len(path)-1], func(parent interface{}) (interface{}, error) {
+		switch typed := parent.(type) {
+		case map[string]interface{}:
+			value, ok := typed[last]
+			if !ok {
+				return nil, invalid("the value does not exist")
+			}
+			removed = value
+			delete(typed, last)
+			return typed, nil
+		case []interface{}:
+			i, err := arrayIndex(last, len(typed)-1)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			removed = typed[i]
+			return append(typed[:i], typed[i+1:]...), nil
+		}
+		return nil, invalid("the parent is not an object or an array")
+	}, invalid)
+
+	return document, removed, err
+}
+
+func getAtPointer(document interface{}, path []string, invalid func(string, ...interface{}) error) (interface{}, error) {
+	current := document
+	for _, token := range path {
+		switch typed := current.(type) {
+		case map[string]interface{}:
+			value, ok := typed[token]
+			if !ok {
+				return nil, invalid("the value does not exist")
+			}
+			current = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(typed)-1)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			current = typed[i]
+		default:
+			return nil, invalid("the value does not exist")
+		}
+	}
+	return current, nil
+}
+
+// updateAtPointer replaces the value at the path by the one returned by the function
+func updateAtPointer(document interface{}, path []string, fn func(interface{}) (interface{}, error), invalid func(string, ...interface{}) error) (interface{}, error) {
+	if len(path) == 0 {
+		return fn(document)
+	}
+
+	switch typed := document.(type) {
+	case map[string]interface{}:
+		child, ok := typed[path[0]]
+		if !ok {
+			return nil, invalid("the parent does not exist")
+		}
+		newChild, err := updateAtPointer(child, path[1:], fn, invalid)
+		if err != nil {
+			return nil, err
+		}
+		typed[path[0]] = newChild
+		return typed, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(typed)-1)
+		if err != nil {
+			return nil, invalid(err.Error())
+		}
+		newChild, err := updateAtPointer(typed[i], path[1:], fn, invalid)
+		if err != nil {
+			return nil, err
+		}
+		typed[i] = newChild
+		return typed, nil
+	}
+
+	return nil, invalid("the parent does not exist")
+}
+
+// arrayIndex parses the array index token which must be between 0 and max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%q is not a valid index", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%q is not a valid index", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("the index %d is out of range", i)
+	}
+	return i, nil
+}
+
+// parseJSONPointer returns the unescaped tokens of a JSON pointer (RFC 6901)
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("the pointer %q must start with \"/\"", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// toJSONValue converts the value as it would be decoded from JSON
+func toJSONValue(value interface{}) (interface{}, error) {
+	var asBytes []byte
+	switch typed := value.(type) {
+	case []byte:
+		asBytes = typed
+	case json.RawMessage:
+		asBytes = typed
+	default:
+		var err error
+		asBytes, err = json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return decodeJSONValue(asBytes)
+}
+
+// decodeJSONValue decodes the JSON and keeps the numbers as they are
+func decodeJSONValue(asBytes []byte) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewBuffer(asBytes))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	return value, err
+}
+
+func copyJSONValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			ret[key] = copyJSONValue(item)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(typed))
+		for i, item := range typed {
+			ret[i] = copyJSONValue(item)
+		}
+		return ret
+	}
+	return value
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case json.Number:
+		f, err := typed.Float64()
+		return f, err == nil
+	case float64:
+		return typed, true
+	}
+	return 0, false
+}
+
+// jsonEqual compares JSON values with the numbers compared by value
+func jsonEqual(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+
+	switch typedA := a.(type) {
+	case map[string]interface{}:
+		typedB, ok := b.(map[string]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for key, value := range typedA {
+			other, ok := typedB[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		typedB, ok := b.([]interface{})
+		if !ok || len(typedA) != len(typedB) {
+			return false
+		}
+		for i := range typedA {
+			if !jsonEqual(typedA[i], typedB[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
@@ -0,0 +1,224 @@
+package gotinydb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestPatch(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	nameMapping := bleve.NewTextFieldMapping()
+	nameMapping.Analyzer = "keyword"
+	names := bleve.NewDocumentStaticMapping()
+	names.AddFieldMappingsAt("name", nameMapping)
+	err = testCol.SetBleveIndex("names", names)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	emails := bleve.NewDocumentStaticMapping()
+	emails.AddFieldMappingsAt("email", bleve.NewTextFieldMapping())
+	err = testCol.SetBleveIndex("emails", emails)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Merge patch
+	err = testCol.Patch(testUserID, []byte(`{"name": "titi", "oauth": {"URL": null}, "age": 42}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	user := map[string]interface{}{}
+	meta, err := testCol.GetWithMeta(testUserID, &user)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	oauth, _ := user["oauth"].(map[string]interface{})
+	if user["name"] != "titi" || user["email"] != testUser.Email || fmt.Sprint(user["age"]) != "42" || len(oauth) != 1 || oauth["Name"] != "Github" || meta.Revision != 2 {
+		t.Errorf("unexpected patched document %v with %+v", user, meta)
+	}
+
+	// Only the index of the name is affected
+	nameIndex, _ := testCol.GetBleveIndex("names")
+	emailIndex, _ := testCol.GetBleveIndex("emails")
+	changed := [][]string{{"name"}, {"oauth", "URL"}}
+	if !nameIndex.mapsOneOf(changed) || emailIndex.mapsOneOf(changed) {
+		t.Errorf("unexpected affected indexes")
+	}
+
+	query := bleve.NewTermQuery("titi")
+	query.SetField("name")
+	result, err := testCol.SearchPage("names", query, nil)
+	if err != nil || result.Total() != 1 || result.BleveSearchResult.Hits[0].ID != testUserID {
+		t.Errorf("the patched document is not reindexed %v %v", result, err)
+	}
+
+	// JSON patch
+	err = testCol.ApplyJSONPatch(testUserID, []JSONPatchOperation{
+		{Op: "test", Path: "/name", Value: "titi"},
+		{Op: "add", Path: "/tags", Value: []string{"a", "c"}},
+		{Op: "add", Path: "/tags/1", Value: "b"},
+		{Op: "add", Path: "/tags/-", Value: "d"},
+		{Op: "copy", From: "/oauth", Path: "/backup"},
+		{Op: "move", From: "/age", Path: "/a~1ge"},
+		{Op: "replace", Path: "/oauth/Name", Value: "Gitlab"},
+		{Op: "remove", Path: "/tags/0"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	asBytes, _ := testCol.Get(testUserID, nil)
+	expected := `{"a/ge":42,"backup":{"Name":"Github"},"email":"userName@internet.org","name":"titi","oauth":{"Name":"Gitlab"},"tags":["b","c","d"]}`
+	if string(asBytes) != expected {
+		t.Errorf("expected %s but got %s", expected, asBytes)
+	}
+
+	// Nothing is saved when an operation fails
+	err = testCol.ApplyJSONPatch(testUserID, []JSONPatchOperation{
+		{Op: "replace", Path: "/name", Value: "tutu"},
+		{Op: "test", Path: "/email", Value: "other@internet.org"},
+	})
+	if !errors.Is(err, ErrPatchTestFailed) {
+		t.Errorf("expected %v but got %v", ErrPatchTestFailed, err)
+	}
+	for _, ops := range [][]JSONPatchOperation{
+		{{Op: "remove", Path: "/missing"}},
+		{{Op: "add", Path: "/tags/01", Value: "x"}},
+		{{Op: "move", From: "/oauth", Path: "/oauth/sub"}},
+		{{Op: "unknown", Path: "/name"}},
+		{{Op: "replace", Path: "name", Value: "x"}},
+	} {
+		if err = testCol.ApplyJSONPatch(testUserID, ops); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("expected %v with %v but got %v", ErrInvalidPatch, ops, err)
+		}
+	}
+	asBytes, _ = testCol.Get(testUserID, nil)
+	if string(asBytes) != expected {
+		t.Errorf("the failed patches changed the document %s", asBytes)
+	}
+
+	if err = testCol.Patch("missing", map[string]string{"name": "x"}); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+
+	// The schema is checked against the patched document
+	err = testCol.SetSchema([]byte(testSchema))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var validationErrs ValidationErrors
+	if err = testCol.Patch(cloneTestUserID, map[string]interface{}{"email": nil}); !errors.As(err, &validationErrs) {
+		t.Errorf("expected a validation error but got %v", err)
+	}
+	testCol.SetSchema(nil)
+
+	// The concurrent patches are applied to the latest version
+	testCol.Put("counter", map[string]interface{}{"list": []int{}})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := testCol.ApplyJSONPatch("counter", []JSONPatchOperation{{Op: "add", Path: "/list/-", Value: i}}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	counter := struct{ List []int }{}
+	meta, _ = testCol.GetWithMeta("counter", &counter)
+	if len(counter.List) != 20 || meta.Revision != 21 {
+		t.Errorf("unexpected result of the concurrent patches %v %+v", counter.List, meta)
+	}
+}
+
+func TestPatchToNonObject(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// A merge patch which is not an object replaces the document
+	err = testCol.Patch(testUserID, []byte(`[1,2]`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	asBytes, err := testCol.Get(testUserID, nil)
+	if err != nil || string(asBytes) != `[1,2]` {
+		t.Errorf("unexpected document %s with %v", asBytes, err)
+	}
+
+	// A JSON Patch which replaces the whole document
+	err = testCol.ApplyJSONPatch(cloneTestUserID, []JSONPatchOperation{{Op: "replace", Path: "", Value: "scalar"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	asBytes, err = testCol.Get(cloneTestUserID, nil)
+	if err != nil || string(asBytes) != `"scalar"` {
+		t.Errorf("unexpected document %s with %v", asBytes, err)
+	}
+
+	// The documents are not indexed anymore
+	if _, err = testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Email)); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+}
+
+func TestJSONPatchNullValue(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// The null value is kept when the patch is saved and loaded
+	asBytes, err := json.Marshal([]JSONPatchOperation{{Op: "add", Path: "/oauth", Value: nil}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !strings.Contains(string(asBytes), `"value":null`) {
+		t.Errorf("the null value is dropped from %s", asBytes)
+	}
+
+	ops := []JSONPatchOperation{}
+	err = json.Unmarshal(asBytes, &ops)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = testCol.ApplyJSONPatch(testUserID, ops)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	user := map[string]interface{}{}
+	_, err = testCol.Get(testUserID, &user)
+	if oauth, ok := user["oauth"]; err != nil || !ok || oauth != nil {
+		t.Errorf("expected a null oauth but got %v with %v", user, err)
+	}
+}
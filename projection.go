@@ -0,0 +1,118 @@
+package gotinydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+type (
+	// GetOption changes the way the documents are read by the getters, the iterators and the search results
+	GetOption func(*getOptions)
+
+	getOptions struct {
+		fields *projectionNode
+	}
+
+	// projectionNode is the tree of the projected paths.
+	// A node without children map keeps the all value.
+	projectionNode struct {
+		children map[string]*projectionNode
+	}
+)
+
+// Fields limits the returned documents to the given JSON paths like "name" or "address.city".
+// The paths do not go through the arrays and the missing values are omitted.
+// Only the selected values are decoded into the destination.
+func Fields(fields ...string) GetOption {
+	return func(o *getOptions) {
+		if len(fields) == 0 {
+			return
+		}
+		if o.fields == nil {
+			o.fields = &projectionNode{children: map[string]*projectionNode{}}
+		}
+		for _, field := range fields {
+			o.fields.add(strings.Split(field, "."))
+		}
+	}
+}
+
+func buildGetOptions(options []GetOption) *getOptions {
+	ret := new(getOptions)
+	for _, option := range options {
+		option(ret)
+	}
+	return ret
+}
+
+func (n *projectionNode) add(path []string) {
+	if len(path) == 1 {
+		n.children[path[0]] = new(projectionNode)
+		return
+	}
+
+	child, ok := n.children[path[0]]
+	if ok && child.children == nil {
+		// The all parent value is already kept
+		return
+	} else if !ok {
+		child = &projectionNode{children: map[string]*projectionNode{}}
+		n.children[path[0]] = child
+	}
+
+	child.add(path[1:])
+}
+
+// projectJSON returns the JSON document with only the values of the projection.
+func projectJSON(input []byte, node *projectionNode) ([]byte, error) {
+	object, err := projectObject(input, node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(object)
+}
+
+// projectObject decodes each object level of the projection into raw values.
+// The values which are not selected are kept raw and not decoded further.
+func projectObject(input []byte, node *projectionNode) (map[string]json.RawMessage, error) {
+	ret := map[string]json.RawMessage{}
+
+	// Only the objects have values to select
+	if trimmed := bytes.TrimSpace(input); len(trimmed) == 0 || trimmed[0] != '{' {
+		return ret, nil
+	}
+
+	object := map[string]json.RawMessage{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, child := range node.children {
+		value, ok := object[name]
+		if !ok {
+			continue
+		}
+
+		if child.children != nil {
+			var sub map[string]json.RawMessage
+			sub, err = projectObject(value, child)
+			if err != nil {
+				return nil, err
+			}
+			if len(sub) == 0 {
+				continue
+			}
+
+			value, err = json.Marshal(sub)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ret[name] = value
+	}
+
+	return ret, nil
+}
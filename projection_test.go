@@ -0,0 +1,111 @@
+package gotinydb
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestProjectJSON(t *testing.T) {
+	document := []byte(`{"name": "toto", "age": 42, "address": {"city": "Paris", "zip": "75000", "geo": {"lat": 1, "lon": 2}}, "tags": [{"a": 1}], "oauth": null}`)
+
+	tests := []struct {
+		fields   []string
+		expected string
+	}{
+		{[]string{"name"}, `{"name":"toto"}`},
+		{[]string{"name", "age", "missing"}, `{"age":42,"name":"toto"}`},
+		{[]string{"address.city", "address.geo.lat"}, `{"address":{"city":"Paris","geo":{"lat":1}}}`},
+		{[]string{"address.city", "address"}, `{"address":{"city":"Paris","zip":"75000","geo":{"lat":1,"lon":2}}}`},
+		{[]string{"address", "address.city"}, `{"address":{"city":"Paris","zip":"75000","geo":{"lat":1,"lon":2}}}`},
+		{[]string{"tags.a", "oauth.Name", "name.first", "address.missing"}, `{}`},
+		{[]string{"oauth"}, `{"oauth":null}`},
+	}
+
+	for _, test := range tests {
+		ret, err := projectJSON(document, buildGetOptions([]GetOption{Fields(test.fields...)}).fields)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(ret) != test.expected {
+			t.Errorf("%v: expected %s but got %s", test.fields, test.expected, ret)
+		}
+	}
+
+	ret, _ := projectJSON([]byte(`[1, 2]`), buildGetOptions([]GetOption{Fields("name")}).fields)
+	if string(ret) != `{}` {
+		t.Errorf("unexpected projection of an array %s", ret)
+	}
+}
+
+func TestGetFields(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	expected := `{"name":"toto","oauth":{"Name":"Github"}}`
+
+	user := new(testUserStruct)
+	content, err := testCol.Get(testUserID, user, Fields("name", "oauth.Name"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(content) != expected || user.Name != testUser.Name || user.Email != "" || user.Oauth.URL != "" {
+		t.Errorf("unexpected projection %s %+v", content, user)
+	}
+
+	meta, err := testCol.GetWithMeta(testUserID, nil, Fields("email"))
+	if err != nil || meta.Revision != 1 {
+		t.Errorf("unexpected metadata %+v %v", meta, err)
+	}
+
+	contents, _, err := testCol.GetMulti([]string{testUserID, cloneTestUserID}, nil, Fields("email"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, content := range contents {
+		if string(content) != `{"email":"userName@internet.org"}` {
+			t.Errorf("unexpected projection %s", content)
+		}
+	}
+
+	iter := testCol.GetIterator()
+	defer iter.Close()
+	for ; iter.Valid(); iter.Next() {
+		if content := iter.GetBytes(Fields("name")); string(content) != `{"name":"`+testUser.Name+`"}` && string(content) != `{"name":"`+cloneTestUser.Name+`"}` {
+			t.Errorf("unexpected projection %s", content)
+		}
+		user := new(testUserStruct)
+		if err = iter.GetValue(user, Fields("email")); err != nil || user.Name != "" || user.Email != testUser.Email {
+			t.Errorf("unexpected projection %+v %v", user, err)
+		}
+	}
+
+	err = testCol.SetBleveIndex("projection", bleve.NewDocumentMapping())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	result, err := testCol.SearchPage("projection", bleve.NewMatchQuery("toto"), &SearchOptions{SortBy: []string{"_id"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp, err := result.NextResponse(nil, Fields("name", "oauth.Name"))
+	if err != nil || string(resp.Content) != expected {
+		t.Errorf("unexpected projection %v %v", resp, err)
+	}
+
+	users := []*testUserStruct{}
+	result.position = 0
+	err = result.All(&users, Fields("oauth"))
+	if err != nil || len(users) != 2 || users[0].Name != "" || users[1].Oauth.URL != testUser.Oauth.URL {
+		t.Errorf("unexpected projection %v %v", users, err)
+	}
+}
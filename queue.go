@@ -0,0 +1,451 @@
+package gotinydb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/dgraph-io/badger"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Those constants defines the second level of prefixes of the queues
+const (
+	prefixQueueReady byte = iota
+	prefixQueueDead
+)
+
+type (
+	// Queue is a persistent FIFO queue. The messages are ordered by the time they become visible
+	// and a dequeued message is hidden until it's acknowledged or its visibility timeout expires.
+	// It's safe to use by many consumers of the same process.
+	Queue struct {
+		db     *DB
+		name   string
+		prefix []byte
+
+		// lock serializes the claims, the acknowledgements and the dead letters
+		lock        sync.Mutex
+		maxAttempts int
+
+		// lastID is the time in nanoseconds of the last message ID
+		lastID int64
+
+		waitLock sync.Mutex
+		// wait is closed when new messages are available
+		wait chan struct{}
+	}
+
+	// QueueMessage is a message returned by the queue
+	QueueMessage struct {
+		ID         string
+		Content    []byte
+		Attempts   int
+		EnqueuedAt time.Time
+
+		// receipt is the key of the message when it was returned
+		receipt []byte
+	}
+)
+
+// queuePollInterval is the longest wait of *Queue.Dequeue before looking for messages again
+var queuePollInterval = time.Second
+
+// Queue returns the queue with the given name. The queue is created with the first message.
+func (d *DB) Queue(name string) *Queue {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if q, ok := d.queues[name]; ok {
+		return q
+	}
+
+	hash := blake2b.Sum256([]byte(name))
+	q := &Queue{
+		db:          d,
+		name:        name,
+		prefix:      append([]byte{prefixQueues}, hash[:]...),
+		maxAttempts: QueueMaxAttempts,
+		wait:        make(chan struct{}),
+	}
+	d.queues[name] = q
+
+	return q
+}
+
+// Name returns the name of the queue
+func (q *Queue) Name() string {
+	return q.name
+}
+
+// SetMaxAttempts sets the number of deliveries before a message is moved to the dead letters.
+// Zero or a negative value keeps the messages until they are acknowledged.
+// The setting is not saved and the default is QueueMaxAttempts.
+func (q *Queue) SetMaxAttempts(n int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.maxAttempts = n
+}
+
+// Enqueue adds a message at the end of the queue and returns its ID.
+// The content is saved as is if it's a []byte or JSON encoded otherwise.
+func (q *Queue) Enqueue(content interface{}) (string, error) {
+	return q.EnqueueWithDelay(content, 0)
+}
+
+// EnqueueWithDelay does the same as *Queue.Enqueue but the message is not delivered before the delay
+func (q *Queue) EnqueueWithDelay(content interface{}, delay time.Duration) (string, error) {
+	asBytes, ok := content.([]byte)
+	if !ok {
+		var err error
+		asBytes, err = json.Marshal(content)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	id := q.newID()
+	msg := &QueueMessage{
+		ID:         hex.EncodeToString(id),
+		Content:    asBytes,
+		EnqueuedAt: time.Now(),
+	}
+
+	value, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	err = q.db.write(transaction.NewOperation("", nil, q.readyKey(msg.EnqueuedAt.Add(delay), id), value, false, false))
+	if err != nil {
+		return "", err
+	}
+
+	q.notify()
+	return msg.ID, nil
+}
+
+// Dequeue returns the first visible message and hides it for the visibility timeout.
+// It waits for a message until the context is done. The message must be acknowledged
+// with *Queue.Ack before the timeout or it's delivered again.
+func (q *Queue) Dequeue(ctx context.Context, visibilityTimeout time.Duration) (*QueueMessage, error) {
+	for {
+		// Taken before the claim to not miss a message enqueued meanwhile
+		wait := q.waitChan()
+
+		msg, next, err := q.claim(visibilityTimeout)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+
+		if next <= 0 || next > queuePollInterval {
+			next = queuePollInterval
+		}
+
+		timer := time.NewTimer(next)
+		select {
+		case <-wait:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-q.db.ctx.Done():
+			timer.Stop()
+			return nil, q.db.ctx.Err()
+		}
+		timer.Stop()
+	}
+}
+
+// Ack removes the message from the queue.
+// It returns ErrNotFound if the message was already acknowledged or delivered again.
+func (q *Queue) Ack(msg *QueueMessage) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	_, err := q.getValue(msg.receipt)
+	if err != nil {
+		return err
+	}
+
+	return q.db.write(transaction.NewOperation("", nil, msg.receipt, nil, true, false))
+}
+
+// Nack gives the message back to the queue to be delivered again after the delay.
+// If the message reached the maximum number of attempts it's moved to the dead letters.
+// It returns ErrNotFound if the message was already acknowledged or delivered again.
+func (q *Queue) Nack(msg *QueueMessage, delay time.Duration) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	value, err := q.getValue(msg.receipt)
+	if err != nil {
+		return err
+	}
+
+	id, _ := hex.DecodeString(msg.ID)
+	key := q.readyKey(time.Now().Add(delay), id)
+	if q.maxAttempts > 0 && msg.Attempts >= q.maxAttempts {
+		key = q.deadKey(id)
+	}
+
+	err = q.db.write(
+		transaction.NewOperation("", nil, msg.receipt, nil, true, false),
+		transaction.NewOperation("", nil, key, value, false, false),
+	)
+	if err != nil {
+		return err
+	}
+
+	q.notify()
+	return nil
+}
+
+// Len returns the number of messages waiting or in delivery
+func (q *Queue) Len() (n int, err error) {
+	err = q.db.badger.View(func(txn *badger.Txn) error {
+		iterOptions := badger.DefaultIteratorOptions
+		iterOptions.PrefetchValues = false
+		iter := txn.NewIterator(iterOptions)
+		defer iter.Close()
+
+		prefix := q.readyPrefix()
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			n++
+		}
+		return nil
+	})
+	return
+}
+
+// DeadLetters returns the messages which reached the maximum number of attempts
+func (q *Queue) DeadLetters() (messages []*QueueMessage, err error) {
+	err = q.db.badger.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		prefix := q.deadPrefix()
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			msg, err := q.decodeMessage(iter.Item())
+			if err != nil {
+				return err
+			}
+			messages = append(messages, msg)
+		}
+		return nil
+	})
+	return
+}
+
+// Requeue moves a message returned by *Queue.DeadLetters back to the queue with no attempt
+func (q *Queue) Requeue(msg *QueueMessage) error {
+	if !bytes.HasPrefix(msg.receipt, q.deadPrefix()) {
+		return ErrNotFound
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	value, err := q.getValue(msg.receipt)
+	if err != nil {
+		return err
+	}
+
+	saved := new(QueueMessage)
+	err = json.Unmarshal(value, saved)
+	if err != nil {
+		return err
+	}
+	saved.Attempts = 0
+
+	value, err = json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	id, _ := hex.DecodeString(msg.ID)
+	err = q.db.write(
+		transaction.NewOperation("", nil, msg.receipt, nil, true, false),
+		transaction.NewOperation("", nil, q.readyKey(time.Now(), id), value, false, false),
+	)
+	if err != nil {
+		return err
+	}
+
+	q.notify()
+	return nil
+}
+
+// Unmarshal decodes the JSON content of the message into the pointer
+func (m *QueueMessage) Unmarshal(dest interface{}) error {
+	return json.Unmarshal(m.Content, dest)
+}
+
+// claim returns the first visible message and moves it to the end of the visibility timeout.
+// The messages which reached the maximum number of attempts are moved to the dead letters.
+// If there is no visible message it returns the time before the next one if any.
+func (q *Queue) claim(visibilityTimeout time.Duration) (msg *QueueMessage, next time.Duration, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	ops := []*transaction.Operation{}
+
+	now := time.Now()
+	err = q.db.badger.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		prefix := q.readyPrefix()
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+
+			visibleAt, id := q.parseReadyKey(item.Key())
+			if visibleAt.After(now) {
+				next = visibleAt.Sub(now)
+				return nil
+			}
+
+			tmpMsg, err := q.decodeMessage(item)
+			if err != nil {
+				return err
+			}
+
+			ops = append(ops, transaction.NewOperation("", nil, item.KeyCopy(nil), nil, true, false))
+
+			if q.maxAttempts > 0 && tmpMsg.Attempts >= q.maxAttempts {
+				value, err := json.Marshal(tmpMsg)
+				if err != nil {
+					return err
+				}
+				ops = append(ops, transaction.NewOperation("", nil, q.deadKey(id), value, false, false))
+				continue
+			}
+
+			tmpMsg.Attempts++
+			tmpMsg.receipt = q.readyKey(now.Add(visibilityTimeout), id)
+
+			value, err := json.Marshal(tmpMsg)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, transaction.NewOperation("", nil, tmpMsg.receipt, value, false, false))
+
+			msg = tmpMsg
+			return nil
+		}
+
+		return nil
+	})
+	if err != nil || len(ops) == 0 {
+		return nil, next, err
+	}
+
+	err = q.db.write(ops...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return msg, next, nil
+}
+
+// getValue returns the clear value saved at the key or ErrNotFound
+func (q *Queue) getValue(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return q.db.getClearValue(key)
+}
+
+func (q *Queue) decodeMessage(item *badger.Item) (*QueueMessage, error) {
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err = q.db.decryptData(item.Key(), value)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(QueueMessage)
+	err = json.Unmarshal(value, msg)
+	if err != nil {
+		return nil, err
+	}
+	msg.receipt = item.KeyCopy(nil)
+
+	return msg, nil
+}
+
+// newID returns a time based ID bigger than the previous ones
+func (q *Queue) newID() []byte {
+	return nextTimeID(&q.lastID)
+}
+
+// nextTimeID returns the time in nanoseconds as a big endian ID bigger than the last one
+func nextTimeID(last *int64) []byte {
+	for {
+		tmpLast := atomic.LoadInt64(last)
+		now := time.Now().UnixNano()
+		if now <= tmpLast {
+			now = tmpLast + 1
+		}
+
+		if atomic.CompareAndSwapInt64(last, tmpLast, now) {
+			id := make([]byte, 8)
+			binary.BigEndian.PutUint64(id, uint64(now))
+			return id
+		}
+	}
+}
+
+// notify wakes up the consumers waiting for messages
+func (q *Queue) notify() {
+	q.waitLock.Lock()
+	defer q.waitLock.Unlock()
+
+	close(q.wait)
+	q.wait = make(chan struct{})
+}
+
+func (q *Queue) waitChan() chan struct{} {
+	q.waitLock.Lock()
+	defer q.waitLock.Unlock()
+
+	return q.wait
+}
+
+func (q *Queue) readyPrefix() []byte {
+	return append(append([]byte{}, q.prefix...), prefixQueueReady)
+}
+
+func (q *Queue) deadPrefix() []byte {
+	return append(append([]byte{}, q.prefix...), prefixQueueDead)
+}
+
+// readyKey returns the key of a message ordered by the time it becomes visible then by ID
+func (q *Queue) readyKey(visibleAt time.Time, id []byte) []byte {
+	key := q.readyPrefix()
+	key = append(key, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(key[len(key)-8:], uint64(visibleAt.UnixNano()))
+	return append(key, id...)
+}
+
+func (q *Queue) parseReadyKey(key []byte) (visibleAt time.Time, id []byte) {
+	key = key[len(q.prefix)+1:]
+	visibleAt = time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+	id = append([]byte{}, key[8:]...)
+	return
+}
+
+func (q *Queue) deadKey(id []byte) []byte {
+	return append(q.deadPrefix(), id...)
+}
@@ -0,0 +1,191 @@
+package gotinydb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	q := testDB.Queue("jobs")
+	if q != testDB.Queue("jobs") {
+		t.Errorf("the same queue must be returned")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err = q.Enqueue(map[string]int{"i": i}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// FIFO order
+	messages := []*QueueMessage{}
+	for i := 0; i < 3; i++ {
+		msg, err := q.Dequeue(ctx, time.Minute)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		content := map[string]int{}
+		if err = msg.Unmarshal(&content); err != nil || content["i"] != i || msg.Attempts != 1 {
+			t.Errorf("unexpected message %d %+v %v", i, msg, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if n, _ := q.Len(); n != 3 {
+		t.Errorf("expected %d messages in delivery but got %d", 3, n)
+	}
+
+	if err = q.Ack(messages[0]); err != nil {
+		t.Error(err)
+	}
+	if err = q.Ack(messages[0]); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+
+	// Given back with no delay
+	if err = q.Nack(messages[1], 0); err != nil {
+		t.Error(err)
+	}
+	msg, err := q.Dequeue(ctx, time.Millisecond*50)
+	if err != nil || msg.ID != messages[1].ID || msg.Attempts != 2 {
+		t.Errorf("unexpected message after nack %+v %v", msg, err)
+		return
+	}
+
+	// The visibility timeout expires and the message is delivered again
+	again, err := q.Dequeue(ctx, time.Minute)
+	if err != nil || again.ID != messages[1].ID || again.Attempts != 3 {
+		t.Errorf("unexpected message after timeout %+v %v", again, err)
+		return
+	}
+	if err = q.Ack(msg); err != ErrNotFound {
+		t.Errorf("the expired delivery must not be acknowledged: %v", err)
+	}
+	q.Ack(again)
+	q.Ack(messages[2])
+
+	if n, _ := q.Len(); n != 0 {
+		t.Errorf("expected no message but got %d", n)
+	}
+
+	// Delayed delivery
+	id, _ := q.EnqueueWithDelay("later", time.Millisecond*200)
+	shortCtx, shortCancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer shortCancel()
+	if _, err = q.Dequeue(shortCtx, time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	msg, err = q.Dequeue(ctx, time.Minute)
+	if err != nil || msg.ID != id || string(msg.Content) != `"later"` {
+		t.Errorf("unexpected delayed message %+v %v", msg, err)
+		return
+	}
+
+	// Dead letters
+	q.SetMaxAttempts(2)
+	q.Nack(msg, 0)
+	msg, _ = q.Dequeue(ctx, time.Minute)
+	if err = q.Nack(msg, 0); err != nil {
+		t.Error(err)
+	}
+
+	dead, err := q.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].ID != id || dead[0].Attempts != 2 {
+		t.Errorf("unexpected dead letters %v %v", dead, err)
+		return
+	}
+	if n, _ := q.Len(); n != 0 {
+		t.Errorf("expected no message but got %d", n)
+	}
+
+	if err = q.Requeue(dead[0]); err != nil {
+		t.Error(err)
+	}
+	if err = q.Requeue(msg); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+	msg, err = q.Dequeue(ctx, time.Minute)
+	if err != nil || msg.ID != id || msg.Attempts != 1 {
+		t.Errorf("unexpected requeued message %+v %v", msg, err)
+	}
+	if dead, _ = q.DeadLetters(); len(dead) != 0 {
+		t.Errorf("unexpected dead letters %v", dead)
+	}
+}
+
+func TestQueueConcurrentConsumers(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	q := testDB.Queue("concurrent")
+
+	nbMessages := 200
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lock sync.Mutex
+	received := map[string]int{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := q.Dequeue(ctx, time.Minute)
+				if err != nil {
+					return
+				}
+
+				lock.Lock()
+				received[msg.ID]++
+				done := len(received) == nbMessages
+				lock.Unlock()
+
+				if err = q.Ack(msg); err != nil {
+					t.Error(err)
+				}
+				if done {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < nbMessages; i++ {
+		if _, err = q.Enqueue(i); err != nil {
+			t.Error(err)
+		}
+	}
+
+	go func() {
+		time.Sleep(time.Second * 10)
+		cancel()
+	}()
+	wg.Wait()
+
+	if len(received) != nbMessages {
+		t.Errorf("expected %d messages but got %d", nbMessages, len(received))
+	}
+	for id, n := range received {
+		if n != 1 {
+			t.Errorf("the message %q was delivered %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package gotinydb
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/dgraph-io/badger"
+	"golang.org/x/crypto/blake2b"
+)
+
+type (
+	// indexBuild records the IDs written to the collection while a shadow
+	// index is built. Those IDs are replayed on the shadow before the swap.
+	indexBuild struct {
+		lock    *sync.Mutex
+		touched map[string]struct{}
+	}
+)
+
+func newIndexBuild() *indexBuild {
+	return &indexBuild{
+		lock:    new(sync.Mutex),
+		touched: map[string]struct{}{},
+	}
+}
+
+func (ib *indexBuild) touch(id string) {
+	ib.lock.Lock()
+	ib.touched[id] = struct{}{}
+	ib.lock.Unlock()
+}
+
+// flush returns the touched IDs and resets the list
+func (ib *indexBuild) flush() []string {
+	ib.lock.Lock()
+	defer ib.lock.Unlock()
+
+	ret := make([]string, 0, len(ib.touched))
+	for id := range ib.touched {
+		ret = append(ret, id)
+	}
+	ib.touched = map[string]struct{}{}
+
+	return ret
+}
+
+// touchIndexesInBuild saves the IDs of the transaction for every index in build.
+// The caller must hold the indexes lock.
+func (c *Collection) touchIndexesInBuild(tr *transaction.Transaction) {
+	if len(c.indexesInBuild) == 0 {
+		return
+	}
+
+	for _, op := range tr.Operations {
+		if op.CollectionID == "" {
+			continue
+		}
+		for _, build := range c.indexesInBuild {
+			build.touch(op.CollectionID)
+		}
+	}
+}
+
+// UpdateBleveIndexMapping replaces the mapping of an existing index.
+// A shadow index is built from a snapshot of the collection while the existing
+// one keeps serving queries and writes. The writes done in the meantime are
+// replayed on the shadow index which then replaces the old one.
+// The custom analysis of the index is kept.
+func (c *Collection) UpdateBleveIndexMapping(name string, documentMapping *mapping.DocumentMapping) error {
+	index, err := c.GetBleveIndex(name)
+	if err != nil {
+		return err
+	}
+
+	return c.updateBleveIndex(index, documentMapping, index.analysis)
+}
+
+// UpdateBleveIndexWithAnalysis replaces the mapping and the custom analysis of an existing index.
+// It works like *Collection.UpdateBleveIndexMapping.
+func (c *Collection) UpdateBleveIndexWithAnalysis(name string, documentMapping *mapping.DocumentMapping, analysis *IndexAnalysis) error {
+	index, err := c.GetBleveIndex(name)
+	if err != nil {
+		return err
+	}
+
+	return c.updateBleveIndex(index, documentMapping, analysis)
+}
+
+func (c *Collection) updateBleveIndex(index *BleveIndex, documentMapping *mapping.DocumentMapping, analysis *IndexAnalysis) error {
+	signatureCheck := newIndex(index.name)
+	signatureCheck.analysis = analysis
+	err := signatureCheck.buildSignature(documentMapping)
+	if err != nil {
+		return err
+	}
+
+	// Nothing to do if the definition did not change
+	if bytes.Equal(index.signature[:], signatureCheck.signature[:]) {
+		return nil
+	}
+
+	return c.rebuildIndex(index, documentMapping, analysis)
+}
+
+// RebuildIndex builds the index again from the saved documents with the same mapping.
+// It can be used to repair an index which is not consistent with the collection.
+// Like *Collection.UpdateBleveIndexMapping the collection stays usable during the rebuild.
+// The graph of a vector index is built again in memory and saved.
+func (c *Collection) RebuildIndex(name string) error {
+	index, err := c.GetBleveIndex(name)
+	if err == ErrIndexNotFound {
+		if vectorIndex, vectorErr := c.GetVectorIndex(name); vectorErr == nil {
+			return vectorIndex.rebuild()
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	return c.rebuildIndex(index, index.documentMapping(), index.analysis)
+}
+
+func (c *Collection) rebuildIndex(oldIndex *BleveIndex, documentMapping *mapping.DocumentMapping, analysis *IndexAnalysis) (err error) {
+	c.indexesLock.Lock()
+	if _, inBuild := c.indexesInBuild[oldIndex.name]; inBuild {
+		c.indexesLock.Unlock()
+		return ErrIndexInBuild
+	}
+	build := newIndexBuild()
+	c.indexesInBuild[oldIndex.name] = build
+	c.indexesLock.Unlock()
+
+	shadow, err := c.buildShadowIndex(oldIndex.name, documentMapping, analysis)
+	if err != nil {
+		c.indexesLock.Lock()
+		delete(c.indexesInBuild, oldIndex.name)
+		c.indexesLock.Unlock()
+		return err
+	}
+
+	// Clean the shadow if anything goes wrong
+	defer func() {
+		if err != nil {
+			c.indexesLock.Lock()
+			delete(c.indexesInBuild, oldIndex.name)
+			c.indexesLock.Unlock()
+
+			shadow.close()
+			c.db.deletePrefix(shadow.prefix)
+		}
+	}()
+
+	// The snapshot is taken after the build registration.
+	// Every write which is not part of the snapshot is then recorded.
+	err = c.indexAllValues(shadow)
+	if err != nil {
+		return err
+	}
+
+	// Catch up the writes done while the snapshot was indexed
+	err = c.catchUpIndex(shadow, build)
+	if err != nil {
+		return err
+	}
+
+	// Last catch up and swap with writes on hold
+	c.indexesLock.Lock()
+	err = c.catchUpIndex(shadow, build)
+	if err != nil {
+		c.indexesLock.Unlock()
+		return err
+	}
+
+	for i, index := range c.bleveIndexes {
+		if index == oldIndex {
+			c.bleveIndexes[i] = shadow
+		}
+	}
+	delete(c.indexesInBuild, oldIndex.name)
+	c.indexesLock.Unlock()
+
+	// Removes the old index once the searches started before the swap are done
+	oldIndex.readers.Wait()
+	oldIndex.close()
+	c.db.deletePrefix(oldIndex.prefix)
+
+	return c.db.saveConfig()
+}
+
+// buildShadowIndex builds a new empty index with the same name as an existing one
+// but with a different prefix and path
+func (c *Collection) buildShadowIndex(name string, documentMapping *mapping.DocumentMapping, analysis *IndexAnalysis) (*BleveIndex, error) {
+	index := newIndex(name)
+	index.collection = c
+	index.analysis = analysis
+	err := index.buildSignature(documentMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look for a free prefix
+	for try := 0; index.prefix == nil; try++ {
+		if try >= 100 {
+			return nil, ErrHashCollision
+		}
+
+		indexHash := blake2b.Sum256([]byte(fmt.Sprintf("%s%d%d", name, time.Now().UnixNano(), try)))
+		prefix := append(c.buildIndexPrefix(), indexHash[:2]...)
+
+		collision := false
+		c.indexesLock.RLock()
+		for _, i := range c.bleveIndexes {
+			if reflect.DeepEqual(i.prefix, prefix) {
+				collision = true
+				break
+			}
+		}
+		c.indexesLock.RUnlock()
+		if collision {
+			continue
+		}
+
+		index.prefix = prefix
+	}
+
+	// Make sure nothing is left from a previous interrupted build
+	err = c.db.deletePrefix(index.prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.buildBleveIndex(index, documentMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// catchUpIndex indexes the latest version of every document written since the last call
+func (c *Collection) catchUpIndex(index *BleveIndex, build *indexBuild) error {
+	ids := build.flush()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return c.indexDocuments(index, ids, nil)
+}
+
+// indexDocuments indexes the saved version of the given documents in one batch.
+// The documents which are not saved anymore and the removed ones are deleted from the index.
+func (c *Collection) indexDocuments(index *BleveIndex, ids, removed []string) error {
+	return c.db.badger.View(func(txn *badger.Txn) error {
+		batch := index.bleveIndex.NewBatch()
+
+		for _, id := range removed {
+			batch.Delete(id)
+		}
+
+		err := c.readDocuments(txn, ids, func(id string, clearBytes []byte) error {
+			if clearBytes == nil {
+				batch.Delete(id)
+				return nil
+			}
+
+			content, err := c.contentToIndex(txn, index, id, clearBytes)
+			if err != nil {
+				return err
+			}
+
+			return batch.Index(id, content)
+		})
+		if err != nil {
+			return err
+		}
+
+		return index.bleveIndex.Batch(batch)
+	})
+}
@@ -0,0 +1,247 @@
+package gotinydb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestUpdateBleveIndexMapping(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// The name is not indexed by the email index
+	_, err = testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Name))
+	if err != ErrNotFound {
+		t.Errorf("the name must not be indexed yet but got %v", err)
+		return
+	}
+
+	newMapping := bleve.NewDocumentStaticMapping()
+	newMapping.AddFieldMappingsAt("email", bleve.NewTextFieldMapping())
+	newMapping.AddFieldMappingsAt("name", bleve.NewTextFieldMapping())
+
+	// Write while the index is rebuilt
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			testCol.Put(fmt.Sprintf("concurrent %d", i), &testUserStruct{Name: fmt.Sprintf("concurrent%d", i)})
+		}
+	}()
+
+	err = testCol.UpdateBleveIndexMapping(testIndexName, newMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	wg.Wait()
+
+	_, err = testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Name))
+	if err != nil {
+		t.Errorf("the name must be indexed after the update: %s", err.Error())
+		return
+	}
+
+	searchResult, err := testCol.Search(testIndexName, bleve.NewMatchQuery("concurrent49"))
+	if err != nil {
+		t.Errorf("the concurrent writes must be indexed: %s", err.Error())
+		return
+	}
+	if l := searchResult.BleveSearchResult.Hits.Len(); l != 1 {
+		t.Errorf("expected 1 result but got %d", l)
+	}
+
+	// Same mapping again must be a no-op and the old mapping is now different
+	err = testCol.UpdateBleveIndexMapping(testIndexName, newMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = testCol.SetBleveIndex(testIndexName, newMapping)
+	if err != ErrNameAllreadyExists {
+		t.Errorf("expected %v but got %v", ErrNameAllreadyExists, err)
+	}
+
+	// The new index is saved in the configuration
+	testDB.Close()
+	testDB, err = Open(testPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testCol, err = testDB.Use(testColName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Name))
+	if err != nil {
+		t.Errorf("the name must be indexed after reopening: %s", err.Error())
+	}
+}
+
+func TestRebuildIndex(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// Corrupt the index
+	index, _ := testCol.GetBleveIndex(testIndexName)
+	index.bleveIndex.Delete(testUserID)
+	index.bleveIndex.Delete(cloneTestUserID)
+
+	_, err = testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Email))
+	if err != ErrNotFound {
+		t.Errorf("the index should be empty but got %v", err)
+		return
+	}
+
+	err = testCol.RebuildIndex(testIndexName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	searchResult, err := testCol.Search(testIndexName, bleve.NewMatchQuery(testUser.Email))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if l := searchResult.BleveSearchResult.Hits.Len(); l != 2 {
+		t.Errorf("expected 2 results but got %d", l)
+	}
+
+	err = testCol.RebuildIndex("not existing")
+	if err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+}
+
+func TestRebuildIndexWaitsForReaders(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// A search holds the index while it is rebuilt
+	oldIndex, release, err := testCol.useBleveIndex(testIndexName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- testCol.RebuildIndex(testIndexName)
+	}()
+
+	// The new index is swapped but the old one stays open
+	for {
+		index, _ := testCol.GetBleveIndex(testIndexName)
+		if index != oldIndex {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err = oldIndex.bleveIndex.Search(bleve.NewSearchRequest(bleve.NewMatchQuery(testUser.Email)))
+	if err != nil {
+		t.Errorf("the old index is closed before the end of the search: %s", err.Error())
+	}
+
+	select {
+	case err = <-done:
+		t.Errorf("the rebuild returned before the end of the search: %v", err)
+		return
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeleteIndex(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// An index in build can't be deleted
+	testCol.indexesLock.Lock()
+	testCol.indexesInBuild[testIndexName] = newIndexBuild()
+	testCol.indexesLock.Unlock()
+
+	if err = testCol.DeleteIndex(testIndexName); err != ErrIndexInBuild {
+		t.Errorf("expected %v but got %v", ErrIndexInBuild, err)
+	}
+
+	testCol.indexesLock.Lock()
+	delete(testCol.indexesInBuild, testIndexName)
+	testCol.indexesLock.Unlock()
+
+	// A search holds the index while it is deleted
+	oldIndex, release, err := testCol.useBleveIndex(testIndexName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- testCol.DeleteIndex(testIndexName)
+	}()
+
+	select {
+	case err = <-done:
+		t.Errorf("the deletion returned before the end of the search: %v", err)
+		return
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = oldIndex.bleveIndex.Search(bleve.NewSearchRequest(bleve.NewMatchQuery(testUser.Email)))
+	if err != nil {
+		t.Errorf("the index is closed before the end of the search: %s", err.Error())
+	}
+
+	release()
+	if err = <-done; err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err = testCol.DeleteIndex(testIndexName); err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+
+	// The deletion is saved in the configuration
+	testDB.Close()
+	testDB, err = Open(testPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testCol, err = testDB.Use(testColName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err = testCol.GetBleveIndex(testIndexName); err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+}
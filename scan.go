@@ -0,0 +1,174 @@
+package gotinydb
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/pb"
+)
+
+type (
+	// ScanOptions defines the concurrency, the range and the order of *Collection.Scan
+	ScanOptions struct {
+		// Goroutines is the number of goroutines reading and decrypting the documents.
+		// The default is the number of CPUs.
+		Goroutines int
+		// Prefix limits the scan to the IDs starting with the prefix
+		Prefix string
+		// Start is the first ID of the scan if not empty
+		Start string
+		// End is the ID where the scan stops, it's not part of the scan. Empty means the end of the collection.
+		End string
+		// Ordered calls the function in the IDs order. The documents are still decrypted concurrently
+		// but only one goroutine reads the collection.
+		Ordered bool
+	}
+
+	// ScanFunc is called by *Collection.Scan for every document.
+	// The calls are never concurrent. If an error is returned the scan stops and returns it.
+	ScanFunc func(id string, value []byte) error
+)
+
+// Scan calls fn with every document of the collection. The collection is read with Badger's Stream
+// framework so the documents are read and decrypted concurrently. Unless ScanOptions.Ordered is set
+// the documents are not in the IDs order. Every goroutine opens its own read transaction when the scan starts
+// so a write done meanwhile can be seen by some goroutines only.
+func (c *Collection) Scan(ctx context.Context, options *ScanOptions, fn ScanFunc) error {
+	if options == nil {
+		options = new(ScanOptions)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	goroutines := options.Goroutines
+	if goroutines <= 0 {
+		goroutines = runtime.NumCPU()
+	}
+
+	colPrefix := c.buildDBKey("")
+
+	// The IDs of the range share their common prefix
+	prefix := options.Prefix
+	if options.Start != "" && options.End != "" {
+		if common := commonPrefix(options.Start, options.End); len(common) > len(prefix) && strings.HasPrefix(common, prefix) {
+			prefix = common
+		}
+	}
+
+	stream := c.db.badger.NewStream()
+	stream.LogPrefix = "Collection.Scan"
+	stream.Prefix = c.buildDBKey(prefix)
+	stream.NumGo = goroutines
+
+	startKey := c.buildDBKey(options.Start)
+	endKey := c.buildDBKey(options.End)
+	afterPrefix := prefixUpperBound(stream.Prefix)
+
+	// The values are decrypted by the stream goroutines
+	decrypt := true
+	if options.Ordered {
+		stream.NumGo = 1
+		decrypt = false
+	}
+
+	stream.KeyToList = func(key []byte, iter *badger.Iterator) (*pb.KVList, error) {
+		// The iterator goes to the start of the range or stops after its end.
+		// The stream continues with the key of the iterator.
+		if options.Start != "" && bytes.Compare(key, startKey) < 0 {
+			iter.Seek(startKey)
+			return nil, nil
+		}
+		if options.End != "" && bytes.Compare(key, endKey) >= 0 {
+			iter.Seek(afterPrefix)
+			return nil, nil
+		}
+
+		// Only the last version is needed
+		item := iter.Item()
+		if item.IsDeletedOrExpired() {
+			return nil, nil
+		}
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if decrypt {
+			value, err = c.db.decryptData(key, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &pb.KVList{Kv: []*pb.KV{{Key: key, Value: value}}}, nil
+	}
+
+	stream.Send = func(list *pb.KVList) error {
+		if !decrypt {
+			err := c.decryptList(list, goroutines)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, kv := range list.Kv {
+			err := fn(string(kv.Key[len(colPrefix):]), kv.Value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return stream.Orchestrate(ctx)
+}
+
+// decryptList decrypts the values of the list in place with the given number of goroutines
+func (c *Collection) decryptList(list *pb.KVList, goroutines int) error {
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var firstErr error
+
+	kvs := make(chan *pb.KV, len(list.Kv))
+	for _, kv := range list.Kv {
+		kvs <- kv
+	}
+	close(kvs)
+
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for kv := range kvs {
+				value, err := c.db.decryptData(kv.Key, kv.Value)
+				if err != nil {
+					errLock.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errLock.Unlock()
+					continue
+				}
+				kv.Value = value
+			}
+		}()
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// commonPrefix returns the longest prefix of a and b
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
@@ -0,0 +1,108 @@
+package gotinydb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// Two batches because a single one does not fit into one Badger transaction
+	for i := 0; i < 1000; i += 500 {
+		batch, _ := testCol.NewBatch(context.Background())
+		for j := i; j < i+500; j++ {
+			batch.Put(fmt.Sprintf("doc %04d", j), map[string]int{"i": j})
+		}
+		err = batch.Write()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	testCol.Delete("doc 0010")
+
+	scan := func(options *ScanOptions) (ids []string) {
+		err := testCol.Scan(context.Background(), options, func(id string, value []byte) error {
+			if id != testUserID && id != cloneTestUserID && fmt.Sprintf(`{"i":%d}`, atoi(id[4:])) != string(value) {
+				t.Errorf("unexpected value %s for %q", value, id)
+			}
+			ids = append(ids, id)
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		return
+	}
+
+	ids := scan(&ScanOptions{Goroutines: 4})
+	if len(ids) != 1001 {
+		t.Errorf("expected %d documents but got %d", 1001, len(ids))
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if id == "doc 0010" {
+			t.Errorf("the deleted document is returned")
+		}
+	}
+
+	ids = scan(&ScanOptions{Ordered: true})
+	if len(ids) != 1001 || !sort.StringsAreSorted(ids) {
+		t.Errorf("the documents are not ordered")
+	}
+
+	ids = scan(&ScanOptions{Prefix: "doc 00", Start: "doc 0005", End: "doc 0015", Ordered: true})
+	if len(ids) != 9 || ids[0] != "doc 0005" || ids[8] != "doc 0014" {
+		t.Errorf("unexpected range %v", ids)
+	}
+
+	// The ranges without prefix in both orders
+	ids = scan(&ScanOptions{Start: "doc 0100", End: "doc 0200", Goroutines: 4})
+	sort.Strings(ids)
+	if len(ids) != 100 || ids[0] != "doc 0100" || ids[99] != "doc 0199" {
+		t.Errorf("unexpected range %v", ids)
+	}
+	ids = scan(&ScanOptions{End: "doc 0003", Goroutines: 4})
+	sort.Strings(ids)
+	if len(ids) != 3 || ids[0] != "doc 0000" || ids[2] != "doc 0002" {
+		t.Errorf("unexpected range %v", ids)
+	}
+	ids = scan(&ScanOptions{Start: "doc 0998", End: "e", Ordered: true})
+	if len(ids) != 2 || ids[0] != "doc 0998" || ids[1] != "doc 0999" {
+		t.Errorf("unexpected range %v", ids)
+	}
+
+	ids = scan(&ScanOptions{Prefix: "test"})
+	if len(ids) != 2 {
+		t.Errorf("unexpected prefix scan %v", ids)
+	}
+
+	// The function error stops the scan
+	stop := fmt.Errorf("stop")
+	count := 0
+	err = testCol.Scan(context.Background(), nil, func(id string, value []byte) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("expected %v after 1 call but got %v after %d", stop, err, count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = testCol.Scan(ctx, nil, func(string, []byte) error { return nil }); err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func atoi(s string) (i int) {
+	fmt.Sscanf(s, "%d", &i)
+	return
+}
@@ -0,0 +1,251 @@
+package gotinydb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dgraph-io/badger"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type (
+	// ValidationError is a violation of the collection schema.
+	// Pointer is the JSON pointer of the invalid value inside the document.
+	ValidationError struct {
+		// ID is the document ID
+		ID      string
+		Pointer string
+		// Keyword is the schema keyword which is not satisfied
+		Keyword string
+		Message string
+	}
+
+	// ValidationErrors is returned when a document does not match the collection schema
+	ValidationErrors []*ValidationError
+
+	// Schema is a compiled JSON Schema.
+	// The validation is done by github.com/xeipuuv/gojsonschema which supports the drafts 4, 6 and 7.
+	// The schema references are resolved by the library.
+	Schema struct {
+		raw    json.RawMessage
+		schema *gojsonschema.Schema
+	}
+)
+
+// schemaKeywords gives the schema keyword of the error types of gojsonschema
+var schemaKeywords = map[string]string{
+	"false":                           "false",
+	"required":                        "required",
+	"invalid_type":                    "type",
+	"number_any_of":                   "anyOf",
+	"number_one_of":                   "oneOf",
+	"number_all_of":                   "allOf",
+	"number_not":                      "not",
+	"missing_dependency":              "dependencies",
+	"const":                           "const",
+	"enum":                            "enum",
+	"array_no_additional_items":       "additionalItems",
+	"array_min_items":                 "minItems",
+	"array_max_items":                 "maxItems",
+	"unique":                          "uniqueItems",
+	"contains":                        "contains",
+	"array_min_properties":            "minProperties",
+	"array_max_properties":            "maxProperties",
+	"additional_property_not_allowed": "additionalProperties",
+	"invalid_property_pattern":        "patternProperties",
+	"invalid_property_name":           "propertyNames",
+	"string_gte":                      "minLength",
+	"string_lte":                      "maxLength",
+	"pattern":                         "pattern",
+	"format":                          "format",
+	"multiple_of":                     "multipleOf",
+	"number_gte":                      "minimum",
+	"number_gt":                       "exclusiveMinimum",
+	"number_lte":                      "maximum",
+	"number_lt":                       "exclusiveMaximum",
+	"condition_then":                  "then",
+	"condition_else":                  "else",
+}
+
+func (e *ValidationError) Error() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+
+	if e.ID != "" {
+		return fmt.Sprintf("%q at %s: %s", e.ID, pointer, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", pointer, e.Message)
+}
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "the document does not match the schema: " + strings.Join(messages, "; ")
+}
+
+// CompileSchema parses the given JSON Schema
+func CompileSchema(jsonSchema []byte) (*Schema, error) {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(jsonSchema))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSchema, err.Error())
+	}
+
+	return &Schema{
+		raw:    append(json.RawMessage{}, jsonSchema...),
+		schema: schema,
+	}, nil
+}
+
+// MarshalJSON returns the JSON Schema as given to CompileSchema
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return s.raw, nil
+}
+
+// Validate returns the violations of the given JSON document ordered by pointer
+func (s *Schema) Validate(document []byte) (ValidationErrors, error) {
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(document))
+	if err != nil {
+		return nil, err
+	}
+	if result.Valid() {
+		return nil, nil
+	}
+
+	errs := make(ValidationErrors, len(result.Errors()))
+	for i, resultErr := range result.Errors() {
+		errs[i] = newValidationError(resultErr)
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Pointer < errs[j].Pointer
+	})
+
+	return errs, nil
+}
+
+// newValidationError converts the error of gojsonschema
+func newValidationError(resultErr gojsonschema.ResultError) *ValidationError {
+	keyword, ok := schemaKeywords[resultErr.Type()]
+	if !ok {
+		keyword = resultErr.Type()
+	}
+
+	// The context is the list of the tokens after "(root)"
+	pointer := ""
+	tokens := strings.Split(resultErr.Context().String("\x00"), "\x00")
+	for _, token := range tokens[1:] {
+		pointer += "/" + escapePointer(token)
+	}
+
+	return &ValidationError{
+		Pointer: pointer,
+		Keyword: keyword,
+		Message: resultErr.Description(),
+	}
+}
+
+// SetSchema sets the JSON Schema the documents must match to be saved.
+// The existing documents are not checked, *Collection.ValidateAll reports them.
+// An empty schema removes the validation.
+func (c *Collection) SetSchema(jsonSchema []byte) error {
+	var schema *Schema
+	if len(bytes.TrimSpace(jsonSchema)) != 0 {
+		var err error
+		schema, err = CompileSchema(jsonSchema)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.schemaLock.Lock()
+	c.schema = schema
+	c.schemaLock.Unlock()
+
+	return c.db.saveConfig()
+}
+
+// GetSchema returns the schema of the collection or nil if there is none
+func (c *Collection) GetSchema() *Schema {
+	c.schemaLock.RLock()
+	defer c.schemaLock.RUnlock()
+
+	return c.schema
+}
+
+// ValidateAll checks every saved documents against the schema of the collection
+// and returns the violations. It returns nil if there is no schema.
+func (c *Collection) ValidateAll() (ValidationErrors, error) {
+	schema := c.GetSchema()
+	if schema == nil {
+		return nil, nil
+	}
+
+	ret := ValidationErrors{}
+	err := c.db.badger.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		colPrefix := c.buildDBKey("")
+		for iter.Seek(colPrefix); iter.ValidForPrefix(colPrefix); iter.Next() {
+			id := string(iter.Item().Key()[len(colPrefix):])
+
+			asBytes, err := c.get(txn, id, nil)
+			if err != nil {
+				return err
+			}
+
+			errs, err := schema.Validate(asBytes)
+			if err != nil {
+				ret = append(ret, &ValidationError{ID: id, Message: err.Error()})
+				continue
+			}
+			for _, validationErr := range errs {
+				validationErr.ID = id
+				ret = append(ret, validationErr)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return ret, nil
+}
+
+// validateDocument checks the document to save against the schema if any
+func (c *Collection) validateDocument(id string, document []byte) error {
+	schema := c.GetSchema()
+	if schema == nil {
+		return nil
+	}
+
+	errs, err := schema.Validate(document)
+	if err != nil {
+		return err
+	}
+	if errs == nil {
+		return nil
+	}
+
+	for _, validationErr := range errs {
+		validationErr.ID = id
+	}
+	return errs
+}
+
+// escapePointer escapes a JSON pointer token
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,165 @@
+package gotinydb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["name", "email"],
+	"properties": {
+		"name": {"type": "string", "minLength": 2},
+		"email": {"type": "string", "format": "email"},
+		"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+		"tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true},
+		"oauth": {"oneOf": [{"type": "null"}, {"$ref": "#/definitions/account"}]}
+	},
+	"definitions": {
+		"account": {
+			"type": "object",
+			"required": ["Name"],
+			"properties": {"Name": {"enum": ["Github", "Gitlab"]}, "URL": {"type": "string", "format": "uri"}},
+			"additionalProperties": false
+		}
+	}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := CompileSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		document string
+		pointers []string
+		keywords []string
+	}{
+		{`{"name": "toto", "email": "toto@internet.org"}`, nil, nil},
+		{`{"name": "toto", "email": "toto@internet.org", "age": 42, "tags": ["a", "b"], "oauth": {"Name": "Github", "URL": "https://github.com"}}`, nil, nil},
+		{`{"name": "toto", "email": "toto@internet.org", "oauth": null}`, nil, nil},
+		{`[]`, []string{""}, []string{"type"}},
+		{`{"name": "t"}`, []string{"", "/name"}, []string{"required", "minLength"}},
+		{`{"name": "toto", "email": "not an email", "age": 4.5}`, []string{"/age", "/email"}, []string{"type", "format"}},
+		{`{"name": "toto", "email": "toto@internet.org", "age": 150, "tags": ["a", "a", 1]}`, []string{"/age", "/tags", "/tags/2"}, []string{"exclusiveMaximum", "uniqueItems", "type"}},
+		{`{"name": "toto", "email": "toto@internet.org", "oauth": {"Name": "Bitbucket", "Other": 1}}`, []string{"/oauth", "/oauth", "/oauth/Name"}, []string{"oneOf", "additionalProperties", "enum"}},
+	}
+
+	for i, test := range tests {
+		errs, err := schema.Validate([]byte(test.document))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if len(errs) != len(test.pointers) {
+			t.Errorf("%d: expected %d errors but got %v", i, len(test.pointers), errs)
+			continue
+		}
+		for j, validationErr := range errs {
+			if validationErr.Pointer != test.pointers[j] || validationErr.Keyword != test.keywords[j] {
+				t.Errorf("%d: expected %q at %q but got %q at %q", i, test.keywords[j], test.pointers[j], validationErr.Keyword, validationErr.Pointer)
+			}
+		}
+	}
+
+	// Recursive references and escaped pointers
+	schema, err = CompileSchema([]byte(`{
+		"$ref": "#/definitions/node",
+		"definitions": {"node": {"type": "object", "properties": {"a/b": {"type": "integer"}, "children": {"type": "array", "items": {"$ref": "#/definitions/node"}}}}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, _ := schema.Validate([]byte(`{"children": [{"children": [{"a/b": "x"}]}]}`))
+	if len(errs) != 1 || errs[0].Pointer != "/children/0/children/0/a~1b" {
+		t.Errorf("unexpected errors %v", errs)
+	}
+
+	for _, invalid := range []string{`{`, `"string"`, `{"type": "unknown"}`, `{"minLength": -1}`, `{"$ref": "#/missing"}`, `{"pattern": "("}`} {
+		if _, err = CompileSchema([]byte(invalid)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("expected %v with %s but got %v", ErrInvalidSchema, invalid, err)
+		}
+	}
+}
+
+func TestCollectionSchema(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	// An existing document is not valid
+	testCol.Put("invalid", map[string]interface{}{"name": "x"})
+
+	err = testCol.SetSchema([]byte(testSchema))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = testCol.Put("bad email", &testUserStruct{Name: "toto", Email: "toto"})
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].ID != "bad email" || errs[0].Pointer != "/email" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = testCol.Get("bad email", nil); err != ErrNotFound {
+		t.Errorf("the invalid document is saved")
+	}
+
+	batch, _ := testCol.NewBatch(context.Background())
+	if err = batch.Put("valid", testUser); err != nil {
+		t.Error(err)
+	}
+	var validationErrs ValidationErrors
+	if err = batch.Put("no name", map[string]interface{}{"email": "a@b.c"}); !errors.As(err, &validationErrs) || validationErrs[0].Keyword != "required" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = batch.Write(); err != nil {
+		t.Error(err)
+	}
+
+	// The schema is saved with the configuration
+	testDB.Close()
+	testDB, err = Open(testPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	testCol, err = testDB.Use(testColName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if testCol.GetSchema() == nil {
+		t.Errorf("the schema is not loaded")
+		return
+	}
+	if err = testCol.Put("bad email", &testUserStruct{Name: "toto", Email: "toto"}); err == nil {
+		t.Errorf("expected a validation error")
+	}
+
+	errs, err = testCol.ValidateAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(errs) != 2 || errs[0].ID != "invalid" || errs[0].Keyword != "required" || errs[1].Pointer != "/name" {
+		t.Errorf("unexpected violations %v", errs)
+	}
+
+	// The schema is removed
+	err = testCol.SetSchema(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err = testCol.Put("bad email", &testUserStruct{Name: "toto", Email: "toto"}); err != nil {
+		t.Error(err)
+	}
+	if errs, err = testCol.ValidateAll(); errs != nil || err != nil {
+		t.Errorf("unexpected result without schema %v %v", errs, err)
+	}
+}
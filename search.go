@@ -1,8 +1,12 @@
 package gotinydb
 
 import (
+	"reflect"
+
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/dgraph-io/badger"
 )
 
 type (
@@ -13,49 +17,355 @@ type (
 
 		position int
 		c        *Collection
+		// collections is used by *DB.Search to find the collection of every hits.
+		// The key is the Bleve index name.
+		collections map[string]*Collection
 	}
 
 	// Response are returned by *SearchResult.NextResponse if the caller needs to
 	// have access to the byte stream
 	Response struct {
 		ID            string
+		Collection    string
 		Content       []byte
 		DocumentMatch *search.DocumentMatch
+		// Distance is the distance to the searched vector set by *Collection.NearestNeighbors
+		// or the distance in meters of the geo point when the hits are sorted by distance
+		Distance float64
+	}
+
+	// IndexRef defines an index of a collection as a target of *DB.Search
+	IndexRef struct {
+		Collection string
+		Index      string
+	}
+
+	// SearchOptions defines the paging, sorting and the extra informations
+	// returned by *Collection.SearchPage and *Collection.NewSearchIterator
+	SearchOptions struct {
+		// From is the number of hits to skip
+		From int
+		// Size is the number of hits per page. The default is 10.
+		Size int
+		// SortBy defines the sort order.
+		// Fields can be prefixed by "-" for descending order and "_id" or "_score" can be used.
+		SortBy []string
+		// SortByDistance sorts the hits by distance before the SortBy fields.
+		// Response.Distance is set with the distance of every hits.
+		SortByDistance *GeoDistanceSort
+		// Highlight sets the highlight style ("html" or "ansi").
+		// The highlighted fields needs to be stored in the index.
+		// The fields of the dynamic mappings are never stored.
+		Highlight string
+		// HighlightFields limits the highlight to the given fields
+		HighlightFields []string
+		// Facets defines the facets to compute by name
+		Facets map[string]*bleve.FacetRequest
+		// Fields lists the stored fields to return with the hits.
+		// The fields which are not stored are not returned.
+		Fields []string
+	}
+
+	// SearchIterator provides a way to list all the hits of a query.
+	// The pages are fetched transparently when the previous one is consumed.
+	SearchIterator struct {
+		c             *Collection
+		indexName     string
+		searchRequest *bleve.SearchRequest
+
+		current *SearchResult
 	}
 )
 
+// defaultSearchSize is used when SearchOptions.Size is not set
+const defaultSearchSize = 10
+
+// BuildRequest returns the Bleve search request for the given query
+func (o *SearchOptions) BuildRequest(q query.Query) *bleve.SearchRequest {
+	if o == nil {
+		o = new(SearchOptions)
+	}
+
+	size := o.Size
+	if size <= 0 {
+		size = defaultSearchSize
+	}
+	from := o.From
+	if from < 0 {
+		from = 0
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(q, size, from, false)
+
+	if o.SortByDistance != nil {
+		order := search.SortOrder{o.SortByDistance.searchSort()}
+		order = append(order, search.ParseSortOrderStrings(o.SortBy)...)
+		searchRequest.SortByCustom(order)
+	} else if len(o.SortBy) != 0 {
+		searchRequest.SortBy(o.SortBy)
+	}
+
+	if o.Highlight != "" {
+		searchRequest.Highlight = bleve.NewHighlightWithStyle(o.Highlight)
+		for _, field := range o.HighlightFields {
+			searchRequest.Highlight.AddField(field)
+		}
+	}
+
+	for name, facet := range o.Facets {
+		searchRequest.AddFacet(name, facet)
+	}
+
+	searchRequest.Fields = o.Fields
+
+	return searchRequest
+}
+
+// SearchPage runs the query with the given options.
+// Unlike *Collection.Search it returns an empty result if nothing matches.
+func (c *Collection) SearchPage(indexName string, q query.Query, options *SearchOptions) (*SearchResult, error) {
+	return c.search(indexName, options.BuildRequest(q))
+}
+
+// NewSearchIterator returns an iterator over all the hits of the query.
+// The options defines the first hit and the page size.
+func (c *Collection) NewSearchIterator(indexName string, q query.Query, options *SearchOptions) (*SearchIterator, error) {
+	// Check the index exists
+	_, err := c.GetBleveIndex(indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchIterator{
+		c:             c,
+		indexName:     indexName,
+		searchRequest: options.BuildRequest(q),
+	}, nil
+}
+
+// Total returns the number of documents matching the query
+func (s *SearchResult) Total() uint64 {
+	return s.BleveSearchResult.Total
+}
+
+// All fills up the slice pointed by dest with all the hits of the result.
+// The slice elements can be values or pointers. Every documents are loaded
+// with one read transaction. The hits which are not saved anymore are skipped.
+// The options like Fields can limit the loaded content.
+func (s *SearchResult) All(dest interface{}, options ...GetOption) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return ErrNotSlicePointer
+	}
+
+	sliceValue := destValue.Elem()
+	elemType := sliceValue.Type().Elem()
+	isPointer := elemType.Kind() == reflect.Ptr
+	if isPointer {
+		elemType = elemType.Elem()
+	}
+
+	hits := s.BleveSearchResult.Hits
+	if len(hits) == 0 {
+		return nil
+	}
+
+	fields := buildGetOptions(options).fields
+
+	return s.getCollection(hits[0]).db.badger.View(func(txn *badger.Txn) error {
+		for _, hit := range hits {
+			c := s.getCollection(hit)
+
+			newElem := reflect.New(elemType)
+
+			caller, err := c.buildGetCaller(txn, hit.ID, newElem.Interface())
+			if err != nil {
+				return err
+			}
+			caller.fields = fields
+
+			err = c.getEncrypted(txn, caller)
+			if err == badger.ErrKeyNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			err = c.decryptAndUnmarshal(caller)
+			if err != nil {
+				return err
+			}
+
+			if isPointer {
+				sliceValue = reflect.Append(sliceValue, newElem)
+			} else {
+				sliceValue = reflect.Append(sliceValue, newElem.Elem())
+			}
+		}
+
+		destValue.Elem().Set(sliceValue)
+		return nil
+	})
+}
+
+// Search runs the search request over all the given indexes.
+// The indexes can be part of different collections and the hits are merged
+// into one result. *SearchResult.NextResponse gives the collection of every hits.
+func (d *DB) Search(targets []IndexRef, searchRequest *bleve.SearchRequest) (*SearchResult, error) {
+	if len(targets) == 0 {
+		return nil, ErrIndexNotFound
+	}
+
+	indexes := make([]bleve.Index, 0, len(targets))
+	collections := map[string]*Collection{}
+	for _, target := range targets {
+		col, err := d.getCollection(target.Collection)
+		if err != nil {
+			return nil, err
+		}
+
+		index, release, err := col.useBleveIndex(target.Index)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		name := index.bleveIndex.Name()
+		if savedCol, ok := collections[name]; ok {
+			// The same target is given twice
+			if savedCol == col {
+				continue
+			}
+			return nil, ErrHashCollision
+		}
+
+		collections[name] = col
+		indexes = append(indexes, index.bleveIndex)
+	}
+
+	alias := bleve.NewIndexAlias(indexes...)
+
+	var err error
+	ret := new(SearchResult)
+	ret.BleveSearchResult, err = alias.Search(searchRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.BleveSearchResult.Hits.Len() == 0 {
+		return nil, ErrNotFound
+	}
+
+	ret.collections = collections
+
+	return ret, nil
+}
+
 // Next fills up the destination by marshaling the saved byte stream.
 // It returns an error if any and the coresponding id of the element.
-func (s *SearchResult) Next(dest interface{}) (id string, err error) {
-	id, _, _, err = s.next(dest)
+// The options like Fields can limit the returned content.
+func (s *SearchResult) Next(dest interface{}, options ...GetOption) (id string, err error) {
+	id, _, _, err = s.next(dest, options)
 	return id, err
 }
 
 // NextResponse fills up the destination by marshaling the saved byte stream.
 // It returns the byte stream and the id of the document inside a Response pointer or an error if any.
-func (s *SearchResult) NextResponse(dest interface{}) (resp *Response, _ error) {
+func (s *SearchResult) NextResponse(dest interface{}, options ...GetOption) (resp *Response, _ error) {
 	resp = new(Response)
-	id, content, docMatch, err := s.next(dest)
+	id, content, docMatch, err := s.next(dest, options)
 	if err != nil {
 		return nil, err
 	}
 
 	resp.ID = id
+	resp.Collection = s.getCollection(docMatch).name
 	resp.Content = content
 	resp.DocumentMatch = docMatch
+	if distance, ok := geoDistance(s.BleveSearchResult.Request, docMatch); ok {
+		resp.Distance = distance
+	}
 	return resp, err
 }
 
-func (s *SearchResult) next(dest interface{}) (id string, content []byte, docMatch *search.DocumentMatch, err error) {
+func (s *SearchResult) next(dest interface{}, options []GetOption) (id string, content []byte, docMatch *search.DocumentMatch, err error) {
 	if s.position >= s.BleveSearchResult.Hits.Len() {
 		return "", nil, nil, ErrEndOfQueryResult
 	}
 
 	docMatch = s.BleveSearchResult.Hits[s.position]
 	id = docMatch.ID
-	content, err = s.c.Get(id, dest)
+	content, err = s.getCollection(docMatch).Get(id, dest, options...)
 
 	s.position++
 
 	return
 }
+
+// getCollection returns the collection the hit is coming from
+func (s *SearchResult) getCollection(docMatch *search.DocumentMatch) *Collection {
+	if s.collections != nil {
+		if col, ok := s.collections[docMatch.Index]; ok {
+			return col
+		}
+	}
+	return s.c
+}
+
+// Next fills up the destination with the next hit.
+// It returns ErrEndOfQueryResult when all the hits has been returned.
+func (i *SearchIterator) Next(dest interface{}, options ...GetOption) (id string, err error) {
+	resp, err := i.NextResponse(dest, options...)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// NextResponse does the same as *SearchIterator.Next but returns a Response pointer
+func (i *SearchIterator) NextResponse(dest interface{}, options ...GetOption) (*Response, error) {
+	if i.current == nil || i.current.position >= i.current.BleveSearchResult.Hits.Len() {
+		err := i.nextPage()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return i.current.NextResponse(dest, options...)
+}
+
+// Total returns the number of documents matching the query.
+// It runs the first search if needed.
+func (i *SearchIterator) Total() (uint64, error) {
+	if i.current == nil {
+		err := i.nextPage()
+		if err != nil && err != ErrEndOfQueryResult {
+			return 0, err
+		}
+	}
+
+	return i.current.Total(), nil
+}
+
+// nextPage loads the next page of hits
+func (i *SearchIterator) nextPage() error {
+	if i.current != nil {
+		// This was the last page
+		if i.current.BleveSearchResult.Hits.Len() < i.searchRequest.Size {
+			return ErrEndOfQueryResult
+		}
+		i.searchRequest.From += i.searchRequest.Size
+	}
+
+	result, err := i.c.search(i.indexName, i.searchRequest)
+	if err != nil {
+		return err
+	}
+	i.current = result
+
+	if result.BleveSearchResult.Hits.Len() == 0 {
+		return ErrEndOfQueryResult
+	}
+
+	return nil
+}
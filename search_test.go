@@ -0,0 +1,248 @@
+package gotinydb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestDBSearch(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	ticketCol, err := testDB.Use("tickets")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ticketMapping := bleve.NewDocumentStaticMapping()
+	ticketMapping.AddFieldMappingsAt("email", bleve.NewTextFieldMapping())
+	err = ticketCol.SetBleveIndex("reporter", ticketMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ticket := &struct {
+		Title string `json:"title"`
+		Email string `json:"email"`
+	}{"broken link", testUser.Email}
+	err = ticketCol.Put("ticket 1", ticket)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	targets := []IndexRef{
+		{testColName, testIndexName},
+		{"tickets", "reporter"},
+		// Duplicates are ignored
+		{"tickets", "reporter"},
+	}
+
+	searchRequest := bleve.NewSearchRequest(bleve.NewMatchQuery(testUser.Email))
+	searchRequest.SortBy([]string{"_id"})
+	searchResult, err := testDB.Search(targets, searchRequest)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []struct{ id, col string }{
+		{testUserID, testColName},
+		{cloneTestUserID, testColName},
+		{"ticket 1", "tickets"},
+	}
+	if l := searchResult.BleveSearchResult.Hits.Len(); l != len(expected) {
+		t.Errorf("expected %d hits but got %d", len(expected), l)
+		return
+	}
+
+	for _, e := range expected {
+		var resp *Response
+		resp, err = searchResult.NextResponse(nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if resp.ID != e.id || resp.Collection != e.col {
+			t.Errorf("expected %q from %q but got %q from %q", e.id, e.col, resp.ID, resp.Collection)
+		}
+		if len(resp.Content) == 0 {
+			t.Errorf("the content of %q must be loaded from %q", resp.ID, resp.Collection)
+		}
+	}
+
+	_, err = testDB.Search([]IndexRef{{"not existing", testIndexName}}, searchRequest)
+	if err != ErrCollectionNotFound {
+		t.Errorf("expected %v but got %v", ErrCollectionNotFound, err)
+	}
+	_, err = testDB.Search([]IndexRef{{"tickets", "not existing"}}, searchRequest)
+	if err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+}
+
+func TestSearchPageAndIterator(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	batch, _ := testCol.NewBatch(context.Background())
+	for i := 0; i < 25; i++ {
+		batch.Put(fmt.Sprintf("page user %02d", i), &testUserStruct{Name: "paginated", Email: fmt.Sprintf("user%d@page.org", i)})
+	}
+	err = batch.Write()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	q := bleve.NewMatchQuery("paginated")
+	q.SetField("name")
+
+	// Third page
+	options := &SearchOptions{From: 20, Size: 10, SortBy: []string{"_id"}}
+	searchResult, err := testCol.SearchPage("all", q, options)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if searchResult.Total() != 25 {
+		t.Errorf("expected %d matching documents but got %d", 25, searchResult.Total())
+	}
+
+	users := []testUserStruct{}
+	err = searchResult.All(&users)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(users) != 5 {
+		t.Errorf("expected %d users but got %d", 5, len(users))
+		return
+	}
+	if users[0].Email != "user20@page.org" {
+		t.Errorf("expected the first user of the page to be %q but got %q", "user20@page.org", users[0].Email)
+	}
+
+	userPointers := []*testUserStruct{}
+	err = searchResult.All(&userPointers)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(userPointers) != 5 || userPointers[4].Email != "user24@page.org" {
+		t.Errorf("unexpected pointers %v", userPointers)
+	}
+
+	if err = searchResult.All(users); err != ErrNotSlicePointer {
+		t.Errorf("expected %v but got %v", ErrNotSlicePointer, err)
+	}
+
+	// Iterate over all pages
+	iter, err := testCol.NewSearchIterator("all", q, &SearchOptions{Size: 7, SortBy: []string{"_id"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	total, err := iter.Total()
+	if err != nil || total != 25 {
+		t.Errorf("expected %d matching documents but got %d and %v", 25, total, err)
+	}
+
+	n := 0
+	for {
+		user := new(testUserStruct)
+		var id string
+		id, err = iter.Next(user)
+		if err == ErrEndOfQueryResult {
+			break
+		} else if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if expected := fmt.Sprintf("page user %02d", n); id != expected {
+			t.Errorf("expected %q but got %q", expected, id)
+		}
+		n++
+	}
+	if n != 25 {
+		t.Errorf("expected %d hits but got %d", 25, n)
+	}
+
+	// Empty results are not errors
+	searchResult, err = testCol.SearchPage("all", bleve.NewMatchQuery("nothing"), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if searchResult.BleveSearchResult.Hits.Len() != 0 {
+		t.Errorf("the result must be empty")
+	}
+	if _, err = searchResult.Next(nil); err != ErrEndOfQueryResult {
+		t.Errorf("expected %v but got %v", ErrEndOfQueryResult, err)
+	}
+}
+
+func TestSearchHighlightAndFields(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	productCol, err := testDB.Use("products")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Only the description is stored
+	err = productCol.SetBleveIndexFor("products", &mappingTestProduct{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = productCol.Put("p1", &mappingTestProduct{Ref: "AB-12", Description: "a small blue lamp"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	q := bleve.NewMatchQuery("blue")
+	q.SetField("description")
+	searchResult, err := productCol.SearchPage("products", q, &SearchOptions{
+		Highlight: "html",
+		Fields:    []string{"description", "ref"},
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if searchResult.Total() != 1 {
+		t.Errorf("expected %d hit but got %d", 1, searchResult.Total())
+		return
+	}
+
+	hit := searchResult.BleveSearchResult.Hits[0]
+	if fragments := hit.Fragments["description"]; len(fragments) != 1 || fragments[0] != "a small <mark>blue</mark> lamp" {
+		t.Errorf("unexpected fragments %v", hit.Fragments)
+	}
+	if hit.Fields["description"] != "a small blue lamp" {
+		t.Errorf("expected the stored description but got %v", hit.Fields)
+	}
+	if _, ok := hit.Fields["ref"]; ok {
+		t.Errorf("the reference is not stored and must not be returned")
+	}
+}
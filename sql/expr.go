@@ -0,0 +1,514 @@
+package sql
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// expr is an element of an expression
+	expr interface {
+		eval(ctx *evalContext) interface{}
+		String() string
+	}
+
+	literal struct {
+		value interface{}
+	}
+
+	columnRef struct {
+		path []string
+	}
+
+	binaryExpr struct {
+		op          string
+		left, right expr
+	}
+
+	notExpr struct {
+		e expr
+	}
+
+	isNullExpr struct {
+		e   expr
+		not bool
+	}
+
+	inExpr struct {
+		e    expr
+		list []expr
+		not  bool
+	}
+
+	likeExpr struct {
+		e, pattern expr
+		not        bool
+	}
+
+	callExpr struct {
+		name     string
+		arg      expr
+		star     bool
+		distinct bool
+	}
+
+	// document is a record of a collection
+	document struct {
+		id      string
+		content interface{}
+	}
+
+	// row holds the documents of the joined tables by alias
+	row map[string]*document
+
+	evalContext struct {
+		row row
+		// group is set when the rows are grouped
+		group []row
+		// defaultAlias is the alias of the FROM table
+		defaultAlias string
+	}
+)
+
+// functions lists the available functions and if they are aggregates
+var functions = map[string]bool{
+	"COUNT":  true,
+	"SUM":    true,
+	"AVG":    true,
+	"MIN":    true,
+	"MAX":    true,
+	"LOWER":  false,
+	"UPPER":  false,
+	"LENGTH": false,
+}
+
+// idField is the column name of the document IDs
+const idField = "_id"
+
+func (l *literal) eval(*evalContext) interface{} {
+	return l.value
+}
+
+func (l *literal) String() string {
+	switch typed := l.value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.Replace(typed, "'", "''", -1) + "'"
+	}
+	return formatValue(l.value)
+}
+
+func (c *columnRef) eval(ctx *evalContext) interface{} {
+	doc, path := ctx.resolve(c.path)
+	if doc == nil {
+		return nil
+	}
+	if len(path) == 1 && path[0] == idField {
+		return doc.id
+	}
+
+	value := doc.content
+	for _, name := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+func (c *columnRef) String() string {
+	return strings.Join(c.path, ".")
+}
+
+// resolve returns the document and the path inside the document of a column
+func (ctx *evalContext) resolve(path []string) (*document, []string) {
+	if len(path) > 1 {
+		if doc, ok := ctx.row[path[0]]; ok {
+			return doc, path[1:]
+		}
+	}
+	if len(path) == 1 {
+		// The all document
+		if doc, ok := ctx.row[path[0]]; ok {
+			return doc, nil
+		}
+	}
+	return ctx.row[ctx.defaultAlias], path
+}
+
+func (b *binaryExpr) eval(ctx *evalContext) interface{} {
+	switch b.op {
+	case "AND":
+		return truthy(b.left.eval(ctx)) && truthy(b.right.eval(ctx))
+	case "OR":
+		return truthy(b.left.eval(ctx)) || truthy(b.right.eval(ctx))
+	}
+
+	left, right := b.left.eval(ctx), b.right.eval(ctx)
+
+	switch b.op {
+	case "+", "-", "*", "/":
+		l, lok := left.(float64)
+		r, rok := right.(float64)
+		if !lok || !rok {
+			return nil
+		}
+		switch b.op {
+		case "+":
+			return l + r
+		case "-":
+			return l - r
+		case "*":
+			return l * r
+		}
+		if r == 0 {
+			return nil
+		}
+		return l / r
+	}
+
+	// The arrays match if one of their elements matches
+	for _, value := range elements(left) {
+		if compareWith(b.op, value, right) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *binaryExpr) String() string {
+	return b.left.String() + " " + b.op + " " + b.right.String()
+}
+
+func compareWith(op string, left, right interface{}) bool {
+	if op == "=" {
+		return left != nil && equal(left, right)
+	}
+	if op == "!=" {
+		return left != nil && right != nil && !equal(left, right)
+	}
+
+	cmp, ok := compare(left, right)
+	if !ok {
+		return false
+	}
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func (n *notExpr) eval(ctx *evalContext) interface{} {
+	return !truthy(n.e.eval(ctx))
+}
+
+func (n *notExpr) String() string {
+	return "NOT " + n.e.String()
+}
+
+func (i *isNullExpr) eval(ctx *evalContext) interface{} {
+	return (i.e.eval(ctx) == nil) != i.not
+}
+
+func (i *isNullExpr) String() string {
+	if i.not {
+		return i.e.String() + " IS NOT NULL"
+	}
+	return i.e.String() + " IS NULL"
+}
+
+func (i *inExpr) eval(ctx *evalContext) interface{} {
+	value := i.e.eval(ctx)
+	if value == nil {
+		return false
+	}
+
+	for _, element := range elements(value) {
+		for _, item := range i.list {
+			if equal(element, item.eval(ctx)) {
+				return !i.not
+			}
+		}
+	}
+	return i.not
+}
+
+func (i *inExpr) String() string {
+	items := make([]string, len(i.list))
+	for j, item := range i.list {
+		items[j] = item.String()
+	}
+	op := " IN ("
+	if i.not {
+		op = " NOT IN ("
+	}
+	return i.e.String() + op + strings.Join(items, ", ") + ")"
+}
+
+func (l *likeExpr) eval(ctx *evalContext) interface{} {
+	pattern, ok := l.pattern.eval(ctx).(string)
+	if !ok {
+		return false
+	}
+	re := likeToRegexp(pattern)
+
+	for _, value := range elements(l.e.eval(ctx)) {
+		if s, ok := value.(string); ok && re.MatchString(s) {
+			return !l.not
+		}
+	}
+	return l.not
+}
+
+func (l *likeExpr) String() string {
+	op := " LIKE "
+	if l.not {
+		op = " NOT LIKE "
+	}
+	return l.e.String() + op + l.pattern.String()
+}
+
+// likeToRegexp converts the SQL pattern where % matches any text and _ any character
+func likeToRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func (c *callExpr) eval(ctx *evalContext) interface{} {
+	if !functions[c.name] {
+		value := c.arg.eval(ctx)
+		s, ok := value.(string)
+		switch c.name {
+		case "LOWER":
+			if ok {
+				return strings.ToLower(s)
+			}
+		case "UPPER":
+			if ok {
+				return strings.ToUpper(s)
+			}
+		case "LENGTH":
+			if ok {
+				return float64(len([]rune(s)))
+			}
+			if array, isArray := value.([]interface{}); isArray {
+				return float64(len(array))
+			}
+		}
+		return nil
+	}
+
+	group := ctx.group
+	if group == nil {
+		group = []row{ctx.row}
+	}
+
+	if c.star {
+		return float64(len(group))
+	}
+
+	values := []interface{}{}
+	seen := map[string]struct{}{}
+	for _, r := range group {
+		value := c.arg.eval(&evalContext{row: r, defaultAlias: ctx.defaultAlias})
+		if value == nil {
+			continue
+		}
+		if c.distinct {
+			key := groupKey([]interface{}{value})
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		values = append(values, value)
+	}
+
+	if c.name == "COUNT" {
+		return float64(len(values))
+	}
+
+	var ret interface{}
+	sum, count := 0.0, 0
+	for _, value := range values {
+		switch c.name {
+		case "SUM", "AVG":
+			if f, ok := value.(float64); ok {
+				sum += f
+				count++
+			}
+		case "MIN", "MAX":
+			if ret == nil {
+				ret = value
+				continue
+			}
+			cmp, ok := compare(value, ret)
+			if ok && ((c.name == "MIN" && cmp < 0) || (c.name == "MAX" && cmp > 0)) {
+				ret = value
+			}
+		}
+	}
+
+	switch c.name {
+	case "SUM":
+		if count == 0 {
+			return nil
+		}
+		return sum
+	case "AVG":
+		if count == 0 {
+			return nil
+		}
+		return sum / float64(count)
+	}
+	return ret
+}
+
+func (c *callExpr) String() string {
+	if c.star {
+		return strings.ToLower(c.name) + "(*)"
+	}
+	if c.distinct {
+		return strings.ToLower(c.name) + "(DISTINCT " + c.arg.String() + ")"
+	}
+	return strings.ToLower(c.name) + "(" + c.arg.String() + ")"
+}
+
+// hasAggregate returns true if the expression uses an aggregate function
+func hasAggregate(e expr) bool {
+	switch typed := e.(type) {
+	case *callExpr:
+		return functions[typed.name] || (typed.arg != nil && hasAggregate(typed.arg))
+	case *binaryExpr:
+		return hasAggregate(typed.left) || hasAggregate(typed.right)
+	case *notExpr:
+		return hasAggregate(typed.e)
+	case *isNullExpr:
+		return hasAggregate(typed.e)
+	case *inExpr:
+		if hasAggregate(typed.e) {
+			return true
+		}
+		for _, item := range typed.list {
+			if hasAggregate(item) {
+				return true
+			}
+		}
+	case *likeExpr:
+		return hasAggregate(typed.e) || hasAggregate(typed.pattern)
+	}
+	return false
+}
+
+// truthy returns true for true booleans
+func truthy(value interface{}) bool {
+	b, ok := value.(bool)
+	return ok && b
+}
+
+// elements returns the elements of an array or the value itself
+func elements(value interface{}) []interface{} {
+	if array, ok := value.([]interface{}); ok {
+		return array
+	}
+	return []interface{}{value}
+}
+
+func equal(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders the numbers, the strings and the booleans
+func compare(a, b interface{}) (int, bool) {
+	switch typedA := a.(type) {
+	case float64:
+		typedB, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case typedA < typedB:
+			return -1, true
+		case typedA > typedB:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		typedB, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(typedA, typedB), true
+	case bool:
+		typedB, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case typedA == typedB:
+			return 0, true
+		case typedB:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+// groupKey builds a comparable key from the values
+func groupKey(values []interface{}) string {
+	asJSON, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprint(values)
+	}
+	return string(asJSON)
+}
+
+// formatValue returns the text representation of a value
+func formatValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(typed)
+	}
+
+	asJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(asJSON)
+}
@@ -0,0 +1,116 @@
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type (
+	tokenKind int
+
+	token struct {
+		kind tokenKind
+		// text is the upper cased keyword, the identifier, the unquoted string or the symbol
+		text string
+		pos  int
+	}
+)
+
+const (
+	tokenEOF tokenKind = iota
+	tokenKeyword
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenSymbol
+)
+
+var keywords = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "FROM": true, "AS": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "ON": true,
+	"WHERE": true, "GROUP": true, "BY": true, "ORDER": true,
+	"ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true,
+	"AND": true, "OR": true, "NOT": true, "IN": true, "LIKE": true,
+	"IS": true, "NULL": true, "BETWEEN": true, "TRUE": true, "FALSE": true,
+}
+
+// lex splits the statement into tokens
+func lex(input string) ([]*token, error) {
+	tokens := []*token{}
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			word := string(runes[start:i])
+			if keywords[strings.ToUpper(word)] {
+				tokens = append(tokens, &token{kind: tokenKeyword, text: strings.ToUpper(word), pos: start})
+			} else {
+				tokens = append(tokens, &token{kind: tokenIdent, text: word, pos: start})
+			}
+		case unicode.IsDigit(r):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, &token{kind: tokenNumber, text: string(runes[start:i]), pos: start})
+		case r == '\'':
+			text, end, err := readQuoted(runes, i, '\'')
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, &token{kind: tokenString, text: text, pos: start})
+		case r == '"' || r == '`':
+			text, end, err := readQuoted(runes, i, r)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, &token{kind: tokenIdent, text: text, pos: start})
+		default:
+			symbol := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "<=", ">=", "!=", "<>":
+					symbol = two
+				}
+			}
+			if !strings.Contains("=<>!(),.*+-/;", symbol[:1]) || symbol == "!" {
+				return nil, fmt.Errorf("%w at position %d: unexpected %q", ErrSyntax, start, symbol)
+			}
+			i += len([]rune(symbol))
+			tokens = append(tokens, &token{kind: tokenSymbol, text: symbol, pos: start})
+		}
+	}
+
+	return append(tokens, &token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+// readQuoted reads a quoted text, the quote is escaped by doubling it
+func readQuoted(runes []rune, start int, quote rune) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != quote {
+			b.WriteRune(runes[i])
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == quote {
+			b.WriteRune(quote)
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+
+	return "", 0, fmt.Errorf("%w at position %d: unterminated quote", ErrSyntax, start)
+}
@@ -0,0 +1,94 @@
+package sql
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteTable writes the result as an aligned text table
+func (r *Result) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, strings.Join(r.Columns, "\t"))
+	separators := make([]string, len(r.Columns))
+	for i, name := range r.Columns {
+		separators[i] = strings.Repeat("-", len([]rune(name)))
+	}
+	fmt.Fprintln(tw, strings.Join(separators, "\t"))
+
+	for _, values := range r.Rows {
+		cells := make([]string, len(values))
+		for i, value := range values {
+			if value == nil {
+				cells[i] = "NULL"
+				continue
+			}
+			// The tabulations and the new lines would break the table
+			cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(formatValue(value))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// WriteCSV writes the result as CSV with a header line, NULL is an empty cell
+func (r *Result) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(r.Columns)
+	if err != nil {
+		return err
+	}
+
+	for _, values := range r.Rows {
+		cells := make([]string, len(values))
+		for i, value := range values {
+			cells[i] = formatValue(value)
+		}
+		err = cw.Write(cells)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the result as an array of objects keeping the columns order
+func (r *Result) WriteJSON(w io.Writer) error {
+	buff := bytes.NewBufferString("[")
+	for i, values := range r.Rows {
+		if i > 0 {
+			buff.WriteString(",")
+		}
+		buff.WriteString("{")
+		for j, value := range values {
+			if j > 0 {
+				buff.WriteString(",")
+			}
+			key, err := json.Marshal(r.Columns[j])
+			if err != nil {
+				return err
+			}
+			asJSON, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			buff.Write(key)
+			buff.WriteString(":")
+			buff.Write(asJSON)
+		}
+		buff.WriteString("}")
+	}
+	buff.WriteString("]\n")
+
+	_, err := buff.WriteTo(w)
+	return err
+}
@@ -0,0 +1,582 @@
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Statement is a parsed SELECT statement
+	Statement struct {
+		Distinct bool
+		Columns  []*column
+		From     *tableRef
+		Joins    []*join
+		Where    expr
+		GroupBy  []expr
+		OrderBy  []*orderItem
+		Limit    int
+		Offset   int
+	}
+
+	column struct {
+		// star is set for "*"
+		star  bool
+		expr  expr
+		alias string
+	}
+
+	tableRef struct {
+		collection string
+		alias      string
+	}
+
+	join struct {
+		table *tableRef
+		left  bool
+		on    expr
+	}
+
+	orderItem struct {
+		expr expr
+		// position is the 1 based index of the selected column or 0
+		position   int
+		descending bool
+	}
+
+	parser struct {
+		tokens []*token
+		pos    int
+	}
+)
+
+// Parse reads a SELECT statement
+func Parse(statement string) (*Statement, error) {
+	tokens, err := lex(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	s, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+
+	p.acceptSymbol(";")
+	if p.peek().kind != tokenEOF {
+		return nil, p.errorf("end of statement")
+	}
+
+	return s, nil
+}
+
+func (p *parser) peek() *token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() *token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(expected string) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokenEOF {
+		found = "end of statement"
+	}
+	return fmt.Errorf("%w at position %d: expected %s but found %q", ErrSyntax, t.pos, expected, found)
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if t := p.peek(); t.kind == tokenKeyword && t.text == keyword {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf(keyword)
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf(strconv.Quote(symbol))
+	}
+	return nil
+}
+
+func (p *parser) expectIdent() (string, error) {
+	t := p.peek()
+	if t.kind != tokenIdent {
+		return "", p.errorf("identifier")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) expectInt() (int, error) {
+	t := p.peek()
+	if t.kind != tokenNumber {
+		return 0, p.errorf("number")
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil || n < 0 {
+		return 0, p.errorf("positive integer")
+	}
+	p.pos++
+	return n, nil
+}
+
+func (p *parser) parseSelect() (*Statement, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	s := new(Statement)
+	s.Distinct = p.acceptKeyword("DISTINCT")
+
+	for {
+		col, err := p.parseColumn()
+		if err != nil {
+			return nil, err
+		}
+		s.Columns = append(s.Columns, col)
+
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	var err error
+	s.From, err = p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		left := false
+		if p.acceptKeyword("LEFT") {
+			left = true
+		} else {
+			p.acceptKeyword("INNER")
+		}
+		if !p.acceptKeyword("JOIN") {
+			if left {
+				return nil, p.errorf("JOIN")
+			}
+			break
+		}
+
+		j := &join{left: left}
+		j.table, err = p.parseTableRef()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("ON"); err != nil {
+			return nil, err
+		}
+		j.on, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		s.Joins = append(s.Joins, j)
+	}
+
+	if p.acceptKeyword("WHERE") {
+		s.Where, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("GROUP") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			var e expr
+			e, err = p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			s.GroupBy = append(s.GroupBy, e)
+
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err = p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			item := new(orderItem)
+			if t := p.peek(); t.kind == tokenNumber {
+				item.position, err = p.expectInt()
+				if err != nil {
+					return nil, err
+				}
+				if item.position == 0 || item.position > len(s.Columns) {
+					return nil, fmt.Errorf("%w: ORDER BY position %d is not in the select list", ErrSyntax, item.position)
+				}
+			} else {
+				item.expr, err = p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if p.acceptKeyword("DESC") {
+				item.descending = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			s.OrderBy = append(s.OrderBy, item)
+
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	s.Limit = -1
+	if p.acceptKeyword("LIMIT") {
+		s.Limit, err = p.expectInt()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		s.Offset, err = p.expectInt()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (p *parser) parseColumn() (*column, error) {
+	if p.acceptSymbol("*") {
+		return &column{star: true}, nil
+	}
+
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	col := &column{expr: e}
+	if p.acceptKeyword("AS") {
+		col.alias, err = p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+	} else if t := p.peek(); t.kind == tokenIdent {
+		col.alias = p.next().text
+	}
+
+	return col, nil
+}
+
+func (p *parser) parseTableRef() (*tableRef, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &tableRef{collection: name, alias: name}
+	if p.acceptKeyword("AS") {
+		table.alias, err = p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+	} else if t := p.peek(); t.kind == tokenIdent {
+		table.alias = p.next().text
+	}
+
+	return table, nil
+}
+
+func (p *parser) parseExpr() (expr, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.acceptKeyword("NOT") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{e: e}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokenSymbol {
+		switch t.text {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := t.text
+			if op == "<>" {
+				op = "!="
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if err = p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &isNullExpr{e: left, not: not}, nil
+	}
+
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		in := &inExpr{e: left, not: not}
+		for {
+			var item expr
+			item, err = p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			in.list = append(in.list, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return in, nil
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &likeExpr{e: left, pattern: pattern, not: not}, nil
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		var between expr = &binaryExpr{
+			op:    "AND",
+			left:  &binaryExpr{op: ">=", left: left, right: low},
+			right: &binaryExpr{op: "<=", left: left, right: high},
+		}
+		if not {
+			between = &notExpr{e: between}
+		}
+		return between, nil
+	}
+	if not {
+		return nil, p.errorf("IN, LIKE or BETWEEN")
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAdditive() (expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenSymbol || (t.text != "+" && t.text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseMultiplicative() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokenSymbol || (t.text != "*" && t.text != "/") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (expr, error) {
+	if p.acceptSymbol("-") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{op: "-", left: &literal{value: float64(0)}, right: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.peek()
+
+	switch t.kind {
+	case tokenNumber:
+		p.next()
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w at position %d: bad number %q", ErrSyntax, t.pos, t.text)
+		}
+		return &literal{value: f}, nil
+	case tokenString:
+		p.next()
+		return &literal{value: t.text}, nil
+	case tokenKeyword:
+		switch t.text {
+		case "TRUE", "FALSE":
+			p.next()
+			return &literal{value: t.text == "TRUE"}, nil
+		case "NULL":
+			p.next()
+			return &literal{value: nil}, nil
+		}
+	case tokenSymbol:
+		if t.text == "(" {
+			p.next()
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return e, nil
+		}
+	case tokenIdent:
+		p.next()
+		if p.acceptSymbol("(") {
+			return p.parseCall(t.text)
+		}
+
+		path := []string{t.text}
+		for p.acceptSymbol(".") {
+			name, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, name)
+		}
+		return &columnRef{path: path}, nil
+	}
+
+	return nil, p.errorf("expression")
+}
+
+// parseCall reads the arguments of a function, the opening parenthesis is already read
+func (p *parser) parseCall(name string) (expr, error) {
+	call := &callExpr{name: strings.ToUpper(name)}
+	if _, ok := functions[call.name]; !ok {
+		return nil, fmt.Errorf("%w: unknown function %q", ErrSyntax, name)
+	}
+
+	if call.name == "COUNT" && p.acceptSymbol("*") {
+		call.star = true
+	} else {
+		call.distinct = p.acceptKeyword("DISTINCT")
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.arg = arg
+	}
+
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
@@ -0,0 +1,684 @@
+// Package sql runs read only SQL statements over the collections of a *gotinydb.DB.
+//
+// The supported subset is:
+//
+//	SELECT [DISTINCT] * | expr [AS alias], ...
+//	FROM collection [alias]
+//	[[INNER | LEFT] JOIN collection [alias] ON expr ...]
+//	[WHERE expr]
+//	[GROUP BY expr, ...]
+//	[ORDER BY expr | position [ASC | DESC], ...]
+//	[LIMIT n] [OFFSET n]
+//
+// The columns are JSON paths like "address.city", "_id" is the document ID and
+// the paths can be prefixed by the collection alias when joining collections.
+// The joins on IDs like "ON o.user = u._id" read the joined documents directly.
+// The WHERE conditions on the FROM collection are passed to *gotinydb.Collection.Find
+// which uses the collection indexes when possible.
+//
+// The expressions support the comparisons, AND, OR, NOT, IN, LIKE, BETWEEN,
+// IS [NOT] NULL, the arithmetic operators, LOWER, UPPER, LENGTH and the aggregate
+// functions COUNT, SUM, AVG, MIN and MAX.
+package sql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alexandrestein/gotinydb"
+)
+
+type (
+	// Result is the output of a statement
+	Result struct {
+		Columns []string
+		Rows    [][]interface{}
+		// IndexName is the name of the index used to select the documents of the FROM
+		// collection, empty if the all collection was scanned
+		IndexName string
+	}
+
+	// record is an output row with the context used to order it
+	record struct {
+		values []interface{}
+		ctx    *evalContext
+	}
+)
+
+var (
+	// ErrSyntax is returned when the statement can't be parsed or is not supported
+	ErrSyntax = errors.New("sql syntax error")
+	// ErrDuplicateAlias is returned when two tables of the statement have the same alias
+	ErrDuplicateAlias = errors.New("the alias is used by more than one table")
+
+	// errScanDone stops the scan of the FROM collection when the page is full
+	errScanDone = errors.New("the page is full")
+)
+
+// Query parses and runs the statement
+func Query(db *gotinydb.DB, statement string) (*Result, error) {
+	s, err := Parse(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Run(db)
+}
+
+// Run runs the statement against the database
+func (s *Statement) Run(db *gotinydb.DB) (*Result, error) {
+	existing := map[string]bool{}
+	for _, name := range db.GetCollections() {
+		existing[name] = true
+	}
+
+	tables := []*tableRef{s.From}
+	for _, j := range s.Joins {
+		tables = append(tables, j.table)
+	}
+	collections := map[string]*gotinydb.Collection{}
+	for _, table := range tables {
+		if !existing[table.collection] {
+			return nil, gotinydb.ErrCollectionNotFound
+		}
+		if _, ok := collections[table.alias]; ok {
+			return nil, ErrDuplicateAlias
+		}
+
+		col, err := db.Use(table.collection)
+		if err != nil {
+			return nil, err
+		}
+		collections[table.alias] = col
+	}
+
+	if s.Where != nil && hasAggregate(s.Where) {
+		return nil, fmt.Errorf("%w: aggregate functions are not allowed in WHERE", ErrSyntax)
+	}
+
+	ret := new(Result)
+
+	// Without join, grouping, distinct and order the scan stops when the page is full
+	limit := -1
+	if len(s.Joins) == 0 && !s.isAggregate() && !s.Distinct && len(s.OrderBy) == 0 && s.Limit >= 0 {
+		limit = s.Offset + s.Limit
+	}
+
+	rows, err := s.scanFrom(collections[s.From.alias], ret, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, j := range s.Joins {
+		rows, err = s.join(rows, j, collections[j.table.alias])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The rows of a limited scan are already filtered
+	if s.Where != nil && limit < 0 {
+		filtered := []row{}
+		for _, r := range rows {
+			if truthy(s.Where.eval(s.newContext(r, nil))) {
+				filtered = append(filtered, r)
+			}
+		}
+		rows = filtered
+	}
+
+	var records []*record
+	if s.isAggregate() {
+		records, err = s.aggregate(rows, ret)
+	} else {
+		records = s.project(rows, ret)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Distinct {
+		records = distinct(records)
+	}
+
+	err = s.sort(records, ret.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Offset >= len(records) {
+		records = records[:0]
+	} else {
+		records = records[s.Offset:]
+	}
+	if s.Limit >= 0 && s.Limit < len(records) {
+		records = records[:s.Limit]
+	}
+
+	ret.Rows = make([][]interface{}, len(records))
+	for i, rec := range records {
+		ret.Rows[i] = rec.values
+	}
+
+	return ret, nil
+}
+
+func (s *Statement) newContext(r row, group []row) *evalContext {
+	return &evalContext{row: r, group: group, defaultAlias: s.From.alias}
+}
+
+// scanFrom reads the documents of the FROM collection.
+// If limit is not negative the rows are filtered by the WHERE clause and
+// the scan stops after limit rows.
+func (s *Statement) scanFrom(col *gotinydb.Collection, ret *Result, limit int) ([]row, error) {
+	rows := []row{}
+	if limit == 0 {
+		return rows, nil
+	}
+
+	indexName, err := col.FindEach(s.pushdownFilter(), nil, func(response *gotinydb.Response) error {
+		r := row{s.From.alias: newDocument(response.ID, response.Content)}
+		if limit < 0 {
+			rows = append(rows, r)
+			return nil
+		}
+
+		if s.Where == nil || truthy(s.Where.eval(s.newContext(r, nil))) {
+			rows = append(rows, r)
+		}
+		if len(rows) == limit {
+			return errScanDone
+		}
+		return nil
+	})
+	if err != nil && err != errScanDone {
+		return nil, err
+	}
+	ret.IndexName = indexName
+
+	return rows, nil
+}
+
+func newDocument(id string, content []byte) *document {
+	doc := &document{id: id}
+	// The content which is not a JSON has no field
+	json.Unmarshal(content, &doc.content)
+	return doc
+}
+
+// join adds the documents of the joined collection to the rows
+func (s *Statement) join(rows []row, j *join, col *gotinydb.Collection) ([]row, error) {
+	alias := j.table.alias
+	ret := []row{}
+
+	add := func(r row, doc *document) {
+		joined := row{}
+		for k, v := range r {
+			joined[k] = v
+		}
+		joined[alias] = doc
+		ret = append(ret, joined)
+	}
+
+	// The join on the IDs reads the documents directly
+	if idExpr := joinIDExpr(j.on, alias); idExpr != nil {
+		cache := map[string]*document{}
+		for _, r := range rows {
+			id, ok := idExpr.eval(s.newContext(r, nil)).(string)
+			if !ok {
+				if j.left {
+					add(r, nil)
+				}
+				continue
+			}
+
+			doc, cached := cache[id]
+			if !cached {
+				content, err := col.Get(id, nil)
+				if err != nil && err != gotinydb.ErrNotFound {
+					return nil, err
+				}
+				if err == nil {
+					doc = newDocument(id, content)
+				}
+				cache[id] = doc
+			}
+
+			if doc != nil || j.left {
+				add(r, doc)
+			}
+		}
+		return ret, nil
+	}
+
+	result, err := col.Find(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]*document, len(result.Responses))
+	for i, response := range result.Responses {
+		docs[i] = newDocument(response.ID, response.Content)
+	}
+
+	for _, r := range rows {
+		matched := false
+		for _, doc := range docs {
+			r[alias] = doc
+			if truthy(j.on.eval(s.newContext(r, nil))) {
+				add(r, doc)
+				matched = true
+			}
+		}
+		delete(r, alias)
+
+		if !matched && j.left {
+			add(r, nil)
+		}
+	}
+
+	return ret, nil
+}
+
+// joinIDExpr returns the expression giving the ID of the joined document
+// if the condition is an equality on the ID of the joined table
+func joinIDExpr(on expr, alias string) expr {
+	equality, ok := on.(*binaryExpr)
+	if !ok || equality.op != "=" {
+		return nil
+	}
+
+	isJoinedID := func(e expr) bool {
+		ref, ok := e.(*columnRef)
+		return ok && len(ref.path) == 2 && ref.path[0] == alias && ref.path[1] == idField
+	}
+
+	switch {
+	case isJoinedID(equality.right) && !usesAlias(equality.left, alias):
+		return equality.left
+	case isJoinedID(equality.left) && !usesAlias(equality.right, alias):
+		return equality.right
+	}
+	return nil
+}
+
+// usesAlias returns true if the expression refers to the table
+func usesAlias(e expr, alias string) bool {
+	switch typed := e.(type) {
+	case *columnRef:
+		return typed.path[0] == alias
+	case *binaryExpr:
+		return usesAlias(typed.left, alias) || usesAlias(typed.right, alias)
+	case *notExpr:
+		return usesAlias(typed.e, alias)
+	case *isNullExpr:
+		return usesAlias(typed.e, alias)
+	case *likeExpr:
+		return usesAlias(typed.e, alias) || usesAlias(typed.pattern, alias)
+	case *callExpr:
+		return typed.arg != nil && usesAlias(typed.arg, alias)
+	case *inExpr:
+		if usesAlias(typed.e, alias) {
+			return true
+		}
+		for _, item := range typed.list {
+			if usesAlias(item, alias) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Statement) isAggregate() bool {
+	if len(s.GroupBy) > 0 {
+		return true
+	}
+	for _, col := range s.Columns {
+		if !col.star && hasAggregate(col.expr) {
+			return true
+		}
+	}
+	for _, item := range s.OrderBy {
+		if item.expr != nil && hasAggregate(item.expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// project builds a record for every row
+func (s *Statement) project(rows []row, ret *Result) []*record {
+	exprs := []expr{}
+	for _, col := range s.Columns {
+		if !col.star {
+			exprs = append(exprs, col.expr)
+			ret.Columns = append(ret.Columns, columnName(col))
+			continue
+		}
+
+		for _, ref := range s.expandStar(rows) {
+			exprs = append(exprs, ref)
+			if len(s.Joins) == 0 {
+				ret.Columns = append(ret.Columns, ref.path[1])
+			} else {
+				ret.Columns = append(ret.Columns, ref.String())
+			}
+		}
+	}
+
+	records := make([]*record, len(rows))
+	for i, r := range rows {
+		ctx := s.newContext(r, nil)
+		values := make([]interface{}, len(exprs))
+		for j, e := range exprs {
+			values[j] = e.eval(ctx)
+		}
+		records[i] = &record{values: values, ctx: ctx}
+	}
+
+	return records
+}
+
+// expandStar returns the ID and the top level fields of every table
+func (s *Statement) expandStar(rows []row) []*columnRef {
+	tables := []string{s.From.alias}
+	for _, j := range s.Joins {
+		tables = append(tables, j.table.alias)
+	}
+
+	ret := []*columnRef{}
+	for _, alias := range tables {
+		keys := map[string]struct{}{}
+		for _, r := range rows {
+			doc := r[alias]
+			if doc == nil {
+				continue
+			}
+			if object, ok := doc.content.(map[string]interface{}); ok {
+				for key := range object {
+					keys[key] = struct{}{}
+				}
+			}
+		}
+		delete(keys, idField)
+
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+
+		ret = append(ret, &columnRef{path: []string{alias, idField}})
+		for _, key := range sortedKeys {
+			ret = append(ret, &columnRef{path: []string{alias, key}})
+		}
+	}
+
+	return ret
+}
+
+// aggregate builds a record for every group
+func (s *Statement) aggregate(rows []row, ret *Result) ([]*record, error) {
+	for _, col := range s.Columns {
+		if col.star {
+			return nil, fmt.Errorf("%w: * can't be selected with aggregate functions", ErrSyntax)
+		}
+		ret.Columns = append(ret.Columns, columnName(col))
+	}
+
+	groups := [][]row{}
+	if len(s.GroupBy) == 0 {
+		groups = append(groups, rows)
+	} else {
+		indexes := map[string]int{}
+		for _, r := range rows {
+			ctx := s.newContext(r, nil)
+			keyValues := make([]interface{}, len(s.GroupBy))
+			for i, e := range s.GroupBy {
+				keyValues[i] = e.eval(ctx)
+			}
+
+			key := groupKey(keyValues)
+			i, ok := indexes[key]
+			if !ok {
+				i = len(groups)
+				indexes[key] = i
+				groups = append(groups, nil)
+			}
+			groups[i] = append(groups[i], r)
+		}
+	}
+
+	records := make([]*record, len(groups))
+	for i, group := range groups {
+		first := row{}
+		if len(group) > 0 {
+			first = group[0]
+		}
+		ctx := s.newContext(first, group)
+
+		values := make([]interface{}, len(s.Columns))
+		for j, col := range s.Columns {
+			values[j] = col.expr.eval(ctx)
+		}
+		records[i] = &record{values: values, ctx: ctx}
+	}
+
+	return records, nil
+}
+
+// columnName returns the alias of the column or the text of its expression
+func columnName(col *column) string {
+	if col.alias != "" {
+		return col.alias
+	}
+	return col.expr.String()
+}
+
+// distinct removes the duplicated records and keeps the first ones
+func distinct(records []*record) []*record {
+	seen := map[string]struct{}{}
+	ret := []*record{}
+	for _, rec := range records {
+		key := groupKey(rec.values)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		ret = append(ret, rec)
+	}
+	return ret
+}
+
+// sort orders the records by the ORDER BY items
+func (s *Statement) sort(records []*record, columns []string) error {
+	if len(s.OrderBy) == 0 {
+		return nil
+	}
+
+	// valueGetters return the value used to order a record for every item
+	valueGetters := make([]func(rec *record) interface{}, len(s.OrderBy))
+	for i, item := range s.OrderBy {
+		position := item.position - 1
+		if ref, ok := item.expr.(*columnRef); ok && len(ref.path) == 1 {
+			// The select aliases are used before the document fields
+			for j, name := range columns {
+				if name == ref.path[0] {
+					position = j
+					break
+				}
+			}
+		}
+
+		if position >= len(columns) {
+			return fmt.Errorf("%w: ORDER BY position %d is not in the select list", ErrSyntax, item.position)
+		}
+
+		if position >= 0 {
+			valueGetters[i] = func(rec *record) interface{} {
+				return rec.values[position]
+			}
+			continue
+		}
+
+		e := item.expr
+		valueGetters[i] = func(rec *record) interface{} {
+			return e.eval(rec.ctx)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		for k, item := range s.OrderBy {
+			cmp := orderValues(valueGetters[k](records[i]), valueGetters[k](records[j]))
+			if cmp == 0 {
+				continue
+			}
+			if item.descending {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	return nil
+}
+
+// orderValues compares any values, NULL first then booleans, numbers, strings and
+// the other values
+func orderValues(a, b interface{}) int {
+	rank := func(value interface{}) int {
+		switch value.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		case string:
+			return 3
+		}
+		return 4
+	}
+
+	rankA, rankB := rank(a), rank(b)
+	switch {
+	case rankA < rankB:
+		return -1
+	case rankA > rankB:
+		return 1
+	}
+
+	if cmp, ok := compare(a, b); ok {
+		return cmp
+	}
+	if rankA == 4 {
+		return strings.Compare(groupKey([]interface{}{a}), groupKey([]interface{}{b}))
+	}
+	return 0
+}
+
+// pushdownFilter translates the WHERE conditions on the FROM collection into a filter.
+// The filter can match more documents than the WHERE clause which is always evaluated.
+func (s *Statement) pushdownFilter() gotinydb.Filter {
+	if s.Where == nil {
+		return nil
+	}
+
+	aliases := map[string]bool{s.From.alias: true}
+	for _, j := range s.Joins {
+		aliases[j.table.alias] = true
+	}
+
+	filter, ok := s.toFilter(s.Where, aliases)
+	if !ok {
+		return nil
+	}
+	return filter
+}
+
+func (s *Statement) toFilter(e expr, aliases map[string]bool) (gotinydb.Filter, bool) {
+	switch typed := e.(type) {
+	case *binaryExpr:
+		switch typed.op {
+		case "AND":
+			left, leftOK := s.toFilter(typed.left, aliases)
+			right, rightOK := s.toFilter(typed.right, aliases)
+			switch {
+			case leftOK && rightOK:
+				return gotinydb.Filter{"$and": []gotinydb.Filter{left, right}}, true
+			case leftOK:
+				return left, true
+			}
+			return right, rightOK
+		case "OR":
+			left, leftOK := s.toFilter(typed.left, aliases)
+			right, rightOK := s.toFilter(typed.right, aliases)
+			if !leftOK || !rightOK {
+				return nil, false
+			}
+			return gotinydb.Filter{"$or": []gotinydb.Filter{left, right}}, true
+		}
+
+		operators := map[string]string{"=": "$eq", "<": "$lt", "<=": "$lte", ">": "$gt", ">=": "$gte"}
+		reversed := map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+		operator, ok := operators[typed.op]
+		if !ok {
+			return nil, false
+		}
+
+		path, ok := s.filterPath(typed.left, aliases)
+		value, isLiteral := typed.right.(*literal)
+		if !ok || !isLiteral {
+			path, ok = s.filterPath(typed.right, aliases)
+			value, isLiteral = typed.left.(*literal)
+			operator = operators[reversed[typed.op]]
+		}
+		if !ok || !isLiteral || value.value == nil {
+			return nil, false
+		}
+		return gotinydb.Filter{path: gotinydb.Filter{operator: value.value}}, true
+	case *inExpr:
+		path, ok := s.filterPath(typed.e, aliases)
+		if !ok || typed.not {
+			return nil, false
+		}
+		values := make([]interface{}, len(typed.list))
+		for i, item := range typed.list {
+			value, isLiteral := item.(*literal)
+			if !isLiteral || value.value == nil {
+				return nil, false
+			}
+			values[i] = value.value
+		}
+		return gotinydb.Filter{path: gotinydb.Filter{"$in": values}}, true
+	}
+
+	return nil, false
+}
+
+// filterPath returns the JSON path of the column if it is a field of the FROM collection
+func (s *Statement) filterPath(e expr, aliases map[string]bool) (string, bool) {
+	ref, ok := e.(*columnRef)
+	if !ok {
+		return "", false
+	}
+
+	path := ref.path
+	if len(path) > 1 && aliases[path[0]] {
+		if path[0] != s.From.alias {
+			return "", false
+		}
+		path = path[1:]
+	} else if len(path) == 1 && aliases[path[0]] {
+		return "", false
+	}
+	if path[0] == idField {
+		return "", false
+	}
+
+	return strings.Join(path, "."), true
+}
@@ -0,0 +1,201 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/alexandrestein/gotinydb"
+	"github.com/blevesearch/bleve"
+)
+
+var testPath = os.TempDir() + "/testSQL"
+
+func openTestDB(t *testing.T) *gotinydb.DB {
+	os.RemoveAll(testPath)
+
+	db, err := gotinydb.Open(testPath, [32]byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := db.Use("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, _ := users.NewBatch(context.Background())
+	batch.Put("u1", map[string]interface{}{"name": "Alice", "age": 34, "address": map[string]interface{}{"city": "Paris"}, "tags": []string{"admin"}})
+	batch.Put("u2", map[string]interface{}{"name": "Bob", "age": 25, "address": map[string]interface{}{"city": "Lyon"}})
+	batch.Put("u3", map[string]interface{}{"name": "Carol", "age": 41, "address": map[string]interface{}{"city": "Paris"}})
+	batch.Put("u4", map[string]interface{}{"name": "Dave", "age": 30, "address": map[string]interface{}{"city": "Nantes"}, "tags": []string{"guest", "admin"}})
+	if err = batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	orders, err := db.Use("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, _ = orders.NewBatch(context.Background())
+	batch.Put("o1", map[string]interface{}{"user": "u1", "total": 10.5})
+	batch.Put("o2", map[string]interface{}{"user": "u1", "total": 20})
+	batch.Put("o3", map[string]interface{}{"user": "u3", "total": 5})
+	batch.Put("o4", map[string]interface{}{"user": "unknown", "total": 1})
+	if err = batch.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestQuery(t *testing.T) {
+	db := openTestDB(t)
+	defer os.RemoveAll(testPath)
+	defer db.Close()
+
+	tests := []struct {
+		name, statement string
+		columns         []string
+		rows            [][]interface{}
+	}{
+		{
+			"where and order",
+			"SELECT _id, name FROM users WHERE age >= 30 AND address.city <> 'Lyon' ORDER BY age DESC",
+			[]string{"_id", "name"},
+			[][]interface{}{{"u3", "Carol"}, {"u1", "Alice"}, {"u4", "Dave"}},
+		},
+		{
+			"group by",
+			"SELECT address.city AS city, COUNT(*), AVG(age) FROM users GROUP BY address.city ORDER BY 2 DESC, city LIMIT 2",
+			[]string{"city", "count(*)", "avg(age)"},
+			[][]interface{}{{"Paris", 2.0, 37.5}, {"Lyon", 1.0, 25.0}},
+		},
+		{
+			"aggregates without group",
+			"SELECT count(*) AS n, max(age), min(name), sum(age) FROM users WHERE name LIKE '%a%'",
+			[]string{"n", "max(age)", "min(name)", "sum(age)"},
+			[][]interface{}{{2.0, 41.0, "Carol", 71.0}},
+		},
+		{
+			"arrays in and distinct",
+			"SELECT DISTINCT address.city FROM users WHERE tags IN ('admin') ORDER BY 1",
+			[]string{"address.city"},
+			[][]interface{}{{"Nantes"}, {"Paris"}},
+		},
+		{
+			"join on IDs",
+			"SELECT o._id, u.name, o.total FROM orders o JOIN users u ON o.user = u._id ORDER BY o.total",
+			[]string{"o._id", "u.name", "o.total"},
+			[][]interface{}{{"o3", "Carol", 5.0}, {"o1", "Alice", 10.5}, {"o2", "Alice", 20.0}},
+		},
+		{
+			"left join and group",
+			"SELECT u.name, COUNT(o._id) AS orders, SUM(o.total) FROM users u LEFT JOIN orders o ON o.user = u._id GROUP BY u.name ORDER BY orders DESC, u.name",
+			[]string{"u.name", "orders", "sum(o.total)"},
+			[][]interface{}{{"Alice", 2.0, 30.5}, {"Carol", 1.0, 5.0}, {"Bob", 0.0, nil}, {"Dave", 0.0, nil}},
+		},
+		{
+			"star offset",
+			"SELECT * FROM orders WHERE total BETWEEN 5 AND 20 ORDER BY _id LIMIT 1 OFFSET 1",
+			[]string{"_id", "total", "user"},
+			[][]interface{}{{"o2", 20.0, "u1"}},
+		},
+		{
+			"limit without order",
+			"SELECT _id FROM users WHERE age >= 30 LIMIT 2 OFFSET 1",
+			[]string{"_id"},
+			[][]interface{}{{"u3"}, {"u4"}},
+		},
+		{
+			"expressions",
+			"SELECT upper(name) AS n, age * 2 + 1 FROM users WHERE NOT age < 40 OR address.city IS NULL",
+			[]string{"n", "age * 2 + 1"},
+			[][]interface{}{{"CAROL", 83.0}},
+		},
+	}
+
+	check := func(step string) {
+		for _, test := range tests {
+			result, err := Query(db, test.statement)
+			if err != nil {
+				t.Errorf("%s %s: %s", step, test.name, err.Error())
+				continue
+			}
+			if !reflect.DeepEqual(result.Columns, test.columns) {
+				t.Errorf("%s %s: expected columns %v but got %v", step, test.name, test.columns, result.Columns)
+			}
+			if !reflect.DeepEqual(result.Rows, test.rows) {
+				t.Errorf("%s %s: expected rows %v but got %v", step, test.name, test.rows, result.Rows)
+			}
+		}
+	}
+
+	check("scan")
+
+	users, _ := db.Use("users")
+	usersMapping := bleve.NewDocumentStaticMapping()
+	usersMapping.AddFieldMappingsAt("age", bleve.NewNumericFieldMapping())
+	err := users.SetBleveIndex("ages", usersMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check("index")
+
+	result, err := Query(db, "SELECT name FROM users WHERE age > 40")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IndexName != "ages" {
+		t.Errorf("expected the index to be used but got %q", result.IndexName)
+	}
+
+	for statement, expected := range map[string]error{
+		"SELECT name FROM missing":                       gotinydb.ErrCollectionNotFound,
+		"SELECT name FROM users u JOIN orders u ON 1=1":  ErrDuplicateAlias,
+		"SELECT name FROM users WHERE COUNT(*) > 1":      ErrSyntax,
+		"SELECT *, COUNT(*) FROM users":                  ErrSyntax,
+		"SELECT name FROM users ORDER BY 3":              ErrSyntax,
+		"SELECT name FROM users WHERE name = 'unclosed":  ErrSyntax,
+		"SELECT name FROM users WHERE unknown(name) = 1": ErrSyntax,
+		"DELETE FROM users":                              ErrSyntax,
+	} {
+		if _, err = Query(db, statement); !errors.Is(err, expected) {
+			t.Errorf("%q: expected %v but got %v", statement, expected, err)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	result := &Result{
+		Columns: []string{"name", "age", "tags"},
+		Rows: [][]interface{}{
+			{"Alice", 34.0, []interface{}{"admin"}},
+			{"Bob, Jr", nil, nil},
+		},
+	}
+
+	buff := bytes.NewBuffer(nil)
+	result.WriteCSV(buff)
+	expected := "name,age,tags\nAlice,34,\"[\"\"admin\"\"]\"\n\"Bob, Jr\",,\n"
+	if buff.String() != expected {
+		t.Errorf("expected CSV %q but got %q", expected, buff.String())
+	}
+
+	buff.Reset()
+	result.WriteJSON(buff)
+	expected = `[{"name":"Alice","age":34,"tags":["admin"]},{"name":"Bob, Jr","age":null,"tags":null}]` + "\n"
+	if buff.String() != expected {
+		t.Errorf("expected JSON %q but got %q", expected, buff.String())
+	}
+
+	buff.Reset()
+	result.WriteTable(buff)
+	expected = "name     age   tags\n----     ---   ----\nAlice    34    [\"admin\"]\nBob, Jr  NULL  NULL\n"
+	if buff.String() != expected {
+		t.Errorf("expected table %q but got %q", expected, buff.String())
+	}
+}
@@ -0,0 +1,126 @@
+package gotinydb
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/index"
+)
+
+type (
+	// TermFrequency is a term of the index with the number of documents containing it
+	TermFrequency struct {
+		Term  string
+		Count uint64
+	}
+)
+
+// allFieldName is the composite field Bleve uses for the fields included in all
+const allFieldName = "_all"
+
+// Suggest returns the indexed terms of the field starting with the given prefix.
+// The completions are ranked by the number of documents containing them and then
+// alphabetically.
+// If limit is zero or negative every completion is returned.
+//
+// The prefix is compared to the terms of the index dictionary which are usually
+// lower cased by the analyzers. So the prefix is lower cased unless the field
+// uses the keyword analyzer.
+// If field is empty the composite "_all" field is used.
+func (c *Collection) Suggest(indexName, field, prefix string, limit int) ([]string, error) {
+	index, release, err := c.useBleveIndex(indexName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if field == "" {
+		field = allFieldName
+	}
+	if index.bleveIndex.Mapping().AnalyzerNameForPath(field) != keyword.Name {
+		prefix = strings.ToLower(prefix)
+	}
+
+	fieldDict, err := index.bleveIndex.FieldDictPrefix(field, []byte(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	terms, err := readFieldDict(fieldDict)
+	if err != nil {
+		return nil, err
+	}
+
+	// The most used terms first
+	sort.SliceStable(terms, func(i, j int) bool {
+		return terms[i].Count > terms[j].Count
+	})
+
+	if limit > 0 && len(terms) > limit {
+		terms = terms[:limit]
+	}
+
+	ret := make([]string, len(terms))
+	for i, term := range terms {
+		ret[i] = term.Term
+	}
+
+	return ret, nil
+}
+
+// FieldTerms returns every term indexed for the given field in alphabetical order
+// with the number of documents containing them.
+// If field is empty the composite "_all" field is used.
+func (c *Collection) FieldTerms(indexName, field string) ([]*TermFrequency, error) {
+	index, release, err := c.useBleveIndex(indexName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if field == "" {
+		field = allFieldName
+	}
+
+	fieldDict, err := index.bleveIndex.FieldDict(field)
+	if err != nil {
+		return nil, err
+	}
+
+	terms, err := readFieldDict(fieldDict)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*TermFrequency, len(terms))
+	for i := range terms {
+		ret[i] = &terms[i]
+	}
+
+	return ret, nil
+}
+
+// readFieldDict reads and closes the given dictionary.
+// The terms which are not used anymore are skipped.
+func readFieldDict(fieldDict index.FieldDict) ([]TermFrequency, error) {
+	defer fieldDict.Close()
+
+	terms := []TermFrequency{}
+	for {
+		entry, err := fieldDict.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Count == 0 {
+			continue
+		}
+
+		terms = append(terms, TermFrequency{Term: entry.Term, Count: entry.Count})
+	}
+
+	return terms, nil
+}
@@ -0,0 +1,97 @@
+package gotinydb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestSuggestAndFieldTerms(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	cityCol, err := testDB.Use("cities")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	cityMapping := bleve.NewDocumentStaticMapping()
+	cityMapping.AddFieldMappingsAt("name", bleve.NewTextFieldMapping())
+	err = cityCol.SetBleveIndex("cities", cityMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	batch, _ := cityCol.NewBatch(context.Background())
+	for id, name := range map[string]string{
+		"1": "Paris",
+		"2": "Paris Texas",
+		"3": "Pau",
+		"4": "Lyon",
+		"5": "Parthenay",
+		"6": "Old Paris",
+	} {
+		batch.Put(id, map[string]string{"name": name})
+	}
+	err = batch.Write()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	suggestions, err := cityCol.Suggest("cities", "name", "Par", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expected := []string{"paris", "parthenay"}; !reflect.DeepEqual(suggestions, expected) {
+		t.Errorf("expected %v but got %v", expected, suggestions)
+	}
+
+	suggestions, err = cityCol.Suggest("cities", "name", "pa", 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if expected := []string{"paris"}; !reflect.DeepEqual(suggestions, expected) {
+		t.Errorf("expected %v but got %v", expected, suggestions)
+	}
+
+	// Deleted documents are not counted anymore
+	err = cityCol.Delete("5")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	terms, err := cityCol.FieldTerms("cities", "name")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []*TermFrequency{
+		{"lyon", 1},
+		{"old", 1},
+		{"paris", 3},
+		{"pau", 1},
+		{"texas", 1},
+	}
+	if !reflect.DeepEqual(terms, expected) {
+		t.Errorf("unexpected terms %v", terms)
+		for _, term := range terms {
+			t.Log(term.Term, term.Count)
+		}
+	}
+
+	_, err = cityCol.Suggest("not existing", "name", "pa", 1)
+	if err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+}
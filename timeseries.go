@@ -0,0 +1,512 @@
+package gotinydb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/dgraph-io/badger"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Those constants defines the second level of prefixes of the time series
+const (
+	prefixTimeSeriesPoints byte = iota
+	prefixTimeSeriesRollups
+)
+
+type (
+	// TimeSeries stores points ordered by time. The points older than the retention
+	// are dropped by Badger without any cleaning record and the rollups summarize
+	// the points of fixed intervals in the background.
+	TimeSeries struct {
+		db     *DB
+		name   string
+		prefix []byte
+
+		// lock protects the settings
+		lock      sync.Mutex
+		retention time.Duration
+		rollups   []*rollupSettings
+		// computeLock serializes the rollups computations
+		computeLock sync.Mutex
+
+		// lastID keeps the points with the same time in the insertion order
+		lastID int64
+	}
+
+	rollupSettings struct {
+		interval, retention time.Duration
+		// next is the start of the first interval not computed yet, zero means from the first point
+		next time.Time
+		// dirty is the start of the oldest computed interval which received a point, zero if none
+		dirty time.Time
+	}
+
+	// Point is a value of a time series with an optional content like an event payload
+	Point struct {
+		Time    time.Time
+		Value   float64
+		Content []byte
+	}
+
+	// Rollup summarizes the points of one interval
+	Rollup struct {
+		Start    time.Time
+		Interval time.Duration
+		Count    int
+		Min      float64
+		Max      float64
+		Sum      float64
+		Avg      float64
+	}
+
+	// pointValue is the saved part of a point, the time is in the key
+	pointValue struct {
+		Value   float64
+		Content []byte `json:",omitempty"`
+	}
+)
+
+// UseTimeSeries returns the time series with the given name. The points older than the retention are
+// dropped automatically, zero keeps them forever. The retention applies to the points added afterward
+// and is not saved, it must be given every time the database is opened.
+func (d *DB) UseTimeSeries(name string, retention time.Duration) *TimeSeries {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	ts, ok := d.timeSeries[name]
+	if !ok {
+		hash := blake2b.Sum256([]byte(name))
+		ts = &TimeSeries{
+			db:     d,
+			name:   name,
+			prefix: append([]byte{prefixTimeSeries}, hash[:]...),
+		}
+		d.timeSeries[name] = ts
+	}
+
+	ts.lock.Lock()
+	ts.retention = retention
+	ts.lock.Unlock()
+
+	return ts
+}
+
+// Name returns the name of the time series
+func (ts *TimeSeries) Name() string {
+	return ts.name
+}
+
+// Add saves the points in one write. The points without time are added at the present time
+// and the points already out of the retention are ignored.
+func (ts *TimeSeries) Add(points ...*Point) error {
+	ts.lock.Lock()
+	retention := ts.retention
+	ts.lock.Unlock()
+
+	now := time.Now()
+	ops := []*transaction.Operation{}
+	oldest := time.Time{}
+	for _, point := range points {
+		t := point.Time
+		if t.IsZero() {
+			t = now
+		}
+
+		var expiresAt uint64
+		if retention > 0 {
+			expire := t.Add(retention)
+			if !expire.After(now) {
+				continue
+			}
+			expiresAt = unixCeil(expire)
+		}
+
+		value, err := json.Marshal(&pointValue{Value: point.Value, Content: point.Content})
+		if err != nil {
+			return err
+		}
+
+		op := transaction.NewOperation("", nil, ts.pointKey(t), value, false, false)
+		op.ExpiresAt = expiresAt
+		ops = append(ops, op)
+
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	err := ts.db.write(ops...)
+	if err != nil {
+		return err
+	}
+
+	ts.touch(oldest)
+	return nil
+}
+
+// Range returns the points from the given time to the end time excluded.
+// A zero time means the first or the last point.
+func (ts *TimeSeries) Range(from, to time.Time) (points []*Point, err error) {
+	err = ts.ForEach(context.Background(), from, to, func(point *Point) error {
+		points = append(points, point)
+		return nil
+	})
+	return
+}
+
+// ForEach calls fn with the points from the given time to the end time excluded in the time order.
+// A zero time means the first or the last point. The iteration stops at the first error of fn or
+// when the context is done.
+func (ts *TimeSeries) ForEach(ctx context.Context, from, to time.Time, fn func(point *Point) error) error {
+	prefix := ts.pointsPrefix()
+
+	return ts.db.badger.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		start := prefix
+		if !from.IsZero() {
+			start = append(prefix, encodeTime(from)...)
+		}
+
+		for iter.Seek(start); iter.ValidForPrefix(prefix); iter.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			item := iter.Item()
+			t := decodeTime(item.Key()[len(prefix):])
+			if !to.IsZero() && !t.Before(to) {
+				return nil
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			value, err = ts.db.decryptData(item.Key(), value)
+			if err != nil {
+				return err
+			}
+
+			saved := new(pointValue)
+			err = json.Unmarshal(value, saved)
+			if err != nil {
+				return err
+			}
+
+			err = fn(&Point{Time: t, Value: saved.Value, Content: saved.Content})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SetRollup computes in the background the count, min, max, sum and average of the points of
+// every interval. The rollups are kept for their own retention, zero keeps them forever.
+// An interval is computed once it's over and again if a point is added to it.
+// The setting is not saved, it must be given every time the database is opened.
+// The computation continues after the last saved rollup. The points added to an already
+// computed interval while the setting is not given, like before a reopen, are not part
+// of its rollup.
+// The failed computations are reported to the logger set by *DB.SetLogger.
+func (ts *TimeSeries) SetRollup(interval, retention time.Duration) error {
+	if interval <= 0 {
+		return ErrInvalidRollup
+	}
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for _, settings := range ts.rollups {
+		if settings.interval == interval {
+			settings.retention = retention
+			return nil
+		}
+	}
+
+	settings := &rollupSettings{
+		interval:  interval,
+		retention: retention,
+	}
+
+	// Continues after the last saved rollup
+	prefix := ts.rollupsPrefix(interval)
+	err := ts.db.badger.View(func(txn *badger.Txn) error {
+		iterOptions := badger.DefaultIteratorOptions
+		iterOptions.Reverse = true
+		iterOptions.PrefetchValues = false
+		iter := txn.NewIterator(iterOptions)
+		defer iter.Close()
+
+		iter.Seek(prefixUpperBound(prefix))
+		if iter.ValidForPrefix(prefix) {
+			settings.next = decodeTime(iter.Item().Key()[len(prefix):]).Add(interval)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ts.rollups = append(ts.rollups, settings)
+	return nil
+}
+
+// Rollups returns the saved rollups of the interval which start from the given time to the end time excluded.
+// A zero time means the first or the last rollup.
+func (ts *TimeSeries) Rollups(interval time.Duration, from, to time.Time) (rollups []*Rollup, err error) {
+	prefix := ts.rollupsPrefix(interval)
+
+	err = ts.db.badger.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		start := prefix
+		if !from.IsZero() {
+			start = append(prefix, encodeTime(from)...)
+		}
+
+		for iter.Seek(start); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+			if !to.IsZero() && !decodeTime(item.Key()[len(prefix):]).Before(to) {
+				return nil
+			}
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			value, err = ts.db.decryptData(item.Key(), value)
+			if err != nil {
+				return err
+			}
+
+			rollup := new(Rollup)
+			err = json.Unmarshal(value, rollup)
+			if err != nil {
+				return err
+			}
+			rollups = append(rollups, rollup)
+		}
+
+		return nil
+	})
+	return
+}
+
+// touch marks the computed intervals which received a point to compute them again
+func (ts *TimeSeries) touch(t time.Time) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for _, settings := range ts.rollups {
+		if settings.next.IsZero() || !t.Before(settings.next) {
+			continue
+		}
+
+		start := t.Truncate(settings.interval)
+		if settings.dirty.IsZero() || start.Before(settings.dirty) {
+			settings.dirty = start
+		}
+	}
+}
+
+// computeRollups saves the rollups of the intervals over before the given time
+func (ts *TimeSeries) computeRollups(now time.Time) error {
+	ts.computeLock.Lock()
+	defer ts.computeLock.Unlock()
+
+	ts.lock.Lock()
+	list := make([]*rollupSettings, len(ts.rollups))
+	copy(list, ts.rollups)
+	ts.lock.Unlock()
+
+	for _, settings := range list {
+		err := ts.computeRollup(settings, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// computeRollup saves the rollups of one setting.
+// The lock is only held to read and update the setting so the points are added during the scan.
+func (ts *TimeSeries) computeRollup(settings *rollupSettings, now time.Time) (err error) {
+	ts.lock.Lock()
+	interval, retention := settings.interval, settings.retention
+	from := settings.next
+	if !settings.dirty.IsZero() && (from.IsZero() || settings.dirty.Before(from)) {
+		from = settings.dirty
+	}
+
+	to := now.Truncate(interval)
+	if !from.IsZero() && !from.Before(to) {
+		ts.lock.Unlock()
+		return nil
+	}
+
+	// The points added from now before the end are marked to be computed again
+	settings.next = to
+	settings.dirty = time.Time{}
+	ts.lock.Unlock()
+
+	// The intervals are computed again at the next run if anything goes wrong
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		ts.lock.Lock()
+		defer ts.lock.Unlock()
+		if from.IsZero() {
+			settings.next = time.Time{}
+		} else if settings.dirty.IsZero() || from.Before(settings.dirty) {
+			settings.dirty = from
+		}
+	}()
+
+	rollups := []*Rollup{}
+	err = ts.ForEach(ts.db.ctx, from, to, func(point *Point) error {
+		start := point.Time.Truncate(interval)
+
+		if len(rollups) == 0 || !rollups[len(rollups)-1].Start.Equal(start) {
+			rollups = append(rollups, &Rollup{
+				Start:    start,
+				Interval: interval,
+				Min:      math.Inf(1),
+				Max:      math.Inf(-1),
+			})
+		}
+
+		rollup := rollups[len(rollups)-1]
+		rollup.Count++
+		rollup.Sum += point.Value
+		rollup.Min = math.Min(rollup.Min, point.Value)
+		rollup.Max = math.Max(rollup.Max, point.Value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ops := []*transaction.Operation{}
+	for _, rollup := range rollups {
+		rollup.Avg = rollup.Sum / float64(rollup.Count)
+
+		var expiresAt uint64
+		if retention > 0 {
+			expire := rollup.Start.Add(interval + retention)
+			if !expire.After(now) {
+				continue
+			}
+			expiresAt = unixCeil(expire)
+		}
+
+		value, err := json.Marshal(rollup)
+		if err != nil {
+			return err
+		}
+
+		op := transaction.NewOperation("", nil, ts.rollupKey(interval, rollup.Start), value, false, false)
+		op.ExpiresAt = expiresAt
+		ops = append(ops, op)
+	}
+
+	if len(ops) != 0 {
+		err = ts.db.write(ops...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *DB) goRoutineLoopForRollups() {
+	ticker := time.NewTicker(RollupsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.computeRollups(time.Now())
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// computeRollups computes the rollups of every time series and logs the failures.
+// The failed intervals are computed again at the next run.
+func (d *DB) computeRollups(now time.Time) {
+	d.lock.RLock()
+	logger := d.logger
+	list := make([]*TimeSeries, 0, len(d.timeSeries))
+	for _, ts := range d.timeSeries {
+		list = append(list, ts)
+	}
+	d.lock.RUnlock()
+
+	for _, ts := range list {
+		err := ts.computeRollups(now)
+		if err != nil {
+			logger.Errorf("computing the rollups of the time series %q: %s", ts.name, err.Error())
+		}
+	}
+}
+
+func (ts *TimeSeries) pointsPrefix() []byte {
+	return append(append([]byte{}, ts.prefix...), prefixTimeSeriesPoints)
+}
+
+// pointKey returns the key of a point ordered by time then by insertion
+func (ts *TimeSeries) pointKey(t time.Time) []byte {
+	key := append(ts.pointsPrefix(), encodeTime(t)...)
+	return append(key, nextTimeID(&ts.lastID)...)
+}
+
+func (ts *TimeSeries) rollupsPrefix(interval time.Duration) []byte {
+	prefix := append(append([]byte{}, ts.prefix...), prefixTimeSeriesRollups)
+	prefix = append(prefix, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(prefix[len(prefix)-8:], uint64(interval))
+	return prefix
+}
+
+func (ts *TimeSeries) rollupKey(interval time.Duration, start time.Time) []byte {
+	return append(ts.rollupsPrefix(interval), encodeTime(start)...)
+}
+
+// encodeTime returns the time as 8 bytes which keep the time order, even before 1970
+func encodeTime(t time.Time) []byte {
+	ret := make([]byte, 8)
+	binary.BigEndian.PutUint64(ret, uint64(t.UnixNano())^1<<63)
+	return ret
+}
+
+func decodeTime(asBytes []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(asBytes[:8])^1<<63))
+}
+
+// unixCeil returns the Unix time in seconds rounded up
+func unixCeil(t time.Time) uint64 {
+	ret := t.Unix()
+	if t.Nanosecond() != 0 {
+		ret++
+	}
+	return uint64(ret)
+}
@@ -0,0 +1,241 @@
+package gotinydb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+func TestTimeSeries(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	ts := testDB.UseTimeSeries("metrics", time.Hour*24)
+	if ts != testDB.UseTimeSeries("metrics", time.Hour*24) {
+		t.Errorf("the same time series must be returned")
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+
+	points := []*Point{}
+	for i := 0; i < 30; i++ {
+		points = append(points, &Point{Time: base.Add(time.Second * time.Duration(i*10)), Value: float64(i)})
+	}
+	// Same time as an other point
+	points = append(points, &Point{Time: base, Value: 100, Content: []byte("event")})
+	// Out of the retention
+	points = append(points, &Point{Time: base.Add(-time.Hour * 48), Value: 1})
+
+	err = ts.Add(points...)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	all, err := ts.Range(time.Time{}, time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(all) != 31 {
+		t.Errorf("expected %d points but got %d", 31, len(all))
+		return
+	}
+	if !all[0].Time.Equal(base) || all[0].Value != 0 || all[1].Value != 100 || string(all[1].Content) != "event" {
+		t.Errorf("unexpected first points %+v %+v", all[0], all[1])
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Time.Before(all[i-1].Time) {
+			t.Errorf("the points are not ordered")
+		}
+	}
+
+	window, _ := ts.Range(base.Add(time.Minute), base.Add(time.Minute*2))
+	if len(window) != 6 || window[0].Value != 6 || window[5].Value != 11 {
+		t.Errorf("unexpected window %v", window)
+	}
+
+	stop := fmt.Errorf("stop")
+	if err = ts.ForEach(context.Background(), time.Time{}, time.Time{}, func(*Point) error { return stop }); err != stop {
+		t.Errorf("expected %v but got %v", stop, err)
+	}
+
+	// Rollups of the complete minutes
+	if err = ts.SetRollup(0, 0); err != ErrInvalidRollup {
+		t.Errorf("expected %v but got %v", ErrInvalidRollup, err)
+	}
+	if err = ts.SetRollup(time.Minute, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if err = ts.computeRollups(base.Add(time.Minute*4 + time.Second)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	rollups, err := ts.Rollups(time.Minute, time.Time{}, time.Time{})
+	if err != nil || len(rollups) != 4 {
+		t.Errorf("unexpected rollups %v %v", rollups, err)
+		return
+	}
+	if r := rollups[1]; !r.Start.Equal(base.Add(time.Minute)) || r.Count != 6 || r.Min != 6 || r.Max != 11 || r.Sum != 51 || r.Avg != 8.5 {
+		t.Errorf("unexpected rollup %+v", r)
+	}
+	if r := rollups[0]; r.Count != 7 || r.Max != 100 {
+		t.Errorf("unexpected rollup %+v", r)
+	}
+
+	// A late point computes its interval again
+	ts.Add(&Point{Time: base.Add(time.Minute + time.Second), Value: -3})
+	if err = ts.computeRollups(base.Add(time.Minute*5 + time.Second)); err != nil {
+		t.Error(err)
+		return
+	}
+	rollups, _ = ts.Rollups(time.Minute, base.Add(time.Minute), base.Add(time.Minute*2))
+	if len(rollups) != 1 || rollups[0].Count != 7 || rollups[0].Min != -3 {
+		t.Errorf("unexpected rollups after the late point %v", rollups)
+	}
+	if rollups, _ = ts.Rollups(time.Minute, time.Time{}, time.Time{}); len(rollups) != 5 {
+		t.Errorf("expected %d rollups but got %d", 5, len(rollups))
+	}
+
+	// The next computations continue after the saved rollups
+	other := testDB.UseTimeSeries("other", 0)
+	other.Add(&Point{Time: base, Value: 1})
+	other.SetRollup(time.Minute, 0)
+	other.computeRollups(base.Add(time.Minute))
+	other.rollups = nil
+	other.SetRollup(time.Minute, 0)
+	if next := other.rollups[0].next; !next.Equal(base.Add(time.Minute)) {
+		t.Errorf("the rollups must continue at %s but got %s", base.Add(time.Minute), next)
+	}
+}
+
+func TestTimeSeriesAddDuringRollups(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	ts := testDB.UseTimeSeries("metrics", 0)
+	if err = ts.SetRollup(time.Minute, 0); err != nil {
+		t.Error(err)
+		return
+	}
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	addPoints := func(n int) {
+		for i := 0; i < n; i++ {
+			err := ts.Add(&Point{Time: base.Add(time.Second * time.Duration(i*3)), Value: 1})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+	addPoints(200)
+
+	// The points added while the rollups are computed are not lost
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := ts.computeRollups(base.Add(time.Minute * 10)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	addPoints(200)
+	<-done
+
+	if err = ts.computeRollups(base.Add(time.Minute * 10)); err != nil {
+		t.Error(err)
+		return
+	}
+
+	rollups, err := ts.Rollups(time.Minute, time.Time{}, time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	count := 0
+	for _, rollup := range rollups {
+		count += rollup.Count
+	}
+	if count != 400 {
+		t.Errorf("expected %d points in the rollups but got %d", 400, count)
+	}
+}
+
+func TestTimeSeriesRetention(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	ts := testDB.UseTimeSeries("short", time.Second)
+	err = ts.Add(&Point{Value: 1}, &Point{Time: time.Now().Add(time.Hour), Value: 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if points, _ := ts.Range(time.Time{}, time.Time{}); len(points) != 2 {
+		t.Errorf("expected %d points but got %d", 2, len(points))
+	}
+
+	time.Sleep(time.Second * 2)
+
+	points, _ := ts.Range(time.Time{}, time.Time{})
+	if len(points) != 1 || points[0].Value != 2 {
+		t.Errorf("the expired point is returned %v", points)
+	}
+}
+
+type testLogger struct {
+	fakeLogger
+	errors []string
+}
+
+func (l *testLogger) Errorf(base string, elems ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(base, elems...))
+}
+
+func TestTimeSeriesRollupsErrors(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	logger := new(testLogger)
+	testDB.SetLogger(logger)
+
+	// A point which can't be decrypted
+	ts := testDB.UseTimeSeries("broken", 0)
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	err = testDB.badger.Update(func(txn *badger.Txn) error {
+		return txn.Set(ts.pointKey(base), []byte("not encrypted"))
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ts.SetRollup(time.Minute, 0)
+	testDB.computeRollups(base.Add(time.Minute))
+
+	if len(logger.errors) != 1 || !strings.Contains(logger.errors[0], `"broken"`) {
+		t.Errorf("the failed rollups must be logged but got %v", logger.errors)
+	}
+}
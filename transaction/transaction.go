@@ -21,6 +21,23 @@ type (
 
 		DBKey, Value         []byte
 		Delete, CleanHistory bool
+		// ExpiresAt is the Unix time when Badger drops the value, zero means never
+		ExpiresAt uint64
+
+		// MetaKey is the key of the document metadata updated by the operation
+		MetaKey []byte
+		// Writer is saved into the document metadata
+		Writer string
+		// Meta is the JSON encoded document metadata set when the operation is written
+		Meta []byte
+
+		// Patch builds the value from the saved one when the operation is written
+		Patch func(current []byte) ([]byte, error)
+		// Upsert calls Patch with a nil value if nothing is saved instead of failing
+		Upsert bool
+		// Condition checks the saved value before the operation is written.
+		// The operation fails if it returns an error.
+		Condition func(current []byte, found bool) error
 	}
 )
 
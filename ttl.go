@@ -130,17 +130,8 @@ start:
 		return
 	}
 
-	// Do the writing:
-	select {
-	case d.writeChan <- tr:
-	case <-localCtx.Done():
-		return
-	}
-
-	select {
-	case <-tr.ResponseChan:
-	case <-tr.Ctx.Done():
-	}
+	// Do the writing, on error the records are cleaned at the next run
+	d.sendTransaction(tr)
 
 	if nextRun == 0 {
 		nextRun = time.Second
@@ -0,0 +1,202 @@
+package gotinydb
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/blevesearch/bleve/search/query"
+)
+
+type (
+	// TypedCollection is a collection bound to a struct type.
+	// The values are checked when saved and freshly allocated when read.
+	TypedCollection struct {
+		c   *Collection
+		typ reflect.Type
+	}
+
+	// TypedIterator lists the documents of a TypedCollection
+	TypedIterator struct {
+		tc      *TypedCollection
+		iter    *CollectionIterator
+		started bool
+	}
+
+	// TypedSearchIterator lists the hits of a search over a TypedCollection
+	TypedSearchIterator struct {
+		tc   *TypedCollection
+		iter *SearchIterator
+	}
+)
+
+// UseTyped does the same as *DB.Use but returns a collection bound to the type of the sample.
+// The sample must be a struct or a pointer to a struct.
+func (d *DB) UseTyped(colName string, sample interface{}) (*TypedCollection, error) {
+	t := reflect.TypeOf(sample)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, ErrNotStruct
+	}
+
+	col, err := d.Use(colName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedCollection{
+		c:   col,
+		typ: t,
+	}, nil
+}
+
+// Collection returns the underlying collection
+func (tc *TypedCollection) Collection() *Collection {
+	return tc.c
+}
+
+// Type returns the struct type of the collection
+func (tc *TypedCollection) Type() reflect.Type {
+	return tc.typ
+}
+
+// newValue returns a pointer to a new zero value of the collection type
+func (tc *TypedCollection) newValue() interface{} {
+	return reflect.New(tc.typ).Interface()
+}
+
+// checkType returns ErrWrongType if the value is not of the collection type or a pointer to it
+func (tc *TypedCollection) checkType(value interface{}) error {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return ErrWrongType
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ErrWrongType
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() != tc.typ {
+		return ErrWrongType
+	}
+
+	return nil
+}
+
+// SetIndex adds a Bleve index with the mapping built by MappingFromStruct from the collection type
+func (tc *TypedCollection) SetIndex(name string) error {
+	return tc.c.SetBleveIndexFor(name, tc.newValue())
+}
+
+// Put saves the value which must be of the collection type or a pointer to it
+func (tc *TypedCollection) Put(id string, value interface{}, options ...WriteOption) error {
+	err := tc.checkType(value)
+	if err != nil {
+		return err
+	}
+
+	return tc.c.Put(id, value, options...)
+}
+
+// PutWithTTL does the same as *TypedCollection.Put but the document is removed after the TTL
+func (tc *TypedCollection) PutWithTTL(id string, value interface{}, ttl time.Duration, options ...WriteOption) error {
+	err := tc.checkType(value)
+	if err != nil {
+		return err
+	}
+
+	return tc.c.PutWithTTL(id, value, ttl, options...)
+}
+
+// Get returns a pointer to a new value of the collection type filled up with the saved document
+func (tc *TypedCollection) Get(id string) (interface{}, error) {
+	value := tc.newValue()
+	_, err := tc.c.Get(id, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Delete removes the document
+func (tc *TypedCollection) Delete(id string) error {
+	return tc.c.Delete(id)
+}
+
+// GetIterator returns an iterator over all the documents of the collection
+func (tc *TypedCollection) GetIterator() *TypedIterator {
+	return &TypedIterator{
+		tc:   tc,
+		iter: tc.c.GetIterator(),
+	}
+}
+
+// GetRevertedIterator does the same as *TypedCollection.GetIterator in the opposite order
+func (tc *TypedCollection) GetRevertedIterator() *TypedIterator {
+	return &TypedIterator{
+		tc:   tc,
+		iter: tc.c.GetRevertedIterator(),
+	}
+}
+
+// Search returns an iterator over the hits of the query on the given index
+func (tc *TypedCollection) Search(indexName string, q query.Query, options *SearchOptions) (*TypedSearchIterator, error) {
+	iter, err := tc.c.NewSearchIterator(indexName, q, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedSearchIterator{
+		tc:   tc,
+		iter: iter,
+	}, nil
+}
+
+// Next returns the next document as a pointer to a new value of the collection type.
+// It returns ErrEndOfQueryResult when all the documents has been returned.
+// The decoding errors are returned with the ID of the document.
+func (i *TypedIterator) Next() (id string, v interface{}, err error) {
+	if i.started {
+		i.iter.Next()
+	}
+	i.started = true
+
+	if !i.iter.Valid() {
+		return "", nil, ErrEndOfQueryResult
+	}
+
+	value := i.tc.newValue()
+	err = i.iter.GetValue(value)
+	if err != nil {
+		return i.iter.GetID(), nil, err
+	}
+
+	return i.iter.GetID(), value, nil
+}
+
+// Close closes the iterator. It needs to be called ones the iterator is no more needed.
+func (i *TypedIterator) Close() {
+	i.iter.Close()
+}
+
+// Next returns the next hit as a pointer to a new value of the collection type.
+// It returns ErrEndOfQueryResult when all the hits has been returned.
+func (i *TypedSearchIterator) Next() (id string, v interface{}, err error) {
+	value := i.tc.newValue()
+	id, err = i.iter.Next(value)
+	if err != nil {
+		return id, nil, err
+	}
+
+	return id, value, nil
+}
+
+// Total returns the number of documents matching the query
+func (i *TypedSearchIterator) Total() (uint64, error) {
+	return i.iter.Total()
+}
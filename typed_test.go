@@ -0,0 +1,109 @@
+package gotinydb
+
+import (
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+func TestTypedCollection(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	if _, err = testDB.UseTyped("typed", "not a struct"); err != ErrNotStruct {
+		t.Errorf("expected %v but got %v", ErrNotStruct, err)
+	}
+
+	users, err := testDB.UseTyped("typed", testUserStruct{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = users.SetIndex("users")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Values and pointers are accepted
+	err = users.Put("a", *testUser)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = users.Put("b", cloneTestUser)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, value := range []interface{}{nil, (*testUserStruct)(nil), &Account{}, map[string]string{"name": "toto"}} {
+		if err = users.Put("c", value); err != ErrWrongType {
+			t.Errorf("expected %v with %T but got %v", ErrWrongType, value, err)
+		}
+	}
+
+	value, err := users.Get("a")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	user, ok := value.(*testUserStruct)
+	if !ok || user.Name != testUser.Name || user.Oauth.URL != testUser.Oauth.URL {
+		t.Errorf("unexpected value %v", value)
+	}
+	if _, err = users.Get("unknown"); err != ErrNotFound {
+		t.Errorf("expected %v but got %v", ErrNotFound, err)
+	}
+
+	// A document saved without the type check can't be decoded
+	users.Collection().Put("bad", map[string]interface{}{"name": 42})
+
+	iter := users.GetIterator()
+	defer iter.Close()
+	ids := []string{}
+	for {
+		id, value, err := iter.Next()
+		if err == ErrEndOfQueryResult {
+			break
+		}
+		if id == "bad" {
+			if err == nil || value != nil {
+				t.Errorf("expected a decoding error but got %v and %v", value, err)
+			}
+			continue
+		} else if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if _, ok := value.(*testUserStruct); !ok {
+			t.Errorf("unexpected value type %T", value)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("unexpected ids %v", ids)
+	}
+
+	searchIter, err := users.Search("users", bleve.NewMatchQuery("clone"), nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	id, value, err := searchIter.Next()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if user, ok := value.(*testUserStruct); id != "b" || !ok || user.Name != cloneTestUser.Name {
+		t.Errorf("unexpected hit %q %v", id, value)
+	}
+	if _, _, err = searchIter.Next(); err != ErrEndOfQueryResult {
+		t.Errorf("expected %v but got %v", ErrEndOfQueryResult, err)
+	}
+}
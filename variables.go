@@ -12,12 +12,17 @@ const (
 	prefixFiles
 	prefixFilesRelated
 	prefixTTL
+	prefixQueues
+	prefixTimeSeries
+	prefixKV
+	prefixCounters
 )
 
 // Those constants defines the second level of prefixes or value from config.
 const (
 	prefixCollectionsData byte = iota
 	prefixCollectionsBleveIndex
+	prefixCollectionsMeta
 )
 
 // This defines most of the package errors
@@ -26,11 +31,27 @@ var (
 	ErrHashCollision                           = fmt.Errorf("the name is in collision with an other element")
 	ErrEmptyID                                 = fmt.Errorf("ID must be provided")
 	ErrIndexNotFound                           = fmt.Errorf("index not found")
+	ErrCollectionNotFound                      = fmt.Errorf("collection not found")
 	ErrNameAllreadyExists                      = fmt.Errorf("element with the same name allready exists")
 	ErrIndexAllreadyExistsWithDifferentMapping = fmt.Errorf("index with the same name allready exists with different mapping")
 	ErrGetMultiNotEqual                        = fmt.Errorf("you must provied the same number of ids and destinations")
+	ErrIndexInBuild                            = fmt.Errorf("the index is already in build")
 
 	ErrEndOfQueryResult = fmt.Errorf("there is no more values to retrieve from the query")
+	ErrNotSlicePointer  = fmt.Errorf("the destination must be a pointer to a slice")
+	ErrInvalidCursor    = fmt.Errorf("the cursor is not valid for this iteration")
+
+	ErrNotStruct          = fmt.Errorf("the sample must be a struct or a pointer to a struct")
+	ErrWrongType          = fmt.Errorf("the value does not match the type of the collection")
+	ErrInvalidSchema      = fmt.Errorf("the JSON schema is not valid")
+	ErrInvalidPatch       = fmt.Errorf("the patch is not valid")
+	ErrPatchTestFailed    = fmt.Errorf("the JSON Patch test operation failed")
+	ErrInvalidAggregation = fmt.Errorf("the aggregation must have a unique name, a field and a valid type with its settings")
+	ErrInvalidFilter      = fmt.Errorf("the filter is not valid")
+	ErrInvalidVectorIndex = fmt.Errorf("the vector index must have a path, positive dimensions and a known metric")
+	ErrInvalidVector      = fmt.Errorf("the vector must have the dimensions of the index")
+	ErrInvalidRollup      = fmt.Errorf("the rollup interval must be positive")
+	ErrInvalidIncrement   = fmt.Errorf("the path of the increment must lead to a number")
 
 	ErrFileInWrite              = fmt.Errorf("this file is already in write mode")
 	ErrFileItemIteratorNotValid = fmt.Errorf("item is not valid")
@@ -43,6 +64,11 @@ var (
 	// close itself. The goal of this is to prevent having many reader/writer
 	// left open by mistake.
 	ReaderWriterTimeout = time.Minute * 10
+	// QueueMaxAttempts define the default number of deliveries of a queue message
+	// before it's moved to the dead letters
+	QueueMaxAttempts = 5
+	// RollupsInterval define the time between two computations of the time series rollups
+	RollupsInterval = time.Minute
 )
 
 type fakeLogger struct{}
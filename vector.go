@@ -0,0 +1,957 @@
+package gotinydb
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexandrestein/gotinydb/cipher"
+	"github.com/alexandrestein/gotinydb/transaction"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/dgraph-io/badger"
+	"golang.org/x/crypto/blake2b"
+)
+
+type (
+	// VectorMetric defines how the distance between two vectors is computed
+	VectorMetric string
+
+	// VectorIndex indexes a vector field of the documents for nearest neighbors searches.
+	// It is a Hierarchical Navigable Small World graph kept in memory and every node
+	// of the graph is saved encrypted into Badger under the index prefix.
+	// The nodes are saved after the documents so the graph can miss the last writes after
+	// a crash. *Collection.VerifyIndex checks it and *Collection.RebuildIndex builds it again.
+	VectorIndex struct {
+		dbElement
+
+		path   string
+		dims   int
+		metric VectorMetric
+
+		collection *Collection
+
+		// lock protects the graph
+		lock  *sync.RWMutex
+		nodes map[string]*vectorNode
+		// entryPoint is the ID of a node of the highest level
+		entryPoint string
+		random     *rand.Rand
+	}
+
+	vectorIndexExport struct {
+		Name   string
+		Prefix []byte
+		Path   string
+		Dims   int
+		Metric VectorMetric
+	}
+
+	// vectorNode is a document of the graph
+	vectorNode struct {
+		Vector []float32
+		// Neighbors holds the IDs of the connected nodes for every level of the node
+		Neighbors [][]string
+	}
+
+	vectorCandidate struct {
+		id       string
+		distance float64
+	}
+
+	// vectorHeap orders the candidates by distance, the farthest first if max is set
+	vectorHeap struct {
+		candidates []*vectorCandidate
+		max        bool
+	}
+)
+
+// Those are the supported vector metrics
+const (
+	// VectorMetricCosine is one minus the cosine similarity
+	VectorMetricCosine VectorMetric = "cosine"
+	// VectorMetricEuclidean is the euclidean distance
+	VectorMetricEuclidean VectorMetric = "euclidean"
+	// VectorMetricDotProduct is the opposite of the dot product
+	VectorMetricDotProduct VectorMetric = "dot"
+)
+
+// Those constants defines the HNSW graph settings
+const (
+	// vectorMaxNeighbors is the number of connections of a node per level
+	vectorMaxNeighbors = 16
+	// vectorMaxNeighborsLevel0 is the number of connections of a node on the lowest level
+	vectorMaxNeighborsLevel0 = 2 * vectorMaxNeighbors
+	// vectorEfConstruction is the number of candidates used to connect a new node
+	vectorEfConstruction = 100
+	// vectorEfSearch is the minimum number of candidates used by a search
+	vectorEfSearch = 64
+	// vectorBruteForceLimit is the number of documents allowed by a filter
+	// under which every allowed document is compared instead of searching the graph
+	vectorBruteForceLimit = 1000
+)
+
+// vectorLevelFactor normalizes the random levels of the nodes
+var vectorLevelFactor = 1 / math.Log(vectorMaxNeighbors)
+
+func newVectorIndex(name string, prefix []byte, path string, dims int, metric VectorMetric) *VectorIndex {
+	return &VectorIndex{
+		dbElement: dbElement{
+			name:   name,
+			prefix: prefix,
+		},
+		path:   path,
+		dims:   dims,
+		metric: metric,
+		lock:   new(sync.RWMutex),
+		nodes:  map[string]*vectorNode{},
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Path returns the JSON path of the indexed vectors
+func (i *VectorIndex) Path() string {
+	return i.path
+}
+
+// Dims returns the number of dimensions of the indexed vectors
+func (i *VectorIndex) Dims() int {
+	return i.dims
+}
+
+// Metric returns the metric used to compare the vectors
+func (i *VectorIndex) Metric() VectorMetric {
+	return i.metric
+}
+
+// Len returns the number of indexed documents
+func (i *VectorIndex) Len() int {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return len(i.nodes)
+}
+
+func (i *VectorIndex) export() *vectorIndexExport {
+	return &vectorIndexExport{
+		Name:   i.name,
+		Prefix: i.prefix,
+		Path:   i.path,
+		Dims:   i.dims,
+		Metric: i.metric,
+	}
+}
+
+// SetVectorIndex adds a vector index to the collection.
+// The vectors are read at the given JSON path of the documents and must be arrays of
+// dims numbers. The documents without a valid vector are not indexed.
+// The existing documents are indexed before returning.
+func (c *Collection) SetVectorIndex(name, jsonPath string, dims int, metric VectorMetric) error {
+	if dims <= 0 || jsonPath == "" ||
+		(metric != VectorMetricCosine && metric != VectorMetricEuclidean && metric != VectorMetricDotProduct) {
+		return ErrInvalidVectorIndex
+	}
+
+	prefix := c.buildIndexPrefix()
+	indexHash := blake2b.Sum256([]byte(name))
+	prefix = append(prefix, indexHash[:2]...)
+
+	index := newVectorIndex(name, prefix, jsonPath, dims, metric)
+	index.collection = c
+
+	c.indexesLock.Lock()
+	// Check there is no conflict name or hash with the other indexes
+	for _, i := range c.vectorIndexes {
+		if i.name == name {
+			c.indexesLock.Unlock()
+			if i.path != jsonPath || i.dims != dims || i.metric != metric {
+				return ErrIndexAllreadyExistsWithDifferentMapping
+			}
+			return ErrNameAllreadyExists
+		}
+		if bytes.Equal(i.prefix, prefix) {
+			c.indexesLock.Unlock()
+			return ErrHashCollision
+		}
+	}
+	for _, i := range c.bleveIndexes {
+		if i.name == name {
+			c.indexesLock.Unlock()
+			return ErrNameAllreadyExists
+		}
+		if bytes.Equal(i.prefix, prefix) {
+			c.indexesLock.Unlock()
+			return ErrHashCollision
+		}
+	}
+	// Add the new index to the list of index of this collection
+	c.vectorIndexes = append(c.vectorIndexes, index)
+	c.indexesLock.Unlock()
+
+	// Index all existing values
+	err := c.db.badger.View(func(txn *badger.Txn) error {
+		return c.indexAllVectors(txn, index)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Save the new settup
+	return c.db.saveConfig()
+}
+
+// indexAllVectors adds every document of the collection visible by the given transaction to the graph
+func (c *Collection) indexAllVectors(txn *badger.Txn, index *VectorIndex) error {
+	iter := txn.NewIterator(badger.DefaultIteratorOptions)
+	defer iter.Close()
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	dirty := map[string]struct{}{}
+
+	colPrefix := c.buildDBKey("")
+	for iter.Seek(colPrefix); iter.ValidForPrefix(colPrefix); iter.Next() {
+		item := iter.Item()
+
+		var err error
+		var itemAsEncryptedBytes []byte
+		itemAsEncryptedBytes, err = item.ValueCopy(itemAsEncryptedBytes)
+		if err != nil {
+			continue
+		}
+
+		var clearBytes []byte
+		clearBytes, err = cipher.Decrypt(c.db.privateKey, item.Key(), itemAsEncryptedBytes)
+		if err != nil {
+			continue
+		}
+
+		id := string(item.Key()[len(colPrefix):])
+		if vector, ok := index.vectorFromJSON(clearBytes); ok {
+			index.add(id, vector, dirty)
+		}
+	}
+
+	return index.persist(dirty)
+}
+
+// GetVectorIndexes returns the names of the vector indexes of the collection
+func (c *Collection) GetVectorIndexes() []string {
+	c.indexesLock.RLock()
+	defer c.indexesLock.RUnlock()
+
+	ret := make([]string, len(c.vectorIndexes))
+	for i, index := range c.vectorIndexes {
+		ret[i] = index.Name()
+	}
+
+	return ret
+}
+
+// GetVectorIndex returns the vector index of the given name
+func (c *Collection) GetVectorIndex(name string) (*VectorIndex, error) {
+	c.indexesLock.RLock()
+	defer c.indexesLock.RUnlock()
+
+	for _, index := range c.vectorIndexes {
+		if index.name == name {
+			return index, nil
+		}
+	}
+	return nil, ErrIndexNotFound
+}
+
+// deleteVectorIndex removes the vector index and its saved graph.
+// The caller must hold the indexes lock.
+func (c *Collection) deleteVectorIndex(name string) error {
+	for i, index := range c.vectorIndexes {
+		if index.name == name {
+			copy(c.vectorIndexes[i:], c.vectorIndexes[i+1:])
+			c.vectorIndexes[len(c.vectorIndexes)-1] = nil
+			c.vectorIndexes = c.vectorIndexes[:len(c.vectorIndexes)-1]
+
+			err := c.db.deletePrefix(index.prefix)
+			if err != nil {
+				return err
+			}
+			return c.db.saveConfig()
+		}
+	}
+
+	return ErrIndexNotFound
+}
+
+// NearestNeighbors returns the k documents of the vector index closest to the given vector
+// ordered by distance. The distance of every document is set into the Distance field of the responses.
+// If filter is not nil only the documents matched by the query in the Bleve index filterIndexName
+// are returned. The error of the filter search is returned, ErrIndexNotFound if the index does not exist.
+func (c *Collection) NearestNeighbors(name string, vector []float32, k int, filterIndexName string, filter query.Query) ([]*Response, error) {
+	index, err := c.GetVectorIndex(name)
+	if err != nil {
+		return nil, err
+	}
+
+	vector, ok := index.prepare(vector)
+	if !ok {
+		return nil, ErrInvalidVector
+	}
+
+	var allowed map[string]struct{}
+	if filter != nil {
+		bleveIndex, release, err := c.useBleveIndex(filterIndexName)
+		if err != nil {
+			return nil, err
+		}
+
+		var ids []string
+		ids, err = bleveIndex.searchIDs(filter)
+		release()
+		if err != nil {
+			return nil, err
+		}
+
+		allowed = make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			allowed[id] = struct{}{}
+		}
+	}
+
+	candidates := index.search(vector, k, allowed)
+
+	ret := make([]*Response, 0, len(candidates))
+	err = c.db.badger.View(func(txn *badger.Txn) error {
+		for _, candidate := range candidates {
+			content, err := c.get(txn, candidate.id, nil)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			ret = append(ret, &Response{
+				ID:         candidate.id,
+				Collection: c.name,
+				Content:    content,
+				Distance:   candidate.distance,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// update applies the operations of a committed transaction to the graph
+func (i *VectorIndex) update(operations []*transaction.Operation) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	dirty := map[string]struct{}{}
+	for _, op := range operations {
+		if op.CollectionID == "" {
+			continue
+		}
+
+		i.remove(op.CollectionID, dirty)
+		if op.Delete {
+			continue
+		}
+
+		if vector, ok := i.vectorFromJSON(op.Value); ok {
+			i.add(op.CollectionID, vector, dirty)
+		}
+	}
+
+	return i.persist(dirty)
+}
+
+// load reads the saved graph
+func (i *VectorIndex) load() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.nodes = map[string]*vectorNode{}
+	i.entryPoint = ""
+
+	return i.collection.db.badger.View(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer iter.Close()
+
+		for iter.Seek(i.prefix); iter.ValidForPrefix(i.prefix); iter.Next() {
+			item := iter.Item()
+			key := item.KeyCopy(nil)
+
+			encryptedValue, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			var nodeAsBytes []byte
+			nodeAsBytes, err = i.collection.db.decryptData(key, encryptedValue)
+			if err != nil {
+				return err
+			}
+
+			node := new(vectorNode)
+			err = json.Unmarshal(nodeAsBytes, node)
+			if err != nil {
+				return err
+			}
+
+			id := string(key[len(i.prefix):])
+			i.nodes[id] = node
+			if i.entryPoint == "" || len(node.Neighbors) > len(i.nodes[i.entryPoint].Neighbors) {
+				i.entryPoint = id
+			}
+		}
+
+		return nil
+	})
+}
+
+// persist saves the given nodes or deletes them if they are not in the graph anymore.
+// The caller must hold the lock.
+func (i *VectorIndex) persist(dirty map[string]struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tr := transaction.New(ctx)
+	for id := range dirty {
+		key := make([]byte, len(i.prefix))
+		copy(key, i.prefix)
+		key = append(key, []byte(id)...)
+
+		node, ok := i.nodes[id]
+		if !ok {
+			tr.AddOperation(transaction.NewOperation("", nil, key, nil, true, false))
+		} else {
+			nodeAsBytes, err := json.Marshal(node)
+			if err != nil {
+				return err
+			}
+			// The nodes are updated often and the history is useless
+			tr.AddOperation(transaction.NewOperation("", nil, key, nodeAsBytes, false, true))
+		}
+
+		// Limit the size of the transactions
+		if len(tr.Operations) >= 1000 {
+			err := i.collection.putSendToWriteAndWaitForResponse(tr)
+			if err != nil {
+				return err
+			}
+			tr = transaction.New(ctx)
+		}
+	}
+
+	if len(tr.Operations) == 0 {
+		return nil
+	}
+	return i.collection.putSendToWriteAndWaitForResponse(tr)
+}
+
+// documentVectors returns the valid vector of every document of the collection
+func (i *VectorIndex) documentVectors() (map[string][]float32, error) {
+	vectors := map[string][]float32{}
+	err := i.collection.Scan(i.collection.db.ctx, &ScanOptions{Ordered: true}, func(id string, clearBytes []byte) error {
+		if vector, ok := i.vectorFromJSON(clearBytes); ok {
+			vectors[id] = vector
+		}
+		return nil
+	})
+	return vectors, err
+}
+
+// verify compares the graph with the vectors of the documents
+func (i *VectorIndex) verify() (*IndexReport, error) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	vectors, err := i.documentVectors()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IndexReport{
+		CollectionName:        i.collection.name,
+		IndexName:             i.name,
+		MissingFromIndex:      []string{},
+		MissingFromCollection: []string{},
+		c:                     i.collection,
+	}
+
+	for id, vector := range vectors {
+		node, ok := i.nodes[id]
+		if !ok || !equalVectors(node.Vector, vector) {
+			report.MissingFromIndex = append(report.MissingFromIndex, id)
+		}
+	}
+	for id := range i.nodes {
+		if _, ok := vectors[id]; !ok {
+			report.MissingFromCollection = append(report.MissingFromCollection, id)
+		}
+	}
+
+	sort.Strings(report.MissingFromIndex)
+	sort.Strings(report.MissingFromCollection)
+
+	return report, nil
+}
+
+// fix removes the nodes of the documents missing from the collection and
+// adds the latest vector of the documents missing from the graph
+func (i *VectorIndex) fix(r *IndexReport) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	dirty := map[string]struct{}{}
+	for _, id := range r.MissingFromCollection {
+		i.remove(id, dirty)
+	}
+
+	for _, id := range r.MissingFromIndex {
+		i.remove(id, dirty)
+
+		clearBytes, err := i.collection.db.getClearValue(i.collection.buildDBKey(id))
+		if err == ErrNotFound {
+			// Removed since the verification
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if vector, ok := i.vectorFromJSON(clearBytes); ok {
+			i.add(id, vector, dirty)
+		}
+	}
+
+	return i.persist(dirty)
+}
+
+// rebuild builds the graph again from the documents and saves it.
+// The updates of the graph wait for the end of the rebuild.
+func (i *VectorIndex) rebuild() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	vectors, err := i.documentVectors()
+	if err != nil {
+		return err
+	}
+
+	// The previous nodes are removed from Badger if they are not added again
+	dirty := map[string]struct{}{}
+	for id := range i.nodes {
+		dirty[id] = struct{}{}
+	}
+	i.nodes = map[string]*vectorNode{}
+	i.entryPoint = ""
+
+	ids := make([]string, 0, len(vectors))
+	for id := range vectors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		i.add(id, vectors[id], dirty)
+	}
+
+	return i.persist(dirty)
+}
+
+func equalVectors(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// vectorFromJSON returns the prepared vector of the document if it has a valid one
+func (i *VectorIndex) vectorFromJSON(content []byte) ([]float32, bool) {
+	var document interface{}
+	if json.Unmarshal(content, &document) != nil {
+		return nil, false
+	}
+
+	value, _ := rawValueAtPath(document, strings.Split(i.path, "."))
+	array, ok := value.([]interface{})
+	if !ok || len(array) != i.dims {
+		return nil, false
+	}
+
+	vector := make([]float32, len(array))
+	for j, element := range array {
+		number, ok := element.(float64)
+		if !ok {
+			return nil, false
+		}
+		vector[j] = float32(number)
+	}
+
+	return i.prepare(vector)
+}
+
+// prepare checks the dimensions of the vector and normalizes it for the cosine metric.
+// It returns a copy of the given vector.
+func (i *VectorIndex) prepare(vector []float32) ([]float32, bool) {
+	if len(vector) != i.dims {
+		return nil, false
+	}
+
+	ret := make([]float32, len(vector))
+	copy(ret, vector)
+
+	if i.metric != VectorMetricCosine {
+		return ret, true
+	}
+
+	norm := 0.0
+	for _, value := range ret {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return nil, false
+	}
+	norm = math.Sqrt(norm)
+	for j := range ret {
+		ret[j] = float32(float64(ret[j]) / norm)
+	}
+
+	return ret, true
+}
+
+func (i *VectorIndex) distance(a, b []float32) float64 {
+	switch i.metric {
+	case VectorMetricEuclidean:
+		sum := 0.0
+		for j := range a {
+			diff := float64(a[j]) - float64(b[j])
+			sum += diff * diff
+		}
+		return math.Sqrt(sum)
+	case VectorMetricDotProduct:
+		return -dotProduct(a, b)
+	}
+	// The cosine vectors are normalized
+	return 1 - dotProduct(a, b)
+}
+
+func dotProduct(a, b []float32) float64 {
+	sum := 0.0
+	for j := range a {
+		sum += float64(a[j]) * float64(b[j])
+	}
+	return sum
+}
+
+// maxNeighbors returns the maximum number of connections of a node at the given level
+func maxNeighbors(level int) int {
+	if level == 0 {
+		return vectorMaxNeighborsLevel0
+	}
+	return vectorMaxNeighbors
+}
+
+// add inserts a new node into the graph and saves the IDs of the modified nodes into dirty.
+// The caller must hold the lock.
+func (i *VectorIndex) add(id string, vector []float32, dirty map[string]struct{}) {
+	level := int(math.Floor(-math.Log(1-i.random.Float64()) * vectorLevelFactor))
+	node := &vectorNode{
+		Vector:    vector,
+		Neighbors: make([][]string, level+1),
+	}
+	for l := range node.Neighbors {
+		node.Neighbors[l] = []string{}
+	}
+
+	i.nodes[id] = node
+	dirty[id] = struct{}{}
+
+	if i.entryPoint == "" {
+		i.entryPoint = id
+		return
+	}
+
+	top := len(i.nodes[i.entryPoint].Neighbors) - 1
+	entryPoints := []string{i.entryPoint}
+
+	// Go down to the level of the new node
+	for l := top; l > level; l-- {
+		entryPoints = candidateIDs(i.searchLevel(vector, entryPoints, 1, l))
+	}
+
+	for l := minInt(level, top); l >= 0; l-- {
+		found := i.searchLevel(vector, entryPoints, vectorEfConstruction, l)
+
+		neighbors := candidateIDs(found)
+		if len(neighbors) > vectorMaxNeighbors {
+			neighbors = neighbors[:vectorMaxNeighbors]
+		}
+		node.Neighbors[l] = neighbors
+
+		// Connect the neighbors to the new node
+		for _, neighborID := range neighbors {
+			neighbor := i.nodes[neighborID]
+			neighbor.Neighbors[l] = append(neighbor.Neighbors[l], id)
+			if len(neighbor.Neighbors[l]) > maxNeighbors(l) {
+				neighbor.Neighbors[l] = i.closest(neighbor.Vector, neighbor.Neighbors[l], l)
+			}
+			dirty[neighborID] = struct{}{}
+		}
+
+		entryPoints = candidateIDs(found)
+	}
+
+	if level > top {
+		i.entryPoint = id
+	}
+}
+
+// remove deletes the node from the graph and reconnects its neighbors.
+// The caller must hold the lock.
+func (i *VectorIndex) remove(id string, dirty map[string]struct{}) {
+	node, ok := i.nodes[id]
+	if !ok {
+		return
+	}
+
+	delete(i.nodes, id)
+	dirty[id] = struct{}{}
+
+	for l, neighbors := range node.Neighbors {
+		for _, neighborID := range neighbors {
+			neighbor, ok := i.nodes[neighborID]
+			if !ok || len(neighbor.Neighbors) <= l {
+				continue
+			}
+
+			// The neighbors of the removed node are the candidates to replace it
+			candidates := []string{}
+			for _, candidateID := range append(neighbor.Neighbors[l], neighbors...) {
+				if candidateID != id && candidateID != neighborID {
+					candidates = append(candidates, candidateID)
+				}
+			}
+			neighbor.Neighbors[l] = i.closest(neighbor.Vector, candidates, l)
+			dirty[neighborID] = struct{}{}
+		}
+	}
+
+	if i.entryPoint != id {
+		return
+	}
+
+	// Find a new entry point on the highest level
+	i.entryPoint = ""
+	for nodeID, n := range i.nodes {
+		if i.entryPoint == "" || len(n.Neighbors) > len(i.nodes[i.entryPoint].Neighbors) {
+			i.entryPoint = nodeID
+		}
+	}
+}
+
+// closest returns the IDs of the nodes of the level closest to the vector without duplicates.
+// It returns at most the maximum number of connections of the level.
+func (i *VectorIndex) closest(vector []float32, ids []string, level int) []string {
+	seen := map[string]struct{}{}
+	candidates := []*vectorCandidate{}
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		node, ok := i.nodes[id]
+		if !ok || len(node.Neighbors) <= level {
+			continue
+		}
+		candidates = append(candidates, &vectorCandidate{id: id, distance: i.distance(vector, node.Vector)})
+	}
+
+	sortCandidates(candidates)
+	if len(candidates) > maxNeighbors(level) {
+		candidates = candidates[:maxNeighbors(level)]
+	}
+	return candidateIDs(candidates)
+}
+
+// searchLevel returns the ef nodes of the level closest to the vector ordered by distance
+func (i *VectorIndex) searchLevel(vector []float32, entryPoints []string, ef, level int) []*vectorCandidate {
+	visited := map[string]struct{}{}
+	candidates := &vectorHeap{}
+	results := &vectorHeap{max: true}
+
+	for _, id := range entryPoints {
+		node, ok := i.nodes[id]
+		if !ok {
+			continue
+		}
+		visited[id] = struct{}{}
+
+		candidate := &vectorCandidate{id: id, distance: i.distance(vector, node.Vector)}
+		heap.Push(candidates, candidate)
+		heap.Push(results, candidate)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(*vectorCandidate)
+		if results.Len() >= ef && current.distance > results.candidates[0].distance {
+			break
+		}
+
+		node := i.nodes[current.id]
+		if len(node.Neighbors) <= level {
+			continue
+		}
+
+		for _, neighborID := range node.Neighbors[level] {
+			if _, ok := visited[neighborID]; ok {
+				continue
+			}
+			visited[neighborID] = struct{}{}
+
+			// The links to removed nodes or to nodes added again on lower levels are ignored
+			neighbor, ok := i.nodes[neighborID]
+			if !ok || len(neighbor.Neighbors) <= level {
+				continue
+			}
+
+			distance := i.distance(vector, neighbor.Vector)
+			if results.Len() < ef || distance < results.candidates[0].distance {
+				candidate := &vectorCandidate{id: neighborID, distance: distance}
+				heap.Push(candidates, candidate)
+				heap.Push(results, candidate)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	ret := results.candidates
+	sortCandidates(ret)
+	return ret
+}
+
+// search returns the k nodes closest to the vector.
+// If allowed is not nil the other nodes are not returned.
+func (i *VectorIndex) search(vector []float32, k int, allowed map[string]struct{}) []*vectorCandidate {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	if k <= 0 || i.entryPoint == "" {
+		return nil
+	}
+
+	// Few allowed documents are faster to compare directly
+	if allowed != nil && len(allowed) <= vectorBruteForceLimit {
+		candidates := []*vectorCandidate{}
+		for id := range allowed {
+			if node, ok := i.nodes[id]; ok {
+				candidates = append(candidates, &vectorCandidate{id: id, distance: i.distance(vector, node.Vector)})
+			}
+		}
+		sortCandidates(candidates)
+		if len(candidates) > k {
+			candidates = candidates[:k]
+		}
+		return candidates
+	}
+
+	ef := maxInt(k, vectorEfSearch)
+	for {
+		entryPoints := []string{i.entryPoint}
+		for l := len(i.nodes[i.entryPoint].Neighbors) - 1; l > 0; l-- {
+			entryPoints = candidateIDs(i.searchLevel(vector, entryPoints, 1, l))
+		}
+
+		ret := []*vectorCandidate{}
+		for _, candidate := range i.searchLevel(vector, entryPoints, ef, 0) {
+			if allowed != nil {
+				if _, ok := allowed[candidate.id]; !ok {
+					continue
+				}
+			}
+			ret = append(ret, candidate)
+		}
+
+		// Search more candidates if the filter removed too many of them
+		if len(ret) >= k || ef >= len(i.nodes) {
+			if len(ret) > k {
+				ret = ret[:k]
+			}
+			return ret
+		}
+		ef *= 2
+	}
+}
+
+// sortCandidates orders the candidates by distance and by ID for equal distances
+func sortCandidates(candidates []*vectorCandidate) {
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].distance != candidates[b].distance {
+			return candidates[a].distance < candidates[b].distance
+		}
+		return candidates[a].id < candidates[b].id
+	})
+}
+
+func candidateIDs(candidates []*vectorCandidate) []string {
+	ret := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		ret[i] = candidate.id
+	}
+	return ret
+}
+
+func (h *vectorHeap) Len() int { return len(h.candidates) }
+func (h *vectorHeap) Less(a, b int) bool {
+	if h.max {
+		return h.candidates[a].distance > h.candidates[b].distance
+	}
+	return h.candidates[a].distance < h.candidates[b].distance
+}
+func (h *vectorHeap) Swap(a, b int) {
+	h.candidates[a], h.candidates[b] = h.candidates[b], h.candidates[a]
+}
+func (h *vectorHeap) Push(x interface{}) {
+	h.candidates = append(h.candidates, x.(*vectorCandidate))
+}
+func (h *vectorHeap) Pop() interface{} {
+	last := h.candidates[len(h.candidates)-1]
+	h.candidates = h.candidates[:len(h.candidates)-1]
+	return last
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,282 @@
+package gotinydb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/blevesearch/bleve"
+)
+
+type vectorTestDocument struct {
+	Category  string    `json:"category"`
+	Embedding []float32 `json:"embedding"`
+}
+
+func TestVectorIndex(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	vectorCol, err := testDB.Use("vectors")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	random := rand.New(rand.NewSource(42))
+	randomVector := func() []float32 {
+		vector := make([]float32, 8)
+		for i := range vector {
+			vector[i] = random.Float32()*2 - 1
+		}
+		return vector
+	}
+
+	vectors := map[string][]float32{}
+	putVectors := func(from, to int) {
+		batch, _ := vectorCol.NewBatch(context.Background())
+		for i := from; i < to; i++ {
+			id := fmt.Sprintf("doc%03d", i)
+			vectors[id] = randomVector()
+			batch.Put(id, &vectorTestDocument{Category: []string{"a", "b", "c"}[i%3], Embedding: vectors[id]})
+		}
+		err = batch.Write()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Documents existing before the index and added after
+	putVectors(0, 300)
+	err = vectorCol.SetVectorIndex("embeddings", "embedding", 8, VectorMetricEuclidean)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	putVectors(300, 500)
+	vectorCol.Put("no vector", map[string]string{"category": "a"})
+
+	// The exact neighbors computed by comparing every vectors
+	exact := func(query []float32, k int, category string) []string {
+		ids := []string{}
+		for id := range vectors {
+			if category == "" || []string{"a", "b", "c"}[mustAtoi(id[3:])%3] == category {
+				ids = append(ids, id)
+			}
+		}
+		distance := func(id string) float64 {
+			sum := 0.0
+			for i := range query {
+				diff := float64(query[i] - vectors[id][i])
+				sum += diff * diff
+			}
+			return sum
+		}
+		sort.Slice(ids, func(a, b int) bool { return distance(ids[a]) < distance(ids[b]) })
+		return ids[:k]
+	}
+
+	checkRecall := func(step string) {
+		found, expected := 0, 0
+		for i := 0; i < 20; i++ {
+			query := randomVector()
+			responses, err := vectorCol.NearestNeighbors("embeddings", query, 10, "", nil)
+			if err != nil {
+				t.Errorf("%s: %s", step, err.Error())
+				return
+			}
+			if len(responses) != 10 {
+				t.Errorf("%s: expected 10 responses but got %d", step, len(responses))
+				return
+			}
+
+			exactIDs := exact(query, 10, "")
+			if responses[0].ID != exactIDs[0] {
+				t.Errorf("%s: expected the closest document to be %q but got %q", step, exactIDs[0], responses[0].ID)
+			}
+			for j := 1; j < len(responses); j++ {
+				if responses[j].Distance < responses[j-1].Distance {
+					t.Errorf("%s: the responses are not ordered by distance", step)
+				}
+			}
+
+			expected += len(exactIDs)
+			for _, id := range exactIDs {
+				for _, response := range responses {
+					if response.ID == id {
+						found++
+					}
+				}
+			}
+		}
+
+		if recall := float64(found) / float64(expected); recall < 0.95 {
+			t.Errorf("%s: the recall is too low %f", step, recall)
+		}
+	}
+
+	checkRecall("insert")
+
+	// Exact match
+	responses, err := vectorCol.NearestNeighbors("embeddings", vectors["doc042"], 1, "", nil)
+	if err != nil || len(responses) != 1 || responses[0].ID != "doc042" || responses[0].Distance != 0 || responses[0].Collection != "vectors" {
+		t.Errorf("unexpected exact match %v %v", responses, err)
+	} else {
+		doc := new(vectorTestDocument)
+		err = json.Unmarshal(responses[0].Content, doc)
+		if err != nil || doc.Category != "a" {
+			t.Errorf("unexpected content %s", string(responses[0].Content))
+		}
+	}
+
+	// Updates and deletes
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("doc%03d", i)
+		if i%2 == 0 {
+			err = vectorCol.Delete(id)
+			delete(vectors, id)
+		} else {
+			vectors[id] = randomVector()
+			err = vectorCol.Put(id, &vectorTestDocument{Category: []string{"a", "b", "c"}[i%3], Embedding: vectors[id]})
+		}
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	checkRecall("update")
+
+	index, _ := vectorCol.GetVectorIndex("embeddings")
+	if index.Len() != len(vectors) {
+		t.Errorf("expected %d indexed vectors but got %d", len(vectors), index.Len())
+	}
+
+	// Bleve pre-filter
+	categoryMapping := bleve.NewDocumentStaticMapping()
+	keywordMapping := bleve.NewTextFieldMapping()
+	keywordMapping.Analyzer = "keyword"
+	categoryMapping.AddFieldMappingsAt("category", keywordMapping)
+	err = vectorCol.SetBleveIndex("categories", categoryMapping)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	query := randomVector()
+	filter := bleve.NewTermQuery("b")
+	filter.SetField("category")
+	responses, err = vectorCol.NearestNeighbors("embeddings", query, 5, "categories", filter)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	exactIDs := exact(query, 5, "b")
+	for i, response := range responses {
+		if response.ID != exactIDs[i] {
+			t.Errorf("expected filtered response %d to be %q but got %q", i, exactIDs[i], response.ID)
+		}
+	}
+
+	// The filter can't be evaluated without its index
+	if _, err = vectorCol.NearestNeighbors("embeddings", query, 5, "unknown", filter); err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+
+	// The graph is loaded when the database is opened
+	testDB.Close()
+	testDB, err = Open(testPath, testConfigKey)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	vectorCol, err = testDB.Use("vectors")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	checkRecall("reopen")
+
+	// Errors
+	if _, err = vectorCol.NearestNeighbors("embeddings", []float32{1, 2}, 1, "", nil); err != ErrInvalidVector {
+		t.Errorf("expected %v but got %v", ErrInvalidVector, err)
+	}
+	if _, err = vectorCol.NearestNeighbors("unknown", query, 1, "", nil); err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+	if err = vectorCol.SetVectorIndex("embeddings", "embedding", 4, VectorMetricEuclidean); err != ErrIndexAllreadyExistsWithDifferentMapping {
+		t.Errorf("expected %v but got %v", ErrIndexAllreadyExistsWithDifferentMapping, err)
+	}
+	if err = vectorCol.SetVectorIndex("categories", "embedding", 8, VectorMetricEuclidean); err != ErrNameAllreadyExists {
+		t.Errorf("expected %v but got %v", ErrNameAllreadyExists, err)
+	}
+	if err = vectorCol.SetVectorIndex("bad", "embedding", 8, "manhattan"); err != ErrInvalidVectorIndex {
+		t.Errorf("expected %v but got %v", ErrInvalidVectorIndex, err)
+	}
+
+	if err = vectorCol.DeleteIndex("embeddings"); err != nil {
+		t.Error(err)
+	}
+	if names := vectorCol.GetVectorIndexes(); len(names) != 0 {
+		t.Errorf("expected no vector index but got %v", names)
+	}
+}
+
+func TestVectorIndexCosine(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	err = testCol.SetVectorIndex("cosine", "position.vector", 2, VectorMetricCosine)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, angle := range map[string]float64{"east": 0, "north": 90, "west": 180, "north east": 45} {
+		radians := angle * math.Pi / 180
+		// The norm is ignored by the cosine metric
+		vector := []float64{3 * math.Cos(radians), 3 * math.Sin(radians)}
+		err = testCol.Put(id, map[string]interface{}{"position": map[string]interface{}{"vector": vector}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	responses, err := testCol.NearestNeighbors("cosine", []float32{1, 0.1}, 3, "", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	expected := []string{"east", "north east", "north"}
+	for i, response := range responses {
+		if response.ID != expected[i] {
+			t.Errorf("expected %q at %d but got %q", expected[i], i, response.ID)
+		}
+	}
+	if responses[0].Distance < 0 || responses[0].Distance > 0.01 {
+		t.Errorf("unexpected distance %f", responses[0].Distance)
+	}
+
+	if _, err = testCol.NearestNeighbors("cosine", []float32{0, 0}, 3, "", nil); err != ErrInvalidVector {
+		t.Errorf("expected %v but got %v", ErrInvalidVector, err)
+	}
+}
+
+func mustAtoi(s string) int {
+	n := 0
+	fmt.Sscanf(s, "%d", &n)
+	return n
+}
@@ -0,0 +1,123 @@
+package gotinydb
+
+import (
+	"github.com/dgraph-io/badger"
+)
+
+type (
+	// IndexReport is returned by *Collection.VerifyIndex.
+	// It lists the differences between the documents saved in the collection
+	// and the documents referenced by the index.
+	IndexReport struct {
+		CollectionName string
+		IndexName      string
+
+		// MissingFromIndex lists the IDs saved in the collection but not indexed.
+		// For the vector indexes it lists the documents indexed with an other vector too.
+		MissingFromIndex []string
+		// MissingFromCollection lists the IDs indexed but not saved in the collection.
+		// For the vector indexes it lists the documents without valid vector too.
+		MissingFromCollection []string
+
+		c *Collection
+	}
+)
+
+// VerifyIndex checks that the given index references every document of the collection
+// and nothing else. The returned report can be used to fix the index.
+// The vector indexes are checked too because their graph is saved after the documents.
+func (c *Collection) VerifyIndex(name string) (*IndexReport, error) {
+	index, release, err := c.useBleveIndex(name)
+	if err == ErrIndexNotFound {
+		if vectorIndex, vectorErr := c.GetVectorIndex(name); vectorErr == nil {
+			return vectorIndex.verify()
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	indexedIDs, err := index.listIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IndexReport{
+		CollectionName:        c.name,
+		IndexName:             name,
+		MissingFromIndex:      []string{},
+		MissingFromCollection: []string{},
+		c:                     c,
+	}
+
+	err = c.db.badger.View(func(txn *badger.Txn) error {
+		opt := badger.DefaultIteratorOptions
+		opt.PrefetchValues = false
+		iter := txn.NewIterator(opt)
+		defer iter.Close()
+
+		colPrefix := c.buildDBKey("")
+		for iter.Seek(colPrefix); iter.ValidForPrefix(colPrefix); iter.Next() {
+			id := string(iter.Item().Key()[len(colPrefix):])
+			if _, indexed := indexedIDs[id]; indexed {
+				delete(indexedIDs, id)
+				continue
+			}
+			report.MissingFromIndex = append(report.MissingFromIndex, id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range indexedIDs {
+		report.MissingFromCollection = append(report.MissingFromCollection, id)
+	}
+
+	return report, nil
+}
+
+// VerifyIndexes runs *Collection.VerifyIndex on every index of the collection
+func (c *Collection) VerifyIndexes() ([]*IndexReport, error) {
+	names := append(c.GetBleveIndexes(), c.GetVectorIndexes()...)
+	reports := make([]*IndexReport, len(names))
+
+	for i, name := range names {
+		report, err := c.VerifyIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		reports[i] = report
+	}
+
+	return reports, nil
+}
+
+// Consistent returns true if the index and the collection matches
+func (r *IndexReport) Consistent() bool {
+	return len(r.MissingFromIndex) == 0 && len(r.MissingFromCollection) == 0
+}
+
+// Fix indexes the documents which are missing from the index and removes
+// from the index the documents which are not in the collection anymore.
+func (r *IndexReport) Fix() error {
+	if r.Consistent() {
+		return nil
+	}
+
+	index, release, err := r.c.useBleveIndex(r.IndexName)
+	if err == ErrIndexNotFound {
+		if vectorIndex, vectorErr := r.c.GetVectorIndex(r.IndexName); vectorErr == nil {
+			return vectorIndex.fix(r)
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+	defer release()
+
+	return r.c.indexDocuments(index, r.MissingFromIndex, r.MissingFromCollection)
+}
@@ -0,0 +1,141 @@
+package gotinydb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alexandrestein/gotinydb/transaction"
+)
+
+func TestVerifyIndex(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	report, err := testCol.VerifyIndex(testIndexName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !report.Consistent() {
+		t.Errorf("the index must be consistent but got %v", report)
+		return
+	}
+
+	// Break the index in both ways
+	index, _ := testCol.GetBleveIndex(testIndexName)
+	index.bleveIndex.Delete(testUserID)
+	index.bleveIndex.Index("orphan", testUser)
+
+	report, err = testCol.VerifyIndex(testIndexName)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(report.MissingFromIndex) != 1 || report.MissingFromIndex[0] != testUserID {
+		t.Errorf("expected %q to be missing from the index but got %v", testUserID, report.MissingFromIndex)
+	}
+	if len(report.MissingFromCollection) != 1 || report.MissingFromCollection[0] != "orphan" {
+		t.Errorf("expected %q to be missing from the collection but got %v", "orphan", report.MissingFromCollection)
+	}
+
+	err = report.Fix()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	reports, err := testCol.VerifyIndexes()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(reports) != 2 {
+		t.Errorf("expected %d reports but got %d", 2, len(reports))
+	}
+	for _, report := range reports {
+		if !report.Consistent() {
+			t.Errorf("the index %q must be fixed but got %v", report.IndexName, report)
+		}
+	}
+
+	_, err = testCol.VerifyIndex("not existing")
+	if err != ErrIndexNotFound {
+		t.Errorf("expected %v but got %v", ErrIndexNotFound, err)
+	}
+}
+
+func TestVerifyVectorIndex(t *testing.T) {
+	defer clean()
+	err := openT(t)
+	if err != nil {
+		return
+	}
+
+	vectorCol, err := testDB.Use("vectors")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = vectorCol.SetVectorIndex("embeddings", "embedding", 2, VectorMetricEuclidean)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i, id := range []string{"v1", "v2", "v3"} {
+		vectorCol.Put(id, &vectorTestDocument{Embedding: []float32{float32(i), 1}})
+	}
+
+	// The documents are written without updating the graph like after a crash
+	writeDocument := func(id string, content []byte) {
+		err := testDB.write(transaction.NewOperation(id, nil, vectorCol.buildDBKey(id), content, content == nil, false))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeDocument("v1", nil)
+	writeDocument("v2", []byte(`{"embedding":[5,5]}`))
+	writeDocument("v4", []byte(`{"embedding":[4,4]}`))
+
+	report, err := vectorCol.VerifyIndex("embeddings")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if fmt.Sprint(report.MissingFromIndex) != "[v2 v4]" || fmt.Sprint(report.MissingFromCollection) != "[v1]" {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if err = report.Fix(); err != nil {
+		t.Error(err)
+		return
+	}
+	if report, _ = vectorCol.VerifyIndex("embeddings"); !report.Consistent() {
+		t.Errorf("the vector index must be fixed but got %+v", report)
+	}
+
+	responses, err := vectorCol.NearestNeighbors("embeddings", []float32{5, 5}, 1, "", nil)
+	if err != nil || len(responses) != 1 || responses[0].ID != "v2" {
+		t.Errorf("the fixed vector is not found %v %v", responses, err)
+	}
+
+	// The rebuild gives the same graph and the saved nodes are loaded by the next opening
+	writeDocument("v3", nil)
+	if err = vectorCol.RebuildIndex("embeddings"); err != nil {
+		t.Error(err)
+		return
+	}
+	index, _ := vectorCol.GetVectorIndex("embeddings")
+	if err = index.load(); err != nil {
+		t.Error(err)
+		return
+	}
+	if index.Len() != 2 {
+		t.Errorf("expected %d nodes but got %d", 2, index.Len())
+	}
+	if report, _ = vectorCol.VerifyIndex("embeddings"); !report.Consistent() {
+		t.Errorf("the vector index must be rebuilt but got %+v", report)
+	}
+}